@@ -7,6 +7,7 @@ import (
 
 	"github.com/mvpratt/nodewatcher/internal/db"
 	"github.com/mvpratt/nodewatcher/internal/graph"
+	"github.com/mvpratt/nodewatcher/internal/middlewares"
 	"github.com/mvpratt/nodewatcher/internal/util"
 
 	"github.com/99designs/gqlgen/graphql/handler"
@@ -31,12 +32,18 @@ func main() {
 
 	db.Connect(dbParams)
 	db.EnableDebugLogs()
-	db.RunMigrations()
+	if err := db.RunMigrations(); err != nil {
+		log.Fatalf("\nERROR: could not run database migrations: %s", err)
+	}
+
+	if err := db.LoadMasterKeys(os.Getenv("NODEWATCHER_MASTER_KEY_FILE")); err != nil {
+		log.Fatalf("\nERROR: could not load master keys: %s", err)
+	}
 
 	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{}}))
 
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	http.Handle("/query", middlewares.GraphQL(srv))
 
 	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lightninglabs/lndclient"
+	"github.com/mvpratt/nodewatcher/internal/backup"
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/util"
+)
+
+const usage = `usage: nw [command]
+
+Without a command, nw watches all nodes.
+
+Commands:
+  rotate-keys       re-encrypt node secrets and backups with the current master key
+  backup restore    write a stored channel backup to a file, and optionally restore it to a node
+  backup decrypt    decrypt a channel backup that was replicated with client-side encryption
+`
+
+const backupUsage = `usage: nw backup restore [flags]
+       nw backup decrypt [flags]
+`
+
+const restoreUsage = `usage: nw backup restore -node <alias> [-id <backup id> | -at <RFC3339 time> | -channel <txid:index>]
+                         [-out <file>] [-to <alias> [-confirm <alias>]]
+`
+
+const decryptUsage = `usage: nw backup decrypt -in <file> [-out <file>]
+
+The key is read from BACKUP_S3_CLIENT_KEY.
+`
+
+// runCommand runs a maintenance command instead of watching nodes, and returns the exit code
+func runCommand(args []string) int {
+	switch args[0] {
+	case "rotate-keys":
+		return rotateKeys()
+	case "backup":
+		if len(args) > 1 && args[1] == "restore" {
+			return restoreBackup(args[2:])
+		}
+		if len(args) > 1 && args[1] == "decrypt" {
+			return decryptBackup(args[2:])
+		}
+		fmt.Fprint(os.Stderr, backupUsage)
+		return 2
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+}
+
+// rotateKeys re-encrypts all rows that are not encrypted with the current master key. Old master
+// keys must stay in NODEWATCHER_MASTER_KEY_FILE until this has run
+func rotateKeys() int {
+	rotated, err := db.RotateKeys(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: rotated %d row(s) before failing: %s\n", rotated, err)
+		return 1
+	}
+	fmt.Printf("Re-encrypted %d row(s) with master key %s\n", rotated, db.Keys.CurrentKeyID())
+	return 0
+}
+
+// findNode finds a node by its alias
+func findNode(alias string) (db.Node, error) {
+	nodes, err := db.FindAllNodes(context.Background())
+	if err != nil {
+		return db.Node{}, err
+	}
+	for _, node := range nodes {
+		if strings.EqualFold(node.Alias, alias) {
+			return node, nil
+		}
+	}
+	return db.Node{}, fmt.Errorf("node %s not found", alias)
+}
+
+// restoreBackup writes a stored multi-channel backup of a node, or the backup of one of its
+// channels, to a file. With -to, the backup is also restored to a node, after the operator
+// confirms by typing its alias
+func restoreBackup(args []string) int {
+	flags := flag.NewFlagSet("backup restore", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, restoreUsage) }
+	alias := flags.String("node", "", "alias of the node the backup was taken from")
+	id := flags.Int64("id", 0, "id of the backup, defaults to the latest")
+	at := flags.String("at", "", "restore the backup that was current at this RFC3339 time")
+	channelPoint := flags.String("channel", "", "restore the latest backup of this one channel")
+	out := flags.String("out", "channel.backup", "file to write the backup to")
+	to := flags.String("to", "", "alias of the node to restore the backup to")
+	confirm := flags.String("confirm", "", "alias of the -to node, to restore without a prompt")
+	if err := flags.Parse(args); err != nil || *alias == "" {
+		flags.Usage()
+		return 2
+	}
+
+	var currentAt time.Time
+	if *at != "" {
+		var err error
+		currentAt, err = time.Parse(time.RFC3339, *at)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: invalid -at time: %s\n", err)
+			return 2
+		}
+	}
+
+	node, err := findNode(*alias)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		return 1
+	}
+
+	var data []byte
+	var description string
+	var restore func(client lndclient.LightningClient) error
+	if *channelPoint != "" {
+		chanBackup, err := backup.FindChannel(node, *channelPoint)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+			return 1
+		}
+		data, err = backup.ExportChannel(chanBackup)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+			return 1
+		}
+		description = fmt.Sprintf("backup %d of channel %s of %s taken %s", chanBackup.ID, *channelPoint, node.Alias, chanBackup.CreatedAt.Format(time.RFC3339))
+		restore = func(client lndclient.LightningClient) error { return backup.RestoreChannel(client, chanBackup, data) }
+	} else {
+		multiBackup, err := backup.Find(node, *id, currentAt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+			return 1
+		}
+		data, err = backup.Export(multiBackup)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+			return 1
+		}
+		description = fmt.Sprintf("backup %d of %s taken %s", multiBackup.ID, node.Alias, multiBackup.CreatedAt.Format(time.RFC3339))
+		restore = func(client lndclient.LightningClient) error { return backup.Restore(client, data) }
+	}
+
+	if err := backup.WriteFile(*out, data); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: could not write backup: %s\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote %s to %s\n", description, *out)
+
+	if *to == "" {
+		return 0
+	}
+	target, err := findNode(*to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		return 1
+	}
+	if *confirm == "" {
+		fmt.Printf("Restoring this backup to %s asks the peers of its channels to force close them.\n", target.Alias)
+		fmt.Printf("Only do this if %s lost its channel state. Type the alias of %s to confirm: ", target.Alias, target.Alias)
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		*confirm = strings.TrimSpace(line)
+	}
+	if *confirm != target.Alias {
+		fmt.Fprintln(os.Stderr, "Not confirmed, backup was not restored")
+		return 1
+	}
+
+	client, err := util.GetLndClient(target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: could not connect to %s: %s\n", target.Alias, err)
+		return 1
+	}
+	if err := restore(*client); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: could not restore backup to %s: %s\n", target.Alias, err)
+		return 1
+	}
+	fmt.Printf("Restored %s to %s\n", description, target.Alias)
+	return 0
+}
+
+// decryptBackup decrypts a multi-channel backup that was downloaded from a replication target
+// with client-side encryption, so it can be restored with lncli restorechanbackup
+func decryptBackup(args []string) int {
+	flags := flag.NewFlagSet("backup decrypt", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, decryptUsage) }
+	in := flags.String("in", "", "encrypted backup file")
+	out := flags.String("out", "channel.backup", "file to write the decrypted backup to")
+	if err := flags.Parse(args); err != nil || *in == "" {
+		flags.Usage()
+		return 2
+	}
+
+	key, err := backup.ParseClientKey(util.RequireEnvVar("BACKUP_S3_CLIENT_KEY"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		return 1
+	}
+	sealed, err := os.ReadFile(*in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: could not read backup: %s\n", err)
+		return 1
+	}
+	data, err := backup.OpenClient(key, sealed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: could not decrypt backup: %s\n", err)
+		return 1
+	}
+	if err := backup.WriteFile(*out, data); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: could not write backup: %s\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote decrypted backup to %s\n", *out)
+	return 0
+}
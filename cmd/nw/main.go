@@ -3,19 +3,49 @@ package main
 import (
 	"context"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/lightninglabs/lndclient"
 	"github.com/mvpratt/nodewatcher/internal/backup"
 	"github.com/mvpratt/nodewatcher/internal/db"
 	"github.com/mvpratt/nodewatcher/internal/health"
+	"github.com/mvpratt/nodewatcher/internal/mqtt"
+	"github.com/mvpratt/nodewatcher/internal/nostr"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+	"github.com/mvpratt/nodewatcher/internal/outbox"
+	"github.com/mvpratt/nodewatcher/internal/pagerduty"
+	"github.com/mvpratt/nodewatcher/internal/s3"
+	"github.com/mvpratt/nodewatcher/internal/telegram"
+	"github.com/mvpratt/nodewatcher/internal/templates"
 	"github.com/mvpratt/nodewatcher/internal/util"
+	"github.com/mvpratt/nodewatcher/internal/webhook"
 	"github.com/twilio/twilio-go"
 )
 
+// lndClientsMu guards the LND client cache, which is shared with the telegram bot
+var lndClientsMu sync.Mutex
+
 // Nodewatcher runs two processes:
 //  1. Checks the health of an LND node and sends an SMS once a day with the status
-//  2. Saves LND static channel backups to a PostgreSQL database once per minute
+//  2. Saves LND static channel backups to a PostgreSQL database as soon as channels open or close,
+//     polling every 15 minutes as a safety net. Unchanged backups are not stored again, and old
+//     backups are pruned hourly according to the BACKUP_KEEP_*_DAYS retention policy. If
+//     BACKUP_S3_BUCKET or BACKUP_DIR is set, every new backup is also copied to that bucket or
+//     directory
+//
+// Alerts are sent when a health check starts failing or recovers. Users and nodes with a
+// PagerDuty routing key get incidents opened and resolved through the PagerDuty Events API,
+// and users with a Slack or Discord webhook get alerts posted to it. If NOSTR_RELAYS is set,
+// users with an npub get alerts as encrypted nostr direct messages. If MQTT_BROKER is set, the
+// status of each node is published to the broker once per minute.
+// If TELEGRAM_BOT_TOKEN is set, alerts and status messages are also sent to linked telegram
+// chats and the bot answers commands from linked users.
+//
+// Nodewatcher also runs one-off maintenance commands, see runCommand.
 func main() {
 
 	dbParams := &db.ConnectionParams{
@@ -28,7 +58,17 @@ func main() {
 
 	db.Connect(dbParams)
 	db.EnableDebugLogs()
-	db.RunMigrations()
+	if err := db.RunMigrations(); err != nil {
+		log.Fatalf("\nERROR: could not run database migrations: %s", err)
+	}
+
+	if err := db.LoadMasterKeys(os.Getenv("NODEWATCHER_MASTER_KEY_FILE")); err != nil {
+		log.Fatalf("\nERROR: could not load master keys: %s", err)
+	}
+
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
 
 	twilioConfig := health.TwilioConfig{
 		From:             util.RequireEnvVar("TWILIO_PHONE_NUMBER"),
@@ -37,7 +77,99 @@ func main() {
 		TwilioAuthToken:  util.RequireEnvVar("TWILIO_AUTH_TOKEN"),
 	}
 
+	if dir := os.Getenv("NODEWATCHER_TEMPLATE_DIR"); dir != "" {
+		err := templates.LoadDefaults(dir)
+		if err != nil {
+			log.Fatalf("\nERROR: could not load notification templates: %s", err)
+		}
+	}
+
 	lndClients := make(map[string]*lndclient.LightningClient)
+	backups := backup.NewWatcher(backup.DefaultPollInterval)
+	retention, err := backup.ParseRetention(
+		os.Getenv("BACKUP_KEEP_ALL_DAYS"),
+		os.Getenv("BACKUP_KEEP_DAILY_DAYS"),
+		os.Getenv("BACKUP_KEEP_WEEKLY_DAYS"),
+	)
+	if err != nil {
+		log.Fatalf("\nERROR: invalid backup retention policy: %s", err)
+	}
+	if hours := os.Getenv("BACKUP_MAX_AGE_HOURS"); hours != "" {
+		maxAge, err := strconv.Atoi(hours)
+		if err != nil || maxAge <= 0 {
+			log.Fatalf("\nERROR: BACKUP_MAX_AGE_HOURS must be a positive number of hours")
+		}
+		health.MaxBackupAge = time.Duration(maxAge) * time.Hour
+	}
+	pruner := &backup.Pruner{Retention: retention, Interval: backup.DefaultPruneInterval}
+	go pruner.Run(context.Background())
+
+	var targets []backup.Target
+	if bucket := os.Getenv("BACKUP_S3_BUCKET"); bucket != "" {
+		target, err := newS3Target(bucket)
+		if err != nil {
+			log.Fatalf("\nERROR: invalid S3 backup replication: %s", err)
+		}
+		targets = append(targets, target)
+	}
+	if dir := os.Getenv("BACKUP_DIR"); dir != "" {
+		target, err := backup.NewDirTarget(dir, os.Getenv("BACKUP_DIR_GIT") == "true")
+		if err != nil {
+			log.Fatalf("\nERROR: invalid backup directory: %s", err)
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) > 0 {
+		replicator := &backup.Replicator{Targets: targets, Interval: backup.DefaultReplicateInterval}
+		go replicator.Run(context.Background())
+	}
+
+	notifiers := []notify.Notifier{
+		pagerduty.NewNotifier(os.Getenv("PAGERDUTY_EVENTS_URL")),
+		webhook.NewSlackNotifier(os.Getenv("NODEWATCHER_DASHBOARD_URL")),
+		webhook.NewDiscordNotifier(os.Getenv("NODEWATCHER_DASHBOARD_URL")),
+	}
+
+	if relays := os.Getenv("NOSTR_RELAYS"); relays != "" {
+		key, err := nostr.LoadOrCreateKey(util.RequireEnvVar("NOSTR_KEY_SECRET"))
+		if err != nil {
+			log.Fatalf("\nERROR: could not load nostr key: %s", err)
+		}
+		npub, _ := nostr.EncodeNpub(key.PubKey())
+		log.Printf("Sending nostr direct messages from %s", npub)
+		notifiers = append(notifiers, nostr.NewNotifier(key, strings.Split(relays, ",")))
+	}
+
+	if token := os.Getenv("TELEGRAM_BOT_TOKEN"); token != "" {
+		bot := &telegram.Bot{
+			Client: telegram.NewClient(token, os.Getenv("TELEGRAM_API_URL")),
+			Status: func(node db.Node) (string, error) {
+				client, err := getClient(lndClients, node)
+				if err != nil {
+					return "", err
+				}
+				return health.Status(client)
+			},
+		}
+		notifiers = append(notifiers, bot)
+		go bot.Run(context.Background())
+	}
+
+	smsOutbox := &outbox.Outbox{
+		From:              twilioConfig.From,
+		TwilioClient:      twilioConfig.TwilioClient,
+		StatusCallbackURL: os.Getenv("TWILIO_STATUS_CALLBACK_URL"),
+		Fallback:          notifiers,
+	}
+
+	var publisher *mqtt.Publisher
+	if broker := os.Getenv("MQTT_BROKER"); broker != "" {
+		var err error
+		publisher, err = newMQTTPublisher(broker)
+		if err != nil {
+			log.Fatalf("\nERROR: could not connect to MQTT broker: %s", err)
+		}
+	}
 
 	for {
 		nodes, _ := db.FindAllNodes(context.Background())
@@ -47,25 +179,54 @@ func main() {
 			client, err := getClient(lndClients, node)
 			if err != nil {
 				log.Printf("Error connecting to LND node %s: %s", node.Alias, err)
+				health.Unreachable(notifiers, node, err)
+				if err := health.Escalate(twilioConfig, node); err != nil {
+					log.Printf("Error escalating alerts of LND node %s: %s", node.Alias, err)
+				}
+				if err := health.FollowPolicy(notifiers, node); err != nil {
+					log.Printf("Error following escalation policy of LND node %s: %s", node.Alias, err)
+				}
+				if publisher != nil {
+					publishStatus(publisher, node, nil)
+				}
 				continue
 			}
-			lndClients[node.Alias] = client
 
-			err = health.Check(twilioConfig, node, client)
+			err = health.Check(notifiers, node, client)
 			if err != nil {
 				log.Printf("Error checking health of LND node %s: %s", node.Alias, err)
 			}
 
-			err = backup.Save(node, client)
+			err = health.Escalate(twilioConfig, node)
+			if err != nil {
+				log.Printf("Error escalating alerts of LND node %s: %s", node.Alias, err)
+			}
+
+			err = health.FollowPolicy(notifiers, node)
+			if err != nil {
+				log.Printf("Error following escalation policy of LND node %s: %s", node.Alias, err)
+			}
+
+			err = backups.Save(node, client)
 			if err != nil {
 				log.Printf("Error saving multi-channel backup for LND node %s: %s", node.Alias, err)
 			}
+
+			if publisher != nil {
+				publishStatus(publisher, node, client)
+			}
 		}
+		health.SendReports(notifiers)
+		health.SendSilenceSummaries(notifiers)
+		smsOutbox.Process()
 		time.Sleep(60 * time.Second)
 	}
 }
 
 func getClient(clients map[string]*lndclient.LightningClient, node db.Node) (*lndclient.LightningClient, error) {
+	lndClientsMu.Lock()
+	defer lndClientsMu.Unlock()
+
 	client, ok := clients[node.Alias]
 
 	if !ok || client == nil {
@@ -78,3 +239,57 @@ func getClient(clients map[string]*lndclient.LightningClient, node db.Node) (*ln
 	}
 	return client, nil
 }
+
+func newS3Target(bucket string) (*backup.S3Target, error) {
+	client := s3.NewClient(
+		util.RequireEnvVar("BACKUP_S3_ENDPOINT"),
+		os.Getenv("BACKUP_S3_REGION"),
+		bucket,
+		util.RequireEnvVar("BACKUP_S3_ACCESS_KEY_ID"),
+		util.RequireEnvVar("BACKUP_S3_SECRET_ACCESS_KEY"),
+	)
+	return backup.NewS3Target(
+		client,
+		os.Getenv("BACKUP_S3_PREFIX"),
+		os.Getenv("BACKUP_S3_ENCRYPTION"),
+		os.Getenv("BACKUP_S3_KMS_KEY_ID"),
+		os.Getenv("BACKUP_S3_CLIENT_KEY"),
+	)
+}
+
+func newMQTTPublisher(broker string) (*mqtt.Publisher, error) {
+	prefix := os.Getenv("MQTT_TOPIC_PREFIX")
+	if prefix == "" {
+		prefix = "nodewatcher"
+	}
+	var discoveryPrefix string
+	if os.Getenv("MQTT_HOMEASSISTANT_DISCOVERY") == "true" {
+		discoveryPrefix = "homeassistant"
+	}
+
+	opts := mqtt.Options{
+		Broker:    broker,
+		ClientID:  prefix,
+		Username:  os.Getenv("MQTT_USERNAME"),
+		Password:  os.Getenv("MQTT_PASSWORD"),
+		KeepAlive: 2 * time.Minute,
+	}
+	return mqtt.NewPublisher(opts, prefix, discoveryPrefix)
+}
+
+// publishStatus publishes a snapshot of the node, or marks it offline if there is no client
+func publishStatus(publisher *mqtt.Publisher, node db.Node, client *lndclient.LightningClient) {
+	var snapshot *notify.Snapshot
+	if client != nil {
+		var err error
+		snapshot, err = health.GetSnapshot(node, client)
+		if err != nil {
+			log.Printf("Error getting snapshot of LND node %s: %s", node.Alias, err)
+		}
+	}
+
+	err := publisher.PublishStatus(node, snapshot)
+	if err != nil {
+		log.Printf("Error publishing status of LND node %s to MQTT: %s", node.Alias, err)
+	}
+}
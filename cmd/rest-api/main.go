@@ -1,11 +1,16 @@
 package main
 
 import (
+	"log"
+	"os"
+
 	"github.com/gin-gonic/gin"
 	"github.com/mvpratt/nodewatcher/internal/controllers"
 	"github.com/mvpratt/nodewatcher/internal/db"
 	"github.com/mvpratt/nodewatcher/internal/middlewares"
+	"github.com/mvpratt/nodewatcher/internal/phone"
 	"github.com/mvpratt/nodewatcher/internal/util"
+	"github.com/twilio/twilio-go"
 )
 
 func main() {
@@ -20,7 +25,13 @@ func main() {
 
 	db.Connect(dbParams)
 	db.EnableDebugLogs()
-	db.RunMigrations()
+	if err := db.RunMigrations(); err != nil {
+		log.Fatalf("\nERROR: could not run database migrations: %s", err)
+	}
+
+	if err := db.LoadMasterKeys(os.Getenv("NODEWATCHER_MASTER_KEY_FILE")); err != nil {
+		log.Fatalf("\nERROR: could not load master keys: %s", err)
+	}
 
 	router := initRouter()
 	router.Run(":8000")
@@ -32,11 +43,53 @@ func initRouter() *gin.Engine {
 	{
 		api.POST("/token", controllers.GenerateToken)
 		api.POST("/user/register", controllers.RegisterUser)
+		if authToken := os.Getenv("TWILIO_AUTH_TOKEN"); authToken != "" {
+			if webhookURL := os.Getenv("TWILIO_SMS_WEBHOOK_URL"); webhookURL != "" {
+				api.POST("/sms", controllers.ReceiveSMS(authToken, webhookURL))
+			} else {
+				log.Print("\nTWILIO_SMS_WEBHOOK_URL is not set, SMS commands are disabled")
+			}
+			if callbackURL := os.Getenv("TWILIO_STATUS_CALLBACK_URL"); callbackURL != "" {
+				api.POST("/sms/status", controllers.SMSStatus(authToken, callbackURL))
+			}
+		}
 		secured := api.Group("/secured").Use(middlewares.Auth())
 		{
 			secured.POST("/user/node", controllers.CreateNode)
 			secured.GET("/user/node", controllers.GetNodes)
 			secured.GET("/user/node/multi-channel-backup", controllers.GetMultiChannelBackup)
+			secured.GET("/user/node/channels", controllers.GetChannels)
+			secured.GET("/user/node/channel-backup", controllers.ExportChannelBackup)
+			secured.POST("/user/node/channel-backup/restore", controllers.RestoreChannelBackup)
+			secured.POST("/user/telegram", controllers.LinkTelegram)
+			secured.PUT("/user/pagerduty", controllers.SetPagerDutyRoutingKey)
+			secured.PUT("/user/webhooks", controllers.SetWebhooks)
+			secured.PUT("/user/nostr", controllers.SetNostr)
+			secured.PUT("/user/escalation", controllers.SetEscalation)
+			secured.PUT("/user/schedule", controllers.SetSchedule)
+			secured.GET("/user/templates", controllers.GetTemplates)
+			secured.PUT("/user/templates", controllers.SetTemplate)
+			secured.POST("/user/templates/preview", controllers.PreviewTemplate)
+			secured.GET("/user/silences", controllers.GetSilences)
+			secured.POST("/user/silences", controllers.CreateSilence)
+			secured.DELETE("/user/silences", controllers.DeleteSilence)
+			secured.GET("/user/incidents", controllers.GetIncidents)
+			secured.POST("/user/incidents/acknowledge", controllers.AcknowledgeIncident)
+			secured.GET("/user/escalation-policies", controllers.GetEscalationPolicies)
+			secured.POST("/user/escalation-policies", controllers.CreateEscalationPolicy)
+			secured.DELETE("/user/escalation-policies", controllers.DeleteEscalationPolicy)
+			secured.PUT("/user/node/escalation-policy", controllers.SetNodeEscalationPolicy)
+			secured.GET("/user/escalation-invitations", controllers.GetEscalationInvitations)
+			secured.PUT("/user/escalation-invitations", controllers.AnswerEscalationInvitation)
+			secured.PUT("/user/phone", controllers.SetPhoneNumber)
+			secured.POST("/user/phone/confirm", controllers.ConfirmPhone)
+			secured.POST("/user/escalation/confirm", controllers.ConfirmEscalationPhone)
+			secured.PUT("/user/sms", controllers.SetSmsEnabled)
+			if from := os.Getenv("TWILIO_PHONE_NUMBER"); from != "" {
+				verifier := &phone.Verifier{From: from, TwilioClient: twilio.NewRestClient()}
+				secured.POST("/user/phone/verify", controllers.SendPhoneCode(verifier))
+				secured.POST("/user/escalation/verify", controllers.SendEscalationCode(verifier))
+			}
 		}
 	}
 	return router
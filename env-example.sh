@@ -13,4 +13,64 @@ export POSTGRES_HOST=localhost
 export POSTGRES_DB=postgres
 export POSTGRES_PORT=5432
 export POSTGRES_USER=nodewatcher
-export POSTGRES_PASSWORD=password
\ No newline at end of file
+export POSTGRES_PASSWORD=password
+
+# telegram bot (optional)
+export TELEGRAM_BOT_TOKEN=
+
+
+# pagerduty events api endpoint (optional, defaults to https://events.pagerduty.com/v2/enqueue)
+export PAGERDUTY_EVENTS_URL=
+
+# dashboard linked from slack and discord alerts (optional)
+export NODEWATCHER_DASHBOARD_URL=
+
+# nostr direct messages (optional), comma separated relays and the secret the nostr key is encrypted with
+export NOSTR_RELAYS=
+export NOSTR_KEY_SECRET=
+
+# mqtt status publishing (optional), broker as host:port, tcp://host:port or ssl://host:port
+export MQTT_BROKER=
+export MQTT_USERNAME=
+export MQTT_PASSWORD=
+export MQTT_TOPIC_PREFIX=nodewatcher
+export MQTT_HOMEASSISTANT_DISCOVERY=false
+# public url of the rest api inbound sms webhook, POST /api/sms (optional)
+export TWILIO_SMS_WEBHOOK_URL=
+
+# public url of the rest api sms status callback, POST /api/sms/status (optional)
+export TWILIO_STATUS_CALLBACK_URL=
+
+# directory of default notification templates named <channel>.<event>.tmpl (optional)
+export NODEWATCHER_TEMPLATE_DIR=
+
+# multi-channel backup retention in days (optional), every version is kept for BACKUP_KEEP_ALL_DAYS (default 7),
+# then the last version of each day for BACKUP_KEEP_DAILY_DAYS (default 90), then the last version of each week
+# for BACKUP_KEEP_WEEKLY_DAYS (default 0, forever)
+export BACKUP_KEEP_ALL_DAYS=
+export BACKUP_KEEP_DAILY_DAYS=
+export BACKUP_KEEP_WEEKLY_DAYS=
+
+# file of master keys that node macaroons, tls certs and channel backups are encrypted with (optional),
+# one <key id>:<base64 32 byte key> per line, the first key is current
+export NODEWATCHER_MASTER_KEY_FILE=
+
+# off-site multi-channel backup replication to an S3-compatible bucket (optional), encryption is sse (default),
+# sse-kms, client (with a base64 32 byte BACKUP_S3_CLIENT_KEY) or none
+export BACKUP_S3_BUCKET=
+export BACKUP_S3_ENDPOINT=https://s3.us-east-1.amazonaws.com
+export BACKUP_S3_REGION=us-east-1
+export BACKUP_S3_ACCESS_KEY_ID=
+export BACKUP_S3_SECRET_ACCESS_KEY=
+export BACKUP_S3_PREFIX=nodewatcher
+export BACKUP_S3_ENCRYPTION=sse
+export BACKUP_S3_KMS_KEY_ID=
+export BACKUP_S3_CLIENT_KEY=
+
+# directory that every new multi-channel backup is also written to (optional), set BACKUP_DIR_GIT=true to commit
+# each backup to a git repository in the directory
+export BACKUP_DIR=
+export BACKUP_DIR_GIT=false
+
+# hours after which the channel_backup check fails without a new verified multi-channel backup (optional, default 24)
+export BACKUP_MAX_AGE_HOURS=
@@ -30,8 +30,8 @@ func GenerateJWT(email string) (tokenString string, err error) {
 	return
 }
 
-// ValidateToken validates a JWT token
-func ValidateToken(signedToken string) (err error) {
+// ValidateToken validates a JWT token and returns its claims
+func ValidateToken(signedToken string) (claims *JWTClaim, err error) {
 	token, err := jwt.ParseWithClaims(
 		signedToken,
 		&JWTClaim{},
@@ -48,7 +48,7 @@ func ValidateToken(signedToken string) (err error) {
 		return
 	}
 	if claims.ExpiresAt < time.Now().Local().Unix() {
-		err = errors.New("token expired")
+		claims, err = nil, errors.New("token expired")
 		return
 	}
 	return
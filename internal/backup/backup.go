@@ -1,67 +1,123 @@
-// Package backup saves LND static channel backups to a PostgreSQL database
+// Package backup saves LND static channel backups to a PostgreSQL database and restores them
 package backup
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/lightninglabs/lndclient"
+	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/mvpratt/nodewatcher/internal/db"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-func getChannels(node db.Node, client lndclient.LightningClient) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
+// nodeLocks holds a mutex per node ID, so a node's channel backup subscription and its poll do
+// not store the same backup at the same time
+var nodeLocks sync.Map
+
+// lockNode locks the backups of a node and returns the function that unlocks them
+func lockNode(nodeID int64) func() {
+	value, _ := nodeLocks.LoadOrStore(nodeID, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// contentHash identifies a multi-channel backup by its content, so unchanged backups are not
+// stored again
+func contentHash(multi []byte) string {
+	hash := sha256.Sum256(multi)
+	return hex.EncodeToString(hash[:])
+}
 
-	channels, err := client.ListChannels(ctx, true, false)
+// storeMultiChannelBackup stores a multi-channel backup with the channel points it covers, or marks
+// the latest backup as verified if it has not changed. Backups that LND has not verified yet are
+// verified and the result recorded
+func storeMultiChannelBackup(node db.Node, client lndclient.LightningClient, backup *lnrpc.MultiChanBackup) error {
+	multi := backup.GetMultiChanBackup()
+	points, err := channelPoints(backup.GetChanPoints())
 	if err != nil {
 		return err
 	}
-	for _, item := range channels {
-		err := db.InsertChannel(item, node.Pubkey)
-		if err != nil {
-			return err
+	stored, err := db.InsertMultiChannelBackup(base64.StdEncoding.EncodeToString(multi), contentHash(multi), strings.Join(points, ","), node.Pubkey)
+	if err != nil {
+		return err
+	}
+	if stored.Verification == db.BackupValid {
+		return nil
+	}
+
+	stored.Verification = db.BackupValid
+	stored.VerificationError = ""
+	stored.VerificationCheckedAt = time.Now().UTC()
+	if err := verify(client, multi); err != nil {
+		if !verificationFailed(err) {
+			log.Printf("\nCould not verify multi-channel backup of LND node %s, retrying later: %s", node.Alias, err)
+			return nil
 		}
+		log.Printf("\nMulti-channel backup of LND node %s failed verification: %s", node.Alias, err)
+		stored.Verification = db.BackupInvalid
+		stored.VerificationError = err.Error()
 	}
-	return nil
+	return db.UpdateMultiChannelBackupVerification(stored)
 }
 
+// verificationFailed reports whether an error from VerifyChanBackup means LND could not parse the
+// backup. Other errors, e.g. from an unreachable node, leave the backup unverified, so it is
+// verified again the next time it is seen
+func verificationFailed(err error) bool {
+	if status.Code(err) == codes.InvalidArgument {
+		return true
+	}
+	return strings.Contains(err.Error(), "unable to unpack")
+}
+
+// verify asks LND whether it can parse a multi-channel backup
+func verify(client lndclient.LightningClient, multi []byte) error {
+	ctx, timeout, rpc := client.RawClientWithMacAuth(context.Background())
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := rpc.VerifyChanBackup(ctx, &lnrpc.ChanBackupSnapshot{
+		MultiChanBackup: &lnrpc.MultiChanBackup{MultiChanBackup: multi},
+	})
+	return err
+}
+
+// getMultiChannelBackups saves the multi-channel backup of a node and the backup of each of its
+// channels, all exported by LND in one call
 func getMultiChannelBackups(node db.Node, client lndclient.LightningClient) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	chanBackups, err := client.ChannelBackups(ctx)
+	ctx, _, rpc := client.RawClientWithMacAuth(ctx)
+	snapshot, err := rpc.ExportAllChannelBackups(ctx, &lnrpc.ChanBackupExportRequest{})
 	if err != nil {
 		return err
 	}
-	err = db.InsertMultiChannelBackup(base64.StdEncoding.EncodeToString(chanBackups), node.Pubkey)
+	err = storeMultiChannelBackup(node, client, snapshot.GetMultiChanBackup())
 	if err != nil {
 		return err
 	}
-	return nil
+	return saveSingleChanBackups(node, *snapshot)
 }
 
-// Save multi-channel backup to db
+// Save multi-channel backup and the backup of each channel to db
 func Save(node db.Node, lndClient *lndclient.LightningClient) error {
 	fmt.Printf("\nSaving multi-channel backup: %s", node.Alias)
+	defer lockNode(node.ID)()
 
-	err := getChannels(node, *lndClient)
+	_, err := getChannels(node, *lndClient)
 	if err != nil {
 		return err
 	}
-
-	err = getMultiChannelBackups(node, *lndClient)
-	if err != nil {
-		return err
-	}
-	return nil
+	return getMultiChannelBackups(node, *lndClient)
 }
-
-// WIP
-// get backup from db
-// multiBackup, err := db.FindMultiChannelBackupByPubkey(node.Pubkey, depotDB)
-// if err != nil {
-// 	log.Print(err.Error())
-// }
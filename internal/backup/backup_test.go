@@ -0,0 +1,32 @@
+package backup
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestVerificationFailed(t *testing.T) {
+	failed := []error{
+		status.Error(codes.InvalidArgument, "invalid backup"),
+		status.Error(codes.Unknown, "unable to unpack multi backup: chacha20poly1305: message authentication failed"),
+	}
+	for _, err := range failed {
+		if !verificationFailed(err) {
+			t.Errorf("expected %v to fail verification", err)
+		}
+	}
+
+	unverified := []error{
+		status.Error(codes.Unavailable, "connection refused"),
+		status.Error(codes.DeadlineExceeded, "context deadline exceeded"),
+		errors.New("EOF"),
+	}
+	for _, err := range unverified {
+		if verificationFailed(err) {
+			t.Errorf("expected %v to leave the backup unverified", err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+// parseChannelPoint splits a channel point of the form "<funding txid>:<output index>"
+func parseChannelPoint(channelPoint string) (string, int64, error) {
+	txid, index, ok := strings.Cut(channelPoint, ":")
+	if !ok || len(txid) != 64 {
+		return "", 0, fmt.Errorf("invalid channel point %q", channelPoint)
+	}
+	outputIndex, err := strconv.ParseInt(index, 10, 32)
+	if err != nil || outputIndex < 0 {
+		return "", 0, fmt.Errorf("invalid channel point %q", channelPoint)
+	}
+	return txid, outputIndex, nil
+}
+
+// storeChannelBackup stores the backup of a single channel of a node, or marks the latest backup
+// of the channel as verified if it already has one
+func storeChannelBackup(node db.Node, txid string, outputIndex int64, single []byte) error {
+	channel, err := db.FindChannelByPoint(node.ID, txid, outputIndex)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("\nChannel %s:%d of LND node %s is not open yet, not saving its backup", txid, outputIndex, node.Alias)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return db.InsertChannelBackup(channel, base64.StdEncoding.EncodeToString(single), contentHash(single))
+}
+
+// fundingTxid returns the funding transaction id of a channel point as a hex string
+func fundingTxid(chanPoint *lnrpc.ChannelPoint) (string, error) {
+	txid := chanPoint.GetFundingTxidStr()
+	if txidBytes := chanPoint.GetFundingTxidBytes(); len(txidBytes) > 0 {
+		hash, err := chainhash.NewHash(txidBytes)
+		if err != nil {
+			return "", err
+		}
+		txid = hash.String()
+	}
+	return txid, nil
+}
+
+// channelPoints formats the channel points of a multi-channel backup as "<funding txid>:<output index>",
+// sorted so backups of the same channels have the same points
+func channelPoints(chanPoints []*lnrpc.ChannelPoint) ([]string, error) {
+	points := make([]string, 0, len(chanPoints))
+	for _, chanPoint := range chanPoints {
+		txid, err := fundingTxid(chanPoint)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, fmt.Sprintf("%s:%d", txid, chanPoint.GetOutputIndex()))
+	}
+	sort.Strings(points)
+	return points, nil
+}
+
+// saveSingleChanBackups stores the single channel backups of a snapshot
+func saveSingleChanBackups(node db.Node, snapshot lnrpc.ChanBackupSnapshot) error {
+	for _, single := range snapshot.GetSingleChanBackups().GetChanBackups() {
+		chanPoint := single.GetChanPoint()
+		txid, err := fundingTxid(chanPoint)
+		if err != nil {
+			return err
+		}
+		err = storeChannelBackup(node, txid, int64(chanPoint.GetOutputIndex()), single.GetChanBackup())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
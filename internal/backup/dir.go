@@ -0,0 +1,151 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/util"
+)
+
+// DirTarget writes multi-channel backups to a local directory, e.g. for an air-gapped copy, as
+// <dir>/<node pubkey>/<time>-<content hash>.backup. Only the owner can read the directory and the
+// backups in it. With Git, each backup is also committed to a git repository in the directory, so
+// the operator can push its history elsewhere
+type DirTarget struct {
+	Dir string
+	Git bool
+}
+
+// NewDirTarget returns a target for a directory, creating it if needed and making it private to
+// its owner. With git, the directory is made a git repository if it is not one yet
+func NewDirTarget(dir string, git bool) (*DirTarget, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := privateDir(dir); err != nil {
+		return nil, err
+	}
+
+	target := &DirTarget{Dir: dir, Git: git}
+	if git {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+			if err := target.git("init", "--quiet"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return target, nil
+}
+
+// privateDir creates a directory that only its owner can access, or restricts an existing one
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return os.Chmod(dir, 0700)
+}
+
+// Name identifies the directory, so backups are written again to a new directory
+func (t *DirTarget) Name() string {
+	return "file://" + t.Dir
+}
+
+// Put writes a backup through a temporary file, so a partial backup is never left behind, reads
+// it back to check it and commits it if the directory is a git repository
+func (t *DirTarget) Put(node db.Node, backup db.MultiChannelBackup, multi []byte) (string, error) {
+	if err := util.ValidatePubkey(node.Pubkey); err != nil {
+		return "", err
+	}
+	nodeDir := filepath.Join(t.Dir, node.Pubkey)
+	name := filepath.Join(nodeDir, fmt.Sprintf("%s-%s.backup",
+		backup.CreatedAt.UTC().Format("20060102T150405Z"), contentHash(multi)[:16]))
+	if !within(t.Dir, name) {
+		return "", fmt.Errorf("backup file %s is outside of %s", name, t.Dir)
+	}
+	if err := privateDir(nodeDir); err != nil {
+		return "", err
+	}
+
+	if err := writeFileAtomic(name, multi); err != nil {
+		return "", err
+	}
+	stored, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(stored, multi) {
+		return "", fmt.Errorf("stored file %s does not match the backup", name)
+	}
+
+	if t.Git {
+		if err := t.commit(name, fmt.Sprintf("Backup of %s taken %s", node.Alias, backup.CreatedAt.UTC().Format(time.RFC3339))); err != nil {
+			return "", err
+		}
+	}
+	return t.Name() + strings.TrimPrefix(name, t.Dir), nil
+}
+
+// within reports whether a cleaned path is inside a directory
+func within(dir string, name string) bool {
+	rel, err := filepath.Rel(dir, name)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// writeFileAtomic writes a file only its owner can read, replacing it in one step once its
+// content is on disk
+func writeFileAtomic(name string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(name), ".backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), name)
+}
+
+// commit commits a backup file, unless it was already committed by an earlier attempt
+func (t *DirTarget) commit(name string, message string) error {
+	if err := t.git("add", "--", name); err != nil {
+		return err
+	}
+	if err := t.git("diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+	return t.git("commit", "--quiet", "--no-verify", "-m", message)
+}
+
+func (t *DirTarget) git(args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = t.Dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=nodewatcher", "GIT_AUTHOR_EMAIL=nodewatcher@localhost",
+		"GIT_COMMITTER_NAME=nodewatcher", "GIT_COMMITTER_EMAIL=nodewatcher@localhost",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
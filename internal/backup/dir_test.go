@@ -0,0 +1,61 @@
+package backup
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+func TestDirTargetPut(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := filepath.Join(t.TempDir(), "backups")
+	target, err := NewDirTarget(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubkey := "02" + strings.Repeat("ab", 32)
+	node := db.Node{Alias: "alice", Pubkey: pubkey}
+	backup := db.MultiChannelBackup{ID: 1, CreatedAt: time.Date(2023, 3, 17, 12, 0, 0, 0, time.UTC)}
+	multi := []byte("channel.backup")
+	location, err := target.Put(node, backup, multi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := strings.TrimPrefix(location, "file://")
+	if !strings.HasPrefix(name, filepath.Join(dir, pubkey, "20230317T120000Z-")) {
+		t.Errorf("unexpected location %s", location)
+	}
+
+	for path, mode := range map[string]os.FileMode{dir: 0700, filepath.Dir(name): 0700, name: 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("expected %s to have mode %o, got %o", path, mode, info.Mode().Perm())
+		}
+	}
+
+	// a retry after the backup was written but not recorded must not fail
+	if _, err := target.Put(node, backup, multi); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := target.Put(db.Node{Alias: "mallory", Pubkey: "../../etc"}, backup, multi); err == nil {
+		t.Error("expected an error for a pubkey that is not hex")
+	}
+	log, err := exec.Command("git", "-C", dir, "log", "--format=%s").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(log)) != "Backup of alice taken 2023-03-17T12:00:00Z" {
+		t.Errorf("expected one commit, got %q", log)
+	}
+}
@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lightninglabs/lndclient"
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+// Columns of the channels table that LND reports in each state of a channel
+var (
+	openColumns    = []string{"state", "peer_pubkey", "capacity", "open_height", "initiator", "private"}
+	pendingColumns = []string{"state", "peer_pubkey", "capacity", "initiator", "closing_txid"}
+	closedColumns  = []string{"state", "peer_pubkey", "capacity", "open_height", "initiator", "close_type", "closing_txid", "close_height", "settled_balance"}
+)
+
+// openHeight is the block height a channel was confirmed at, which is the first 3 bytes of its
+// short channel id
+func openHeight(channelID uint64) int64 {
+	return int64(channelID >> 40)
+}
+
+func initiator(party lndclient.Initiator) string {
+	switch party {
+	case lndclient.InitiatorLocal:
+		return db.InitiatorLocal
+	case lndclient.InitiatorRemote:
+		return db.InitiatorRemote
+	case lndclient.InitiatorBoth:
+		return db.InitiatorBoth
+	default:
+		return ""
+	}
+}
+
+func closeType(closeType lndclient.CloseType) string {
+	switch closeType {
+	case lndclient.CloseTypeCooperative:
+		return "cooperative"
+	case lndclient.CloseTypeLocalForce:
+		return "local_force"
+	case lndclient.CloseTypeRemoteForce:
+		return "remote_force"
+	case lndclient.CloseTypeBreach:
+		return "breach"
+	case lndclient.CloseTypeFundingCancelled:
+		return "funding_canceled"
+	case lndclient.CloseTypeAbandoned:
+		return "abandoned"
+	default:
+		return ""
+	}
+}
+
+// openChannel is the row of a channel that is open
+func openChannel(node db.Node, info lndclient.ChannelInfo) (db.Channel, error) {
+	txid, outputIndex, err := parseChannelPoint(info.ChannelPoint)
+	if err != nil {
+		return db.Channel{}, err
+	}
+	channel := db.Channel{
+		FundingTxid: txid,
+		OutputIndex: outputIndex,
+		NodeID:      node.ID,
+		State:       db.ChannelOpen,
+		PeerPubkey:  info.PubKeyBytes.String(),
+		Capacity:    int64(info.Capacity),
+		OpenHeight:  openHeight(info.ChannelID),
+		Initiator:   db.InitiatorRemote,
+		Private:     info.Private,
+	}
+	if info.Initiator {
+		channel.Initiator = db.InitiatorLocal
+	}
+	return channel, nil
+}
+
+// pendingChannel is the row of a channel that is being opened or closed. closingTxid is only
+// known once a channel is being force closed
+func pendingChannel(node db.Node, pending lndclient.PendingChannel, state string, closingTxid string) db.Channel {
+	return db.Channel{
+		FundingTxid: pending.ChannelPoint.Hash.String(),
+		OutputIndex: int64(pending.ChannelPoint.Index),
+		NodeID:      node.ID,
+		State:       state,
+		PeerPubkey:  pending.PubKeyBytes.String(),
+		Capacity:    int64(pending.Capacity),
+		Initiator:   initiator(pending.ChannelInitiator),
+		ClosingTxid: closingTxid,
+	}
+}
+
+// closedChannel is the row of a channel that is closed
+func closedChannel(node db.Node, closed lndclient.ClosedChannel) (db.Channel, error) {
+	txid, outputIndex, err := parseChannelPoint(closed.ChannelPoint)
+	if err != nil {
+		return db.Channel{}, err
+	}
+	return db.Channel{
+		FundingTxid:    txid,
+		OutputIndex:    outputIndex,
+		NodeID:         node.ID,
+		State:          db.ChannelClosed,
+		PeerPubkey:     closed.PubKeyBytes.String(),
+		Capacity:       int64(closed.Capacity),
+		OpenHeight:     openHeight(closed.ChannelID),
+		Initiator:      initiator(closed.OpenInitiator),
+		CloseType:      closeType(closed.CloseType),
+		ClosingTxid:    closed.ClosingTxHash,
+		CloseHeight:    int64(closed.CloseHeight),
+		SettledBalance: int64(closed.SettledBalance),
+	}, nil
+}
+
+// getChannels updates the channels of a node in the db as they move from pending to open,
+// closing and closed, and returns the open channels. Channels that are already stored as closed
+// are not updated again
+func getChannels(node db.Node, client lndclient.LightningClient) ([]lndclient.ChannelInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	channels, err := client.ListChannels(ctx, false, false)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := client.PendingChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	closed, err := client.ClosedChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range channels {
+		channel, err := openChannel(node, info)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.UpsertChannel(channel, openColumns...); err != nil {
+			return nil, err
+		}
+	}
+	for _, open := range pending.PendingOpen {
+		if err := db.UpsertChannel(pendingChannel(node, open, db.ChannelPendingOpen, ""), pendingColumns...); err != nil {
+			return nil, err
+		}
+	}
+	for _, closing := range pending.WaitingClose {
+		if err := db.UpsertChannel(pendingChannel(node, closing.PendingChannel, db.ChannelClosing, ""), pendingColumns...); err != nil {
+			return nil, err
+		}
+	}
+	for _, closing := range pending.PendingForceClose {
+		channel := pendingChannel(node, closing.PendingChannel, db.ChannelClosing, closing.CloseTxid.String())
+		if err := db.UpsertChannel(channel, pendingColumns...); err != nil {
+			return nil, err
+		}
+	}
+
+	stored, err := db.FindChannelsByNodeID(node.ID)
+	if err != nil {
+		return nil, err
+	}
+	alreadyClosed := make(map[string]bool)
+	for _, channel := range stored {
+		if channel.State == db.ChannelClosed {
+			alreadyClosed[fmt.Sprintf("%s:%d", channel.FundingTxid, channel.OutputIndex)] = true
+		}
+	}
+	for _, info := range closed {
+		if alreadyClosed[info.ChannelPoint] {
+			continue
+		}
+		channel, err := closedChannel(node, info)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.UpsertChannel(channel, closedColumns...); err != nil {
+			return nil, err
+		}
+	}
+	return channels, nil
+}
@@ -0,0 +1,51 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lightninglabs/lndclient"
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+func TestChannelLifecycle(t *testing.T) {
+	node := db.Node{ID: 3}
+	txid := strings.Repeat("ab", 32)
+	channelID := uint64(780000)<<40 | uint64(1234)<<16 | 1
+
+	open, err := openChannel(node, lndclient.ChannelInfo{
+		ChannelPoint: txid + ":1",
+		ChannelID:    channelID,
+		Capacity:     1000000,
+		Initiator:    true,
+		Private:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open.State != db.ChannelOpen || open.OpenHeight != 780000 || open.Initiator != db.InitiatorLocal ||
+		!open.Private || open.Capacity != 1000000 || open.FundingTxid != txid || open.OutputIndex != 1 {
+		t.Errorf("unexpected open channel %+v", open)
+	}
+
+	closed, err := closedChannel(node, lndclient.ClosedChannel{
+		ChannelPoint:   txid + ":1",
+		ChannelID:      channelID,
+		CloseType:      lndclient.CloseTypeRemoteForce,
+		OpenInitiator:  lndclient.InitiatorLocal,
+		CloseHeight:    790000,
+		SettledBalance: 400000,
+		ClosingTxHash:  strings.Repeat("cd", 32),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed.State != db.ChannelClosed || closed.CloseType != "remote_force" || closed.Initiator != db.InitiatorLocal ||
+		closed.OpenHeight != 780000 || closed.CloseHeight != 790000 || closed.SettledBalance != 400000 {
+		t.Errorf("unexpected closed channel %+v", closed)
+	}
+
+	if _, err := closedChannel(node, lndclient.ClosedChannel{ChannelPoint: "not a channel point"}); err == nil {
+		t.Error("expected an error for an invalid channel point")
+	}
+}
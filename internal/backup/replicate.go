@@ -0,0 +1,112 @@
+package backup
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/util"
+)
+
+// DefaultReplicateInterval is how often new multi-channel backups are copied to replication targets
+const DefaultReplicateInterval = time.Minute
+
+// replicateBatchSize is the most backups copied to a target in one run
+const replicateBatchSize = 100
+
+// Target is a place outside the database that every distinct multi-channel backup is copied to
+type Target interface {
+	// Name identifies the target, so each backup is copied to it only once
+	Name() string
+	// Put copies a multi-channel backup of a node to the target, checks the copy, and returns
+	// where it was stored
+	Put(node db.Node, backup db.MultiChannelBackup, multi []byte) (string, error)
+}
+
+// Replicate copies the multi-channel backups that are not on a target yet to it, oldest first,
+// starting from the latest backup of each node when the target is new. Backups of a node with an
+// invalid pubkey and backups that do not match their content hash are skipped and recorded, so
+// they are not fetched again. Replication stops at the first backup the target fails to store,
+// so it is retried on the next run
+func Replicate(target Target) error {
+	backups, err := db.FindUnreplicatedMultiChannelBackups(target.Name(), replicateBatchSize)
+	if err != nil {
+		return err
+	}
+
+	nodes := make(map[int64]db.Node)
+	for _, backup := range backups {
+		node, ok := nodes[backup.NodeID]
+		if !ok {
+			node, err = db.FindNodeByID(backup.NodeID)
+			if err != nil {
+				return err
+			}
+			nodes[backup.NodeID] = node
+		}
+
+		if err := util.ValidatePubkey(node.Pubkey); err != nil {
+			if err := skip(target, node, backup, err); err != nil {
+				return err
+			}
+			continue
+		}
+		multi, err := Export(backup)
+		if err != nil {
+			if err := skip(target, node, backup, err); err != nil {
+				return err
+			}
+			continue
+		}
+		location, err := target.Put(node, backup, multi)
+		if err != nil {
+			return err
+		}
+		err = db.InsertBackupReplica(&db.BackupReplica{
+			BackupID: backup.ID,
+			Target:   target.Name(),
+			Location: location,
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("\nReplicated multi-channel backup %d of LND node %s to %s", backup.ID, node.Alias, location)
+	}
+	return nil
+}
+
+// skip records that a multi-channel backup will not be copied to a target
+func skip(target Target, node db.Node, backup db.MultiChannelBackup, reason error) error {
+	log.Printf("\nNot replicating multi-channel backup %d of LND node %s to %s: %s", backup.ID, node.Alias, target.Name(), reason)
+	return db.InsertBackupReplica(&db.BackupReplica{
+		BackupID: backup.ID,
+		Target:   target.Name(),
+		Skipped:  reason.Error(),
+	})
+}
+
+// Replicator copies new multi-channel backups to replication targets in the background
+type Replicator struct {
+	Targets  []Target
+	Interval time.Duration
+}
+
+// Run replicates backups to every target every Interval until the context is done
+func (r *Replicator) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, target := range r.Targets {
+			if err := Replicate(target); err != nil {
+				log.Printf("Error replicating multi-channel backups to %s: %s", target.Name(), err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package backup
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lightninglabs/lndclient"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+// Find selects a multi-channel backup of a node: the backup with the given id if it is not zero,
+// otherwise the backup that was current at the given time if it is not zero, otherwise the latest
+func Find(node db.Node, id int64, at time.Time) (db.MultiChannelBackup, error) {
+	switch {
+	case id != 0:
+		backup, err := db.FindMultiChannelBackupByID(id)
+		if err != nil || backup.NodeID != node.ID {
+			return backup, fmt.Errorf("no backup %d of %s", id, node.Alias)
+		}
+		return backup, nil
+	case !at.IsZero():
+		backup, err := db.FindMultiChannelBackupAt(node.ID, at)
+		if err != nil {
+			return backup, fmt.Errorf("no backup of %s taken before %s", node.Alias, at.Format(time.RFC3339))
+		}
+		return backup, nil
+	default:
+		backup, err := db.FindMultiChannelBackupByPubkey(node.Pubkey)
+		if err != nil {
+			return backup, fmt.Errorf("no backup of %s", node.Alias)
+		}
+		return backup, nil
+	}
+}
+
+// FindChannel selects the latest backup of a single channel of a node by its channel point
+func FindChannel(node db.Node, channelPoint string) (db.ChannelBackup, error) {
+	txid, outputIndex, err := parseChannelPoint(channelPoint)
+	if err != nil {
+		return db.ChannelBackup{}, err
+	}
+	channel, err := db.FindChannelByPoint(node.ID, txid, outputIndex)
+	if err != nil {
+		return db.ChannelBackup{}, fmt.Errorf("no channel %s of %s", channelPoint, node.Alias)
+	}
+	backup, err := db.FindChannelBackup(channel.ID)
+	if err != nil {
+		return backup, fmt.Errorf("no backup of channel %s of %s", channelPoint, node.Alias)
+	}
+	return backup, nil
+}
+
+// decode decodes a stored backup and checks it against its content hash
+func decode(id int64, encoded string, hash string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode backup %d: %w", id, err)
+	}
+	if hash != "" && contentHash(decoded) != hash {
+		return nil, fmt.Errorf("backup %d does not match its content hash", id)
+	}
+	return decoded, nil
+}
+
+// Export returns the channel.backup file of a backup, byte for byte as LND wrote it, after
+// checking it against the backup's content hash
+func Export(backup db.MultiChannelBackup) ([]byte, error) {
+	return decode(backup.ID, backup.Backup, backup.ContentHash)
+}
+
+// ExportChannel returns the backup of a single channel, byte for byte as LND exported it, after
+// checking it against the backup's content hash
+func ExportChannel(backup db.ChannelBackup) ([]byte, error) {
+	return decode(backup.ID, backup.Backup, backup.ContentHash)
+}
+
+// WriteFile writes a backup file that only its owner can read. An existing file is never
+// overwritten
+func WriteFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Restore asks an LND node to restore the channels in a multi-channel backup. LND then asks the
+// peers of those channels to force close them, so this is only for recovering a node that lost
+// its channel state
+func Restore(client lndclient.LightningClient, multi []byte) error {
+	ctx, timeout, rpc := client.RawClientWithMacAuth(context.Background())
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := rpc.RestoreChannelBackups(ctx, &lnrpc.RestoreChanBackupRequest{
+		Backup: &lnrpc.RestoreChanBackupRequest_MultiChanBackup{MultiChanBackup: multi},
+	})
+	return err
+}
+
+// RestoreChannel asks an LND node to restore a single channel from its backup. LND then asks the
+// peer of the channel to force close it
+func RestoreChannel(client lndclient.LightningClient, backup db.ChannelBackup, single []byte) error {
+	ctx, timeout, rpc := client.RawClientWithMacAuth(context.Background())
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := rpc.RestoreChannelBackups(ctx, &lnrpc.RestoreChanBackupRequest{
+		Backup: &lnrpc.RestoreChanBackupRequest_ChanBackups{ChanBackups: &lnrpc.ChannelBackups{
+			ChanBackups: []*lnrpc.ChannelBackup{{
+				ChanPoint: &lnrpc.ChannelPoint{
+					FundingTxid: &lnrpc.ChannelPoint_FundingTxidStr{FundingTxidStr: backup.FundingTxid},
+					OutputIndex: uint32(backup.OutputIndex),
+				},
+				ChanBackup: single,
+			}},
+		}},
+	})
+	return err
+}
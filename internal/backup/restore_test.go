@@ -0,0 +1,37 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+func TestExport(t *testing.T) {
+	multi := []byte{0x00, 0x01, 0xfe, 0xff}
+	stored := db.MultiChannelBackup{ID: 1, Backup: base64.StdEncoding.EncodeToString(multi), ContentHash: contentHash(multi)}
+
+	exported, err := Export(stored)
+	if err != nil || !bytes.Equal(exported, multi) {
+		t.Fatalf("got %x, %v, want %x", exported, err, multi)
+	}
+
+	stored.ContentHash = contentHash([]byte("other"))
+	if _, err := Export(stored); err == nil {
+		t.Error("expected an error when the backup does not match its content hash")
+	}
+
+	path := filepath.Join(t.TempDir(), "channel.backup")
+	if err := WriteFile(path, multi); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("expected the file to be readable only by its owner, got %s", info.Mode())
+	}
+	if err := WriteFile(path, multi); err == nil {
+		t.Error("expected an existing file not to be overwritten")
+	}
+}
@@ -0,0 +1,195 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+const day = 24 * time.Hour
+
+// DefaultPruneInterval is how often old backups are pruned
+const DefaultPruneInterval = time.Hour
+
+// DefaultRetention keeps every version of a node's multi-channel backup for a week, the last
+// version of each day for 90 days, and the last version of each week after that
+var DefaultRetention = Retention{
+	KeepAll:    7 * day,
+	KeepDaily:  90 * day,
+	KeepWeekly: 0,
+}
+
+// Retention is how long multi-channel backups, and the backups of single channels, are kept.
+// Every version is kept for KeepAll, then the last version of each day until KeepDaily, then the
+// last version of each week until KeepWeekly, or forever if KeepWeekly is zero. The latest version
+// of a node, or of an open channel, is always kept
+type Retention struct {
+	KeepAll    time.Duration
+	KeepDaily  time.Duration
+	KeepWeekly time.Duration
+}
+
+// ParseRetention parses a retention policy from the number of days to keep all, daily and weekly
+// versions. Empty values use the default
+func ParseRetention(allDays, dailyDays, weeklyDays string) (Retention, error) {
+	retention := DefaultRetention
+	for _, setting := range []struct {
+		value string
+		dst   *time.Duration
+	}{
+		{allDays, &retention.KeepAll},
+		{dailyDays, &retention.KeepDaily},
+		{weeklyDays, &retention.KeepWeekly},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		days, err := strconv.Atoi(setting.value)
+		if err != nil || days < 0 {
+			return retention, fmt.Errorf("invalid number of days %q", setting.value)
+		}
+		*setting.dst = time.Duration(days) * day
+	}
+
+	if retention.KeepDaily < retention.KeepAll {
+		return retention, fmt.Errorf("daily backups must be kept at least as long as all backups")
+	}
+	if retention.KeepWeekly != 0 && retention.KeepWeekly < retention.KeepDaily {
+		return retention, fmt.Errorf("weekly backups must be kept at least as long as daily backups")
+	}
+	return retention, nil
+}
+
+// version is a stored version of a backup and the last time it was the current backup
+type version struct {
+	id int64
+	at time.Time
+}
+
+func multiVersions(backups []db.MultiChannelBackup) []version {
+	versions := make([]version, 0, len(backups))
+	for _, backup := range backups {
+		versions = append(versions, version{id: backup.ID, at: backup.VerifiedAt()})
+	}
+	return versions
+}
+
+func channelVersions(backups []db.ChannelBackup) []version {
+	versions := make([]version, 0, len(backups))
+	for _, backup := range backups {
+		versions = append(versions, version{id: backup.ID, at: backup.VerifiedAt()})
+	}
+	return versions
+}
+
+// prunable returns the ids of the versions of a backup, oldest first, that the retention policy
+// no longer keeps. With keepLatest, the latest version is kept whatever its age
+func prunable(versions []version, retention Retention, now time.Time, keepLatest bool) []int64 {
+	var ids []int64
+	kept := make(map[string]bool)
+
+	// newest first, so the last version of each day or week is the one kept
+	for i := len(versions) - 1; i >= 0; i-- {
+		at := versions[i].at.UTC()
+		age := now.Sub(at)
+
+		var bucket string
+		switch {
+		case (keepLatest && i == len(versions)-1) || age < retention.KeepAll:
+			continue
+		case age < retention.KeepDaily:
+			bucket = at.Format("daily 2006-01-02")
+		case retention.KeepWeekly == 0 || age < retention.KeepWeekly:
+			year, week := at.ISOWeek()
+			bucket = fmt.Sprintf("weekly %d-%02d", year, week)
+		default:
+			ids = append(ids, versions[i].id)
+			continue
+		}
+
+		if kept[bucket] {
+			ids = append(ids, versions[i].id)
+			continue
+		}
+		kept[bucket] = true
+	}
+
+	// oldest first
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	return ids
+}
+
+// Prune deletes the multi-channel backups of every node, and the backups of its channels, that
+// the retention policy no longer keeps. The latest backup of a closed channel is pruned like the
+// older ones, once it is past the policy
+func Prune(retention Retention) error {
+	nodes, err := db.FindAllNodes(context.Background())
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, node := range nodes {
+		backups, err := db.FindMultiChannelBackupVersions(node.ID)
+		if err != nil {
+			return err
+		}
+		deleted, err := db.DeleteMultiChannelBackups(prunable(multiVersions(backups), retention, now, true))
+		if err != nil {
+			return err
+		}
+		if deleted > 0 {
+			log.Printf("\nPruned %d multi-channel backup(s) of LND node %s", deleted, node.Alias)
+		}
+
+		channels, err := db.FindChannelsByNodeID(node.ID)
+		if err != nil {
+			return err
+		}
+		deleted = 0
+		for _, channel := range channels {
+			backups, err := db.FindChannelBackupVersions(channel.ID)
+			if err != nil {
+				return err
+			}
+			n, err := db.DeleteChannelBackups(prunable(channelVersions(backups), retention, now, channel.State != db.ChannelClosed))
+			if err != nil {
+				return err
+			}
+			deleted += n
+		}
+		if deleted > 0 {
+			log.Printf("\nPruned %d channel backup(s) of LND node %s", deleted, node.Alias)
+		}
+	}
+	return nil
+}
+
+// Pruner prunes old backups in the background
+type Pruner struct {
+	Retention Retention
+	Interval  time.Duration
+}
+
+// Run prunes backups every Interval until the context is done
+func (p *Pruner) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := Prune(p.Retention); err != nil {
+			log.Printf("Error pruning backups: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
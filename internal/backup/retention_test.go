@@ -0,0 +1,63 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+func TestPrunable(t *testing.T) {
+	now := time.Date(2023, 3, 31, 12, 0, 0, 0, time.UTC)
+	retention := Retention{KeepAll: 7 * day, KeepDaily: 30 * day, KeepWeekly: 60 * day}
+	backups := []db.MultiChannelBackup{
+		{ID: 1, LastVerifiedAt: now.Add(-90 * day)},
+		{ID: 2, LastVerifiedAt: time.Date(2023, 2, 6, 9, 0, 0, 0, time.UTC)},
+		{ID: 3, LastVerifiedAt: time.Date(2023, 2, 8, 9, 0, 0, 0, time.UTC)},
+		{ID: 4, LastVerifiedAt: time.Date(2023, 3, 10, 9, 0, 0, 0, time.UTC)},
+		{ID: 5, LastVerifiedAt: time.Date(2023, 3, 10, 18, 0, 0, 0, time.UTC)},
+		{ID: 6, LastVerifiedAt: now.Add(-2 * day)},
+		{ID: 7, LastVerifiedAt: now.Add(-2*day + time.Hour)},
+		{ID: 8, LastVerifiedAt: now},
+	}
+
+	expected := []int64{1, 2, 4}
+	actual := prunable(multiVersions(backups), retention, now, true)
+	if len(actual) != len(expected) {
+		t.Fatalf("got %v, want %v", actual, expected)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("got %v, want %v", actual, expected)
+		}
+	}
+
+	old := []db.MultiChannelBackup{{ID: 1, CreatedAt: now.Add(-365 * day)}}
+	if ids := prunable(multiVersions(old), retention, now, true); len(ids) != 0 {
+		t.Errorf("expected the latest backup to be kept, got %v", ids)
+	}
+
+	closed := []db.ChannelBackup{{ID: 1, CreatedAt: now.Add(-365 * day)}}
+	if ids := prunable(channelVersions(closed), retention, now, false); len(ids) != 1 {
+		t.Errorf("expected the backup of a long closed channel to be pruned, got %v", ids)
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	retention, err := ParseRetention("", "", "")
+	if err != nil || retention != DefaultRetention {
+		t.Errorf("expected default retention, got %+v, %v", retention, err)
+	}
+
+	retention, err = ParseRetention("3", "14", "365")
+	if err != nil || retention.KeepAll != 3*day || retention.KeepDaily != 14*day || retention.KeepWeekly != 365*day {
+		t.Errorf("got %+v, %v", retention, err)
+	}
+
+	if _, err := ParseRetention("30", "14", ""); err == nil {
+		t.Error("expected an error when daily backups are kept for less time than all backups")
+	}
+	if _, err := ParseRetention("", "", "-1"); err == nil {
+		t.Error("expected an error for negative days")
+	}
+}
@@ -0,0 +1,173 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/s3"
+	"github.com/mvpratt/nodewatcher/internal/util"
+)
+
+// Ways backups are encrypted in an S3 bucket. LND already encrypts backups with a key derived
+// from the node's seed, so S3EncryptionNone still does not expose channel state
+const (
+	// S3EncryptionSSE has the object store encrypt backups with its own keys (SSE-S3)
+	S3EncryptionSSE = "sse"
+	// S3EncryptionKMS has the object store encrypt backups with a KMS key (SSE-KMS)
+	S3EncryptionKMS = "sse-kms"
+	// S3EncryptionClient encrypts backups with AES-256-GCM before they are uploaded
+	S3EncryptionClient = "client"
+	// S3EncryptionNone uploads backups as LND wrote them
+	S3EncryptionNone = "none"
+)
+
+// DefaultS3Prefix is the key prefix of backups in the bucket when none is configured
+const DefaultS3Prefix = "nodewatcher"
+
+// S3Target copies multi-channel backups to a bucket of an S3-compatible object store, as
+// <prefix>/<node pubkey>/<time>-<content hash>.backup
+type S3Target struct {
+	Client     *s3.Client
+	Prefix     string
+	Encryption string
+	KMSKeyID   string
+	ClientKey  []byte
+}
+
+// NewS3Target returns a target for a bucket. clientKey is a base64 encoded 32 byte key, only
+// used with S3EncryptionClient, and kmsKeyID is only used with S3EncryptionKMS, where an empty
+// id uses the store's default key
+func NewS3Target(client *s3.Client, prefix, encryption, kmsKeyID, clientKey string) (*S3Target, error) {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		prefix = DefaultS3Prefix
+	}
+	if encryption == "" {
+		encryption = S3EncryptionSSE
+	}
+	target := &S3Target{Client: client, Prefix: prefix, Encryption: encryption, KMSKeyID: kmsKeyID}
+
+	switch encryption {
+	case S3EncryptionSSE, S3EncryptionKMS, S3EncryptionNone:
+	case S3EncryptionClient:
+		key, err := ParseClientKey(clientKey)
+		if err != nil {
+			return nil, err
+		}
+		target.ClientKey = key
+	default:
+		return nil, fmt.Errorf("unknown S3 encryption %q, use %s, %s, %s or %s",
+			encryption, S3EncryptionSSE, S3EncryptionKMS, S3EncryptionClient, S3EncryptionNone)
+	}
+	return target, nil
+}
+
+// ParseClientKey decodes a base64 encoded 32 byte client-side encryption key
+func ParseClientKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client-side encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, errors.New("client-side encryption key must be 32 bytes")
+	}
+	return key, nil
+}
+
+// Name identifies the bucket and prefix, so backups are copied again to a new bucket
+func (t *S3Target) Name() string {
+	return "s3://" + t.Client.Bucket + "/" + t.Prefix
+}
+
+// Put uploads a backup, then downloads it again to check the stored object
+func (t *S3Target) Put(node db.Node, backup db.MultiChannelBackup, multi []byte) (string, error) {
+	if err := util.ValidatePubkey(node.Pubkey); err != nil {
+		return "", err
+	}
+	key := path.Join(t.Prefix, node.Pubkey, fmt.Sprintf("%s-%s.backup",
+		backup.CreatedAt.UTC().Format("20060102T150405Z"), contentHash(multi)[:16]))
+	if !strings.HasPrefix(key, t.Prefix+"/") {
+		return "", fmt.Errorf("backup key %s is outside of %s", key, t.Prefix)
+	}
+
+	body := multi
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("X-Amz-Meta-Content-Sha256", contentHash(multi))
+	switch t.Encryption {
+	case S3EncryptionSSE:
+		header.Set("X-Amz-Server-Side-Encryption", "AES256")
+	case S3EncryptionKMS:
+		header.Set("X-Amz-Server-Side-Encryption", "aws:kms")
+		if t.KMSKeyID != "" {
+			header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", t.KMSKeyID)
+		}
+	case S3EncryptionClient:
+		var err error
+		body, err = SealClient(t.ClientKey, multi)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if _, err := t.Client.PutObject(ctx, key, body, header); err != nil {
+		return "", err
+	}
+	stored, err := t.Client.GetObject(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("could not read back %s: %w", key, err)
+	}
+	if !bytes.Equal(stored, body) {
+		return "", fmt.Errorf("stored object %s does not match the uploaded backup", key)
+	}
+	return "s3://" + t.Client.Bucket + "/" + key, nil
+}
+
+// SealClient encrypts a backup for client-side encryption, as a 12 byte nonce followed by the
+// AES-256-GCM ciphertext
+func SealClient(key []byte, multi []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, multi, nil), nil
+}
+
+// OpenClient decrypts a backup that was encrypted client-side
+func OpenClient(key []byte, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("encrypted backup is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
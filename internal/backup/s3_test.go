@@ -0,0 +1,75 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/s3"
+)
+
+func TestS3TargetPut(t *testing.T) {
+	objects := map[string][]byte{}
+	corrupt := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			objects[r.URL.Path], _ = io.ReadAll(r.Body)
+		case http.MethodGet:
+			object := objects[r.URL.Path]
+			if corrupt {
+				object = append([]byte{0}, object...)
+			}
+			w.Write(object)
+		}
+	}))
+	defer server.Close()
+
+	key := "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="
+	client := s3.NewClient(server.URL, "", "backups", "minio", "minio123")
+	target, err := NewS3Target(client, "/nodewatcher/", S3EncryptionClient, "", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Name() != "s3://backups/nodewatcher" {
+		t.Errorf("unexpected name %s", target.Name())
+	}
+
+	pubkey := "02" + strings.Repeat("ab", 32)
+	node := db.Node{Alias: "alice", Pubkey: pubkey}
+	backup := db.MultiChannelBackup{ID: 1, CreatedAt: time.Date(2023, 3, 17, 12, 0, 0, 0, time.UTC)}
+	multi := []byte("channel.backup")
+	location, err := target.Put(node, backup, multi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location, "s3://backups/nodewatcher/"+pubkey+"/20230317T120000Z-") {
+		t.Errorf("unexpected location %s", location)
+	}
+
+	sealed := objects["/backups"+strings.TrimPrefix(location, "s3://backups")]
+	if sealed == nil || bytes.Contains(sealed, multi) {
+		t.Fatalf("expected the backup encrypted client-side, got %q", sealed)
+	}
+	opened, err := OpenClient(target.ClientKey, sealed)
+	if err != nil || !bytes.Equal(opened, multi) {
+		t.Errorf("got %q, %v", opened, err)
+	}
+
+	corrupt = true
+	if _, err := target.Put(node, backup, multi); err == nil {
+		t.Error("expected an error when the stored object does not match")
+	}
+
+	if _, err := NewS3Target(client, "", S3EncryptionClient, "", ""); err == nil {
+		t.Error("expected an error without a client-side encryption key")
+	}
+	if _, err := NewS3Target(client, "", "rot13", "", ""); err == nil {
+		t.Error("expected an error for an unknown encryption")
+	}
+}
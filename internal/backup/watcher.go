@@ -0,0 +1,121 @@
+package backup
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lightninglabs/lndclient"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+// DefaultPollInterval is how often a node with a channel backup subscription is still polled
+// for its multi-channel backup, in case a change was missed
+const DefaultPollInterval = 15 * time.Minute
+
+// Watcher subscribes to the channel backup stream of each node, so a new multi-channel backup is
+// stored as soon as a channel is opened or closed. Nodes are also polled every PollInterval, and
+// right away whenever their subscription is restarted
+type Watcher struct {
+	PollInterval time.Duration
+
+	mu         sync.Mutex
+	subscribed map[int64]bool
+	lastPoll   map[int64]time.Time
+}
+
+// NewWatcher returns a watcher that polls subscribed nodes every pollInterval
+func NewWatcher(pollInterval time.Duration) *Watcher {
+	return &Watcher{
+		PollInterval: pollInterval,
+		subscribed:   make(map[int64]bool),
+		lastPoll:     make(map[int64]time.Time),
+	}
+}
+
+// Save subscribes to the channel backups of a node if it is not subscribed yet, and saves its
+// multi-channel backup if a poll is due
+func (w *Watcher) Save(node db.Node, lndClient *lndclient.LightningClient) error {
+	w.mu.Lock()
+	if !w.subscribed[node.ID] {
+		w.subscribed[node.ID] = true
+		go w.subscribe(node, *lndClient)
+	}
+	due := time.Since(w.lastPoll[node.ID]) >= w.PollInterval
+	w.mu.Unlock()
+
+	if !due {
+		return nil
+	}
+	err := Save(node, lndClient)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.lastPoll[node.ID] = time.Now()
+	w.mu.Unlock()
+	return nil
+}
+
+// subscribe saves every channel backup snapshot LND sends for a node until the stream fails.
+// The next call to Save then subscribes again
+func (w *Watcher) subscribe(node db.Node, client lndclient.LightningClient) {
+	defer func() {
+		w.mu.Lock()
+		delete(w.subscribed, node.ID)
+		delete(w.lastPoll, node.ID)
+		w.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	snapshots, errs, err := client.SubscribeChannelBackups(ctx)
+	if err != nil {
+		log.Printf("Error subscribing to channel backups of LND node %s: %s", node.Alias, err)
+		return
+	}
+	log.Printf("\nSubscribed to channel backups of LND node %s", node.Alias)
+
+	for {
+		select {
+		case snapshot, ok := <-snapshots:
+			if !ok {
+				return
+			}
+			err := saveSnapshot(node, client, snapshot)
+			if err != nil {
+				log.Printf("Error saving channel backup snapshot of LND node %s: %s", node.Alias, err)
+			}
+		case err, ok := <-errs:
+			if !ok {
+				return
+			}
+			log.Printf("Channel backup subscription of LND node %s failed: %s", node.Alias, err)
+			return
+		}
+	}
+}
+
+// saveSnapshot stores the multi-channel backup and single channel backups of a snapshot, and the
+// node's current channels
+func saveSnapshot(node db.Node, client lndclient.LightningClient, snapshot lnrpc.ChanBackupSnapshot) error {
+	if len(snapshot.GetMultiChanBackup().GetMultiChanBackup()) == 0 {
+		return nil
+	}
+	log.Printf("\nChannel backup of LND node %s changed, saving", node.Alias)
+	defer lockNode(node.ID)()
+
+	_, err := getChannels(node, client)
+	if err != nil {
+		return err
+	}
+	err = storeMultiChannelBackup(node, client, snapshot.GetMultiChanBackup())
+	if err != nil {
+		return err
+	}
+	return saveSingleChanBackups(node, snapshot)
+}
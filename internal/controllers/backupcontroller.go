@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lightninglabs/lndclient"
+	"github.com/mvpratt/nodewatcher/internal/backup"
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/util"
+)
+
+// ChannelBackupRequest is the request body for the ExportChannelBackup endpoint. Without an id,
+// time or channel point the latest multi-channel backup is exported
+type ChannelBackupRequest struct {
+	Alias        string    `json:"alias"`
+	ID           int64     `json:"id"`
+	At           time.Time `json:"at"`
+	ChannelPoint string    `json:"channel_point"`
+}
+
+// RestoreChannelBackupRequest is the request body for the RestoreChannelBackup endpoint. Confirm
+// must be the alias of the target node
+type RestoreChannelBackupRequest struct {
+	Alias        string    `json:"alias"`
+	ID           int64     `json:"id"`
+	At           time.Time `json:"at"`
+	ChannelPoint string    `json:"channel_point"`
+	Target       string    `json:"target"`
+	Confirm      string    `json:"confirm"`
+}
+
+// ChannelsRequest is the request body for the GetChannels endpoint
+type ChannelsRequest struct {
+	Alias string `json:"alias"`
+}
+
+// findUserNode finds a node of a user by its alias
+func findUserNode(user db.User, alias string) (db.Node, bool) {
+	nodes, _ := db.FindNodesByUserID(user.ID)
+	for _, node := range nodes {
+		if strings.EqualFold(node.Alias, alias) {
+			return node, true
+		}
+	}
+	return db.Node{}, false
+}
+
+// selectedBackup is a multi-channel backup, or the backup of a single channel, picked by a request
+type selectedBackup struct {
+	id        int64
+	createdAt time.Time
+	data      []byte
+	filename  string
+	restore   func(client lndclient.LightningClient) error
+}
+
+// selectBackup finds the backup of a node that a request picked, and checks it can be exported
+func selectBackup(node db.Node, id int64, at time.Time, channelPoint string) (selectedBackup, int, error) {
+	if channelPoint != "" {
+		chanBackup, err := backup.FindChannel(node, channelPoint)
+		if err != nil {
+			return selectedBackup{}, http.StatusNotFound, err
+		}
+		data, err := backup.ExportChannel(chanBackup)
+		if err != nil {
+			return selectedBackup{}, http.StatusInternalServerError, err
+		}
+		return selectedBackup{
+			id:        chanBackup.ID,
+			createdAt: chanBackup.CreatedAt,
+			data:      data,
+			filename:  fmt.Sprintf("%s-%s-%d.backup", node.Alias, chanBackup.FundingTxid, chanBackup.OutputIndex),
+			restore: func(client lndclient.LightningClient) error {
+				return backup.RestoreChannel(client, chanBackup, data)
+			},
+		}, http.StatusOK, nil
+	}
+
+	multiBackup, err := backup.Find(node, id, at)
+	if err != nil {
+		return selectedBackup{}, http.StatusNotFound, err
+	}
+	data, err := backup.Export(multiBackup)
+	if err != nil {
+		return selectedBackup{}, http.StatusInternalServerError, err
+	}
+	return selectedBackup{
+		id:        multiBackup.ID,
+		createdAt: multiBackup.CreatedAt,
+		data:      data,
+		filename:  node.Alias + "-channel.backup",
+		restore: func(client lndclient.LightningClient) error {
+			return backup.Restore(client, data)
+		},
+	}, http.StatusOK, nil
+}
+
+// GetChannels returns the channels of one of the user's nodes, including closed channels, with
+// their state and the latest backup of each
+func GetChannels(context *gin.Context) {
+	var request ChannelsRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+	node, found := findUserNode(user, request.Alias)
+	if !found {
+		context.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+		context.Abort()
+		return
+	}
+	channels, err := db.FindChannelsByNodeID(node.ID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	response := make([]gin.H, 0, len(channels))
+	for _, channel := range channels {
+		item := gin.H{
+			"id":              channel.ID,
+			"channel_point":   fmt.Sprintf("%s:%d", channel.FundingTxid, channel.OutputIndex),
+			"state":           channel.State,
+			"peer_pubkey":     channel.PeerPubkey,
+			"capacity":        channel.Capacity,
+			"open_height":     channel.OpenHeight,
+			"initiator":       channel.Initiator,
+			"private":         channel.Private,
+			"close_type":      channel.CloseType,
+			"closing_txid":    channel.ClosingTxid,
+			"close_height":    channel.CloseHeight,
+			"settled_balance": channel.SettledBalance,
+			"backup":          nil,
+		}
+		if chanBackup, err := db.FindChannelBackup(channel.ID); err == nil {
+			item["backup"] = gin.H{
+				"id":               chanBackup.ID,
+				"created_at":       chanBackup.CreatedAt,
+				"last_verified_at": chanBackup.LastVerifiedAt,
+				"backup":           chanBackup.Backup,
+			}
+		}
+		response = append(response, item)
+	}
+	context.JSON(http.StatusOK, response)
+}
+
+// ExportChannelBackup returns a multi-channel backup of one of the user's nodes as a
+// channel.backup file, or the backup of one of its channels
+func ExportChannelBackup(context *gin.Context) {
+	var request ChannelBackupRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+	node, found := findUserNode(user, request.Alias)
+	if !found {
+		context.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+		context.Abort()
+		return
+	}
+	selected, status, err := selectBackup(node, request.ID, request.At, request.ChannelPoint)
+	if err != nil {
+		context.JSON(status, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	context.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", selected.filename))
+	context.Header("X-Backup-Id", fmt.Sprint(selected.id))
+	context.Data(http.StatusOK, "application/octet-stream", selected.data)
+}
+
+// RestoreChannelBackup restores a multi-channel backup of one of the user's nodes, or the backup of
+// one of its channels, to another of their nodes or the same node. The peers of the channels in
+// the backup are asked to force close them, so the request must confirm the alias of the target node
+func RestoreChannelBackup(context *gin.Context) {
+	var request RestoreChannelBackupRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+	node, found := findUserNode(user, request.Alias)
+	if !found {
+		context.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+		context.Abort()
+		return
+	}
+	target, found := findUserNode(user, request.Target)
+	if !found {
+		context.JSON(http.StatusNotFound, gin.H{"error": "target node not found"})
+		context.Abort()
+		return
+	}
+	if request.Confirm != target.Alias {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "confirm must be the alias of the target node"})
+		context.Abort()
+		return
+	}
+
+	selected, status, err := selectBackup(node, request.ID, request.At, request.ChannelPoint)
+	if err != nil {
+		context.JSON(status, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	client, err := util.GetLndClient(target)
+	if err != nil {
+		context.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	if err := selected.restore(*client); err != nil {
+		context.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{
+		"id":            selected.id,
+		"alias":         node.Alias,
+		"channel_point": request.ChannelPoint,
+		"target":        target.Alias,
+		"created_at":    selected.createdAt,
+	})
+}
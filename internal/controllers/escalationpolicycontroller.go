@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+// EscalationPolicyRequest is the request body for the CreateEscalationPolicy endpoint. Contacts
+// are emails, primary contact first
+type EscalationPolicyRequest struct {
+	Name         string   `json:"name"`
+	DelayMinutes int      `json:"delay_minutes"`
+	Contacts     []string `json:"contacts"`
+}
+
+// DeleteEscalationPolicyRequest is the request body for the DeleteEscalationPolicy endpoint
+type DeleteEscalationPolicyRequest struct {
+	ID int64 `json:"id"`
+}
+
+// NodeEscalationPolicyRequest is the request body for the SetNodeEscalationPolicy endpoint. A
+// policy ID of 0 removes the node's policy
+type NodeEscalationPolicyRequest struct {
+	Alias    string `json:"alias"`
+	PolicyID int64  `json:"policy_id"`
+}
+
+// EscalationInvitationRequest is the request body for the AnswerEscalationInvitation endpoint
+type EscalationInvitationRequest struct {
+	PolicyID int64 `json:"policy_id"`
+	Accept   bool  `json:"accept"`
+}
+
+func escalationPolicyResponse(policy db.EscalationPolicy, contacts []db.EscalationContact) gin.H {
+	response := make([]gin.H, 0, len(contacts))
+	for _, contact := range contacts {
+		response = append(response, gin.H{
+			"email":    contact.Email,
+			"accepted": !contact.AcceptedAt.IsZero(),
+		})
+	}
+	return gin.H{
+		"id":            policy.ID,
+		"name":          policy.Name,
+		"delay_minutes": policy.DelayMinutes,
+		"contacts":      response,
+	}
+}
+
+// GetEscalationPolicies returns the escalation policies of the user
+func GetEscalationPolicies(context *gin.Context) {
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	policies, err := db.FindEscalationPoliciesByUserID(user.ID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	response := make([]gin.H, 0, len(policies))
+	for _, policy := range policies {
+		contacts, _ := db.FindEscalationInvitations(policy.ID)
+		response = append(response, escalationPolicyResponse(policy, contacts))
+	}
+	context.JSON(http.StatusOK, response)
+}
+
+// CreateEscalationPolicy creates an escalation policy that notifies the primary contact about a
+// critical alert, then each further contact every delay_minutes until the alert is acknowledged,
+// and finally all contacts. Contacts other than the user are invited by email and only notified
+// once they accept, so whether an email belongs to a user is never revealed
+func CreateEscalationPolicy(context *gin.Context) {
+	var request EscalationPolicyRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	if request.Name == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		context.Abort()
+		return
+	}
+	if request.DelayMinutes <= 0 {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "delay_minutes must be positive"})
+		context.Abort()
+		return
+	}
+	if len(request.Contacts) == 0 {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "at least one contact is required"})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	var contacts []db.EscalationContact
+	seen := make(map[string]bool)
+	for _, email := range request.Contacts {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "contact email is required"})
+			context.Abort()
+			return
+		}
+		if seen[email] {
+			context.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("contact %q is listed twice", email)})
+			context.Abort()
+			return
+		}
+		seen[email] = true
+
+		contact := db.EscalationContact{Email: email}
+		if email == strings.ToLower(user.Email) {
+			contact.UserID = user.ID
+			contact.AcceptedAt = time.Now().UTC()
+		}
+		contacts = append(contacts, contact)
+	}
+
+	policy := db.EscalationPolicy{
+		UserID:       user.ID,
+		Name:         request.Name,
+		DelayMinutes: request.DelayMinutes,
+	}
+	err := db.InsertEscalationPolicy(&policy, contacts)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusCreated, escalationPolicyResponse(policy, contacts))
+}
+
+// DeleteEscalationPolicy removes an escalation policy of the user. Its nodes are left without a
+// policy
+func DeleteEscalationPolicy(context *gin.Context) {
+	var request DeleteEscalationPolicyRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	err := db.DeleteEscalationPolicy(user.ID, request.ID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"id": request.ID})
+}
+
+// SetNodeEscalationPolicy sets the escalation policy followed for the critical alerts of the
+// user's node with the given alias
+func SetNodeEscalationPolicy(context *gin.Context) {
+	var request NodeEscalationPolicyRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	if request.PolicyID != 0 {
+		policy, err := db.FindEscalationPolicyByID(request.PolicyID)
+		if err != nil || policy.UserID != user.ID {
+			context.JSON(http.StatusNotFound, gin.H{"error": "escalation policy not found"})
+			context.Abort()
+			return
+		}
+	}
+
+	nodes, _ := db.FindNodesByUserID(user.ID)
+	for _, node := range nodes {
+		if !strings.EqualFold(node.Alias, request.Alias) {
+			continue
+		}
+		node.EscalationPolicyID = request.PolicyID
+		err := db.UpdateNodeEscalationPolicy(node)
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			context.Abort()
+			return
+		}
+		context.JSON(http.StatusOK, gin.H{"alias": node.Alias, "policy_id": node.EscalationPolicyID})
+		return
+	}
+	context.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+}
+
+// GetEscalationInvitations returns the escalation policies the user is invited to be a contact
+// of, and whether the user accepted
+func GetEscalationInvitations(context *gin.Context) {
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	invitations, err := db.FindEscalationInvitationsByEmail(user.Email)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	response := make([]gin.H, 0, len(invitations))
+	for _, invitation := range invitations {
+		policy, err := db.FindEscalationPolicyByID(invitation.PolicyID)
+		if err != nil {
+			continue
+		}
+		owner, _ := db.FindUserByID(policy.UserID)
+		response = append(response, gin.H{
+			"policy_id": policy.ID,
+			"name":      policy.Name,
+			"owner":     owner.Email,
+			"accepted":  !invitation.AcceptedAt.IsZero(),
+		})
+	}
+	context.JSON(http.StatusOK, response)
+}
+
+// AnswerEscalationInvitation accepts an invitation to be a contact of an escalation policy, after
+// which the user is notified about the critical alerts of its nodes and can acknowledge them, or
+// declines it, which also removes a contact that accepted earlier
+func AnswerEscalationInvitation(context *gin.Context) {
+	var request EscalationInvitationRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	invitations, _ := db.FindEscalationInvitationsByEmail(user.Email)
+	for _, invitation := range invitations {
+		if invitation.PolicyID != request.PolicyID {
+			continue
+		}
+		var err error
+		if request.Accept {
+			invitation.UserID = user.ID
+			invitation.AcceptedAt = time.Now().UTC()
+			err = db.AcceptEscalationInvitation(invitation)
+		} else {
+			err = db.DeleteEscalationContact(invitation.ID)
+		}
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			context.Abort()
+			return
+		}
+		context.JSON(http.StatusOK, gin.H{"policy_id": request.PolicyID, "accepted": request.Accept})
+		return
+	}
+	context.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+}
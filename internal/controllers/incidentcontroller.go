@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/incident"
+)
+
+// incidentLimit is how many of the most recent incidents GetIncidents returns
+const incidentLimit = 50
+
+// AcknowledgeIncidentRequest is the request body for the AcknowledgeIncident endpoint
+type AcknowledgeIncidentRequest struct {
+	ID int64 `json:"id"`
+}
+
+func incidentResponse(i db.Incident, alias string) gin.H {
+	response := gin.H{
+		"id":              i.ID,
+		"alias":           alias,
+		"check":           i.CheckName,
+		"severity":        i.Severity,
+		"message":         i.Message,
+		"state":           incident.State(i),
+		"opened_at":       i.OpenedAt,
+		"acknowledged_at": i.AcknowledgedAt,
+		"acknowledged_by": i.AcknowledgedBy,
+		"closed_at":       i.ClosedAt,
+	}
+
+	events, _ := db.FindIncidentEvents(i.ID)
+	timeline := make([]gin.H, 0, len(events))
+	for _, event := range events {
+		timeline = append(timeline, gin.H{
+			"created_at": event.CreatedAt,
+			"kind":       event.Kind,
+			"detail":     event.Detail,
+		})
+	}
+	response["timeline"] = timeline
+	return response
+}
+
+// GetIncidents returns the most recent incidents of the authenticated user's nodes, and of the
+// nodes whose escalation policy notifies the user, with their timelines
+func GetIncidents(context *gin.Context) {
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+	nodes, _ := incident.Nodes(user)
+	nodeIDs := make([]int64, 0, len(nodes))
+	aliases := make(map[int64]string)
+	for _, node := range nodes {
+		nodeIDs = append(nodeIDs, node.ID)
+		aliases[node.ID] = node.Alias
+	}
+
+	incidents, err := db.FindIncidentsByNodeIDs(nodeIDs, incidentLimit)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	response := make([]gin.H, 0, len(incidents))
+	for _, i := range incidents {
+		response = append(response, incidentResponse(i, aliases[i.NodeID]))
+	}
+	context.JSON(http.StatusOK, response)
+}
+
+// AcknowledgeIncident acknowledges an open incident of one of the authenticated user's nodes, or
+// of a node whose escalation policy notifies the user, which stops the escalation calls for it
+func AcknowledgeIncident(context *gin.Context) {
+	var request AcknowledgeIncidentRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+	i, err := db.FindIncidentByID(request.ID)
+	if err != nil {
+		context.JSON(http.StatusNotFound, gin.H{"error": "incident not found"})
+		context.Abort()
+		return
+	}
+	node, ok := incident.FindNode(user, i.NodeID)
+	if !ok {
+		context.JSON(http.StatusNotFound, gin.H{"error": "incident not found"})
+		context.Abort()
+		return
+	}
+
+	i, err = incident.Acknowledge(i, user.Email+" via api")
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, incidentResponse(i, node.Alias))
+}
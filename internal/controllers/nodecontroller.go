@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/util"
 )
 
 // NodeRequest is the request body for the GetNodes endpoint
@@ -44,7 +45,7 @@ func GetNodes(context *gin.Context) {
 }
 
 // CreateNode adds a node to the database. If a node with the same pubkey already
-// exists, an error is returned
+// exists, or its escalation policy belongs to another user, an error is returned
 func CreateNode(context *gin.Context) {
 	var node = db.Node{}
 	if err := context.ShouldBindJSON(&node); err != nil {
@@ -53,6 +54,26 @@ func CreateNode(context *gin.Context) {
 		return
 	}
 
+	if err := util.ValidatePubkey(node.Pubkey); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	if node.EscalationPolicyID != 0 {
+		policy, err := db.FindEscalationPolicyByID(node.EscalationPolicyID)
+		if err != nil || policy.UserID != user.ID {
+			context.JSON(http.StatusNotFound, gin.H{"error": "escalation policy not found"})
+			context.Abort()
+			return
+		}
+	}
+
 	exists, _ := db.FindNodeByPubkey(node.Pubkey)
 	if exists.Pubkey == node.Pubkey {
 		context.JSON(http.StatusBadRequest, gin.H{"error": "node already exists"})
@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/phone"
+)
+
+// PhoneRequest is the request body for the SetPhoneNumber endpoint
+type PhoneRequest struct {
+	PhoneNumber string `json:"phone_number"`
+}
+
+// ConfirmPhoneRequest is the request body for the ConfirmPhone endpoint
+type ConfirmPhoneRequest struct {
+	Code string `json:"code"`
+}
+
+// EscalationPhoneRequest is the request body for the SendEscalationCode and ConfirmEscalationPhone
+// endpoints. The code is only used to confirm
+type EscalationPhoneRequest struct {
+	PhoneNumber string `json:"phone_number"`
+	Code        string `json:"code"`
+}
+
+// SmsRequest is the request body for the SetSmsEnabled endpoint
+type SmsRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+func phoneResponse(user db.User) gin.H {
+	return gin.H{
+		"email":          user.Email,
+		"phone_number":   user.PhoneNumber,
+		"phone_verified": phone.Verified(user),
+		"sms_enabled":    user.SmsEnabled,
+	}
+}
+
+// SetPhoneNumber changes the phone number of the user. The number is normalized to E.164 and
+// must be verified again before sms can be enabled
+func SetPhoneNumber(context *gin.Context) {
+	var request PhoneRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	number, err := phone.Normalize(request.PhoneNumber)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	if number != user.PhoneNumber {
+		user.PhoneNumber = number
+		user.PhoneVerifiedAt = time.Time{}
+		user.SmsEnabled = false
+		err = db.UpdateUserPhone(user)
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			context.Abort()
+			return
+		}
+	}
+	context.JSON(http.StatusOK, phoneResponse(user))
+}
+
+// SendPhoneCode texts a one-time verification code to the user's phone number. Codes can be
+// sent once a minute and five times a day
+func SendPhoneCode(verifier *phone.Verifier) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		user, ok := authenticatedUser(context)
+		if !ok {
+			return
+		}
+		if _, err := phone.Normalize(user.PhoneNumber); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			context.Abort()
+			return
+		}
+
+		if err := verifier.Send(user); err != nil {
+			context.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			context.Abort()
+			return
+		}
+		context.JSON(http.StatusOK, gin.H{"phone_number": user.PhoneNumber, "expires_in": phone.CodeTTL.String()})
+	}
+}
+
+// ConfirmPhone verifies the user's phone number with the code sent to it
+func ConfirmPhone(context *gin.Context) {
+	var request ConfirmPhoneRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	user, err := phone.Confirm(user, request.Code)
+	if errors.Is(err, phone.ErrNumberTaken) {
+		context.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	if errors.Is(err, phone.ErrInvalidCode) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, phoneResponse(user))
+}
+
+// SetSmsEnabled turns sms alerts and reports on or off. Sms can only be turned on once the
+// user's phone number is verified
+func SetSmsEnabled(context *gin.Context) {
+	var request SmsRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+	if request.Enabled && !phone.Verified(user) {
+		context.JSON(http.StatusForbidden, gin.H{"error": "verify your phone number before enabling sms"})
+		context.Abort()
+		return
+	}
+
+	user.SmsEnabled = request.Enabled
+	err := db.UpdateUserSmsEnabled(user)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, phoneResponse(user))
+}
+
+// escalationNumber finds a number in the escalation phone numbers of the user
+func escalationNumber(user db.User, number string) (string, bool) {
+	normalized, err := phone.Normalize(number)
+	if err != nil {
+		return "", false
+	}
+	for _, escalation := range strings.Split(user.EscalationPhoneNumbers, ",") {
+		if strings.TrimSpace(escalation) == normalized {
+			return normalized, true
+		}
+	}
+	return "", false
+}
+
+// SendEscalationCode texts a one-time verification code to one of the user's escalation phone
+// numbers, which is only called once it is confirmed. The same rate limits apply as for the
+// user's own number
+func SendEscalationCode(verifier *phone.Verifier) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request EscalationPhoneRequest
+		if err := context.ShouldBindJSON(&request); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			context.Abort()
+			return
+		}
+
+		user, ok := authenticatedUser(context)
+		if !ok {
+			return
+		}
+		number, found := escalationNumber(user, request.PhoneNumber)
+		if !found {
+			context.JSON(http.StatusNotFound, gin.H{"error": "not one of your escalation phone numbers"})
+			context.Abort()
+			return
+		}
+
+		if err := verifier.SendTo(user, number); err != nil {
+			context.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			context.Abort()
+			return
+		}
+		context.JSON(http.StatusOK, gin.H{"phone_number": number, "expires_in": phone.CodeTTL.String()})
+	}
+}
+
+// ConfirmEscalationPhone verifies one of the user's escalation phone numbers with the code sent
+// to it
+func ConfirmEscalationPhone(context *gin.Context) {
+	var request EscalationPhoneRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+	number, found := escalationNumber(user, request.PhoneNumber)
+	if !found {
+		context.JSON(http.StatusNotFound, gin.H{"error": "not one of your escalation phone numbers"})
+		context.Abort()
+		return
+	}
+
+	err := phone.ConfirmNumber(user, number, request.Code)
+	if errors.Is(err, phone.ErrInvalidCode) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"phone_number": number, "verified": true})
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/silence"
+)
+
+// SilenceRequest is the request body for the CreateSilence endpoint. An empty alias or check
+// silences all nodes or checks
+type SilenceRequest struct {
+	Alias       string    `json:"alias"`
+	Check       string    `json:"check"`
+	Kind        string    `json:"kind"`
+	Comment     string    `json:"comment"`
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	Recurrence  string    `json:"recurrence"`
+	RepeatUntil time.Time `json:"repeat_until"`
+}
+
+// DeleteSilenceRequest is the request body for the DeleteSilence endpoint
+type DeleteSilenceRequest struct {
+	ID int64 `json:"id"`
+}
+
+func silenceResponse(s db.Silence, aliases map[int64]string) gin.H {
+	return gin.H{
+		"id":           s.ID,
+		"alias":        aliases[s.NodeID],
+		"check":        s.CheckName,
+		"kind":         s.Kind,
+		"comment":      s.Comment,
+		"starts_at":    s.StartsAt,
+		"ends_at":      s.EndsAt,
+		"recurrence":   s.Recurrence,
+		"repeat_until": s.RepeatUntil,
+		"active":       silence.Active(s, time.Now().UTC()),
+	}
+}
+
+// GetSilences returns the maintenance windows and silences of the authenticated user
+func GetSilences(context *gin.Context) {
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+	nodes, _ := db.FindNodesByUserID(user.ID)
+	aliases := make(map[int64]string)
+	for _, node := range nodes {
+		aliases[node.ID] = node.Alias
+	}
+
+	silences, err := db.FindSilencesByUserID(user.ID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	response := make([]gin.H, 0, len(silences))
+	for _, s := range silences {
+		response = append(response, silenceResponse(s, aliases))
+	}
+	context.JSON(http.StatusOK, response)
+}
+
+// CreateSilence schedules a maintenance window or ad-hoc silence for the authenticated user's
+// node with the given alias, or all of the user's nodes. Alerts matching it are recorded but not sent, and a
+// summary of them is sent when it ends
+func CreateSilence(context *gin.Context) {
+	var request SilenceRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	s := db.Silence{
+		UserID:      user.ID,
+		CheckName:   request.Check,
+		Kind:        request.Kind,
+		Comment:     request.Comment,
+		StartsAt:    request.StartsAt.UTC(),
+		EndsAt:      request.EndsAt.UTC(),
+		Recurrence:  request.Recurrence,
+		RepeatUntil: request.RepeatUntil.UTC(),
+	}
+	if err := silence.Validate(s); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	aliases := make(map[int64]string)
+	if request.Alias != "" {
+		nodes, _ := db.FindNodesByUserID(user.ID)
+		for _, node := range nodes {
+			if strings.EqualFold(node.Alias, request.Alias) {
+				s.NodeID = node.ID
+				aliases[node.ID] = node.Alias
+			}
+		}
+		if s.NodeID == 0 {
+			context.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+			context.Abort()
+			return
+		}
+	}
+
+	if err := db.InsertSilence(&s); err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusCreated, silenceResponse(s, aliases))
+}
+
+// DeleteSilence ends a maintenance window or silence of the authenticated user now. It is kept
+// until its summary is sent, so the alerts it suppressed are not lost
+func DeleteSilence(context *gin.Context) {
+	var request DeleteSilenceRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	silences, err := db.FindSilencesByUserID(user.ID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	for _, s := range silences {
+		if s.ID != request.ID {
+			continue
+		}
+		s = silence.End(s, time.Now().UTC())
+		if err := db.UpdateSilenceWindow(s); err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			context.Abort()
+			return
+		}
+		aliases := make(map[int64]string)
+		if s.NodeID != 0 {
+			if node, err := db.FindNodeByID(s.NodeID); err == nil {
+				aliases[node.ID] = node.Alias
+			}
+		}
+		context.JSON(http.StatusOK, silenceResponse(s, aliases))
+		return
+	}
+	context.JSON(http.StatusNotFound, gin.H{"error": "silence not found"})
+	context.Abort()
+}
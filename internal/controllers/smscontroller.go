@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/outbox"
+	"github.com/mvpratt/nodewatcher/internal/sms"
+	"github.com/twilio/twilio-go/client"
+)
+
+// twilioParams returns the form parameters of a Twilio webhook request after validating the
+// signature Twilio computes over webhookURL, the public URL of the endpoint. The request is
+// aborted if the signature is invalid
+func twilioParams(context *gin.Context, validator client.RequestValidator, webhookURL string) (map[string]string, bool) {
+	if err := context.Request.ParseForm(); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return nil, false
+	}
+	params := make(map[string]string)
+	for key := range context.Request.PostForm {
+		params[key] = context.Request.PostForm.Get(key)
+	}
+	if !validator.Validate(webhookURL, params, context.GetHeader("X-Twilio-Signature")) {
+		context.JSON(http.StatusForbidden, gin.H{"error": "invalid twilio signature"})
+		context.Abort()
+		return nil, false
+	}
+	return params, true
+}
+
+// ReceiveSMS returns the handler for the Twilio inbound sms webhook, validated with the
+// account's auth token. Only texts from a verified phone number are answered, apart from START
+// which verifies a registered number
+func ReceiveSMS(authToken string, webhookURL string) gin.HandlerFunc {
+	validator := client.NewRequestValidator(authToken)
+
+	return func(context *gin.Context) {
+		params, ok := twilioParams(context, validator, webhookURL)
+		if !ok {
+			return
+		}
+
+		reply := ""
+		user, err := db.FindUserByPhoneNumber(params["From"])
+		if err == nil {
+			reply = sms.Reply(user, params["Body"])
+		} else if errors.Is(err, sql.ErrNoRows) {
+			reply = sms.ReplyUnverified(params["From"], params["Body"])
+		}
+		context.Data(http.StatusOK, "text/xml", []byte(sms.TwiML(reply)))
+	}
+}
+
+// SMSStatus returns the handler for Twilio message status callbacks, validated with the
+// account's auth token. Final delivery statuses are recorded in the notification outbox
+func SMSStatus(authToken string, callbackURL string) gin.HandlerFunc {
+	validator := client.NewRequestValidator(authToken)
+
+	return func(context *gin.Context) {
+		params, ok := twilioParams(context, validator, callbackURL)
+		if !ok {
+			return
+		}
+
+		status := params["MessageStatus"]
+		switch status {
+		case outbox.StatusDelivered, outbox.StatusFailed, outbox.StatusUndelivered:
+		default:
+			context.Status(http.StatusNoContent)
+			return
+		}
+
+		lastError := ""
+		if code := params["ErrorCode"]; code != "" {
+			lastError = "twilio error " + code
+		}
+		err := db.UpdateNotificationStatus(params["MessageSid"], status, lastError)
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			context.Abort()
+			return
+		}
+		context.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/templates"
+)
+
+// TemplateRequest is the request body for the SetTemplate and PreviewTemplate endpoints
+type TemplateRequest struct {
+	Channel string `json:"channel"`
+	Event   string `json:"event"`
+	Body    string `json:"body"`
+	Alias   string `json:"alias"`
+}
+
+// GetTemplates returns the notification templates of the authenticated user
+func GetTemplates(context *gin.Context) {
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	userTemplates, err := db.FindNotificationTemplates(user.ID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	response := make([]gin.H, 0, len(userTemplates))
+	for _, t := range userTemplates {
+		response = append(response, gin.H{"channel": t.Channel, "event": t.Event, "body": t.Body, "updated_at": t.UpdatedAt})
+	}
+	context.JSON(http.StatusOK, response)
+}
+
+// SetTemplate validates and saves the authenticated user's text/template for alerts of an event
+// (report, trigger or resolve) sent over a channel (sms, telegram, pagerduty, slack, discord,
+// nostr or any). An empty body removes the template
+func SetTemplate(context *gin.Context) {
+	var request TemplateRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	if request.Body != "" {
+		if err := templates.Validate(request.Channel, request.Event, request.Body); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			context.Abort()
+			return
+		}
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	var err error
+	if request.Body == "" {
+		err = db.DeleteNotificationTemplate(user.ID, request.Channel, request.Event)
+	} else {
+		err = db.UpsertNotificationTemplate(&db.NotificationTemplate{
+			UserID:    user.ID,
+			Channel:   request.Channel,
+			Event:     request.Event,
+			Body:      request.Body,
+			UpdatedAt: time.Now().UTC(),
+		})
+	}
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"channel": request.Channel, "event": request.Event, "body": request.Body})
+}
+
+// PreviewTemplate renders a template against the latest snapshot and health checks of one of
+// the authenticated user's nodes, the node with the given alias or else the first
+func PreviewTemplate(context *gin.Context) {
+	var request TemplateRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	if err := templates.Validate(request.Channel, request.Event, request.Body); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+	nodes, err := db.FindNodesByUserID(user.ID)
+	if err != nil || len(nodes) == 0 {
+		context.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+		context.Abort()
+		return
+	}
+	node := nodes[0]
+	for _, n := range nodes {
+		if strings.EqualFold(n.Alias, request.Alias) {
+			node = n
+		}
+	}
+
+	text, err := templates.Preview(node, request.Event, request.Body)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"alias": node.Alias, "text": text})
+}
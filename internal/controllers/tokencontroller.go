@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mvpratt/nodewatcher/internal/auth"
 	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/middlewares"
 )
 
 // TokenRequest is the request body for the GenerateToken endpoint
@@ -49,3 +50,21 @@ func GenerateToken(context *gin.Context) {
 	}
 	context.JSON(http.StatusOK, gin.H{"token": tokenString})
 }
+
+// authenticatedUser returns the user the JWT of a secured request was issued to. Handlers never
+// take the user from the request body, so a user can only act on their own account
+func authenticatedUser(context *gin.Context) (db.User, bool) {
+	claims, ok := middlewares.Claims(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "request does not contain an access token"})
+		context.Abort()
+		return db.User{}, false
+	}
+	user, err := db.FindUserByEmail(claims.Email)
+	if err != nil {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		context.Abort()
+		return db.User{}, false
+	}
+	return user, true
+}
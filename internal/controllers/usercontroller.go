@@ -1,21 +1,59 @@
 package controllers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/nostr"
+	"github.com/mvpratt/nodewatcher/internal/phone"
+	"github.com/mvpratt/nodewatcher/internal/schedule"
 )
 
-// RegisterUser adds a user to the database.
+// RegisterUserRequest is the request body for the RegisterUser endpoint. Everything else about a
+// user is set through the secured endpoints once they have a token
+type RegisterUserRequest struct {
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	PhoneNumber string `json:"phone_number"`
+	Timezone    string `json:"timezone"`
+}
+
+// RegisterUser adds a user to the database. The phone number is normalized to E.164 and sms
+// stays disabled until the number is verified
 func RegisterUser(context *gin.Context) {
-	var user db.User
-	if err := context.ShouldBindJSON(&user); err != nil {
+	var request RegisterUserRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
 		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		context.Abort()
 		return
 	}
-	if err := user.HashPassword(user.Password); err != nil {
+
+	// sms can only be enabled once the phone number is verified
+	user := db.User{Email: request.Email}
+	if request.PhoneNumber != "" {
+		number, err := phone.Normalize(request.PhoneNumber)
+		if err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			context.Abort()
+			return
+		}
+		user.PhoneNumber = number
+	}
+	if request.Timezone != "" {
+		if _, err := time.LoadLocation(request.Timezone); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown timezone %q", request.Timezone)})
+			context.Abort()
+			return
+		}
+		user.Timezone = request.Timezone
+	}
+	if err := user.HashPassword(request.Password); err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		context.Abort()
 		return
@@ -28,7 +66,6 @@ func RegisterUser(context *gin.Context) {
 		return
 	}
 
-	user.ID = 0 // set to 0 so the db will auto-increment
 	err := db.InsertUser(&user)
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -37,3 +74,260 @@ func RegisterUser(context *gin.Context) {
 	}
 	context.JSON(http.StatusCreated, gin.H{"userId": user.ID, "email": user.Email, "password": user.Password})
 }
+
+// LinkTelegram generates a one-time code the authenticated user sends to the telegram bot to
+// link their chat
+func LinkTelegram(context *gin.Context) {
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	code := make([]byte, 8)
+	if _, err := rand.Read(code); err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	user.TelegramLinkCode = hex.EncodeToString(code)
+
+	if err := db.UpdateUserTelegram(user); err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{
+		"code":         user.TelegramLinkCode,
+		"instructions": "send \"/link " + user.TelegramLinkCode + "\" to the nodewatcher telegram bot",
+	})
+}
+
+// PagerDutyRequest is the request body for the SetPagerDutyRoutingKey endpoint
+type PagerDutyRequest struct {
+	RoutingKey string `json:"routing_key"`
+	NodePubkey string `json:"node_pubkey"`
+}
+
+// SetPagerDutyRoutingKey sets the PagerDuty routing key of the authenticated user, or of one of
+// the user's nodes if a node pubkey is given
+func SetPagerDutyRoutingKey(context *gin.Context) {
+	var request PagerDutyRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	var err error
+	if request.NodePubkey == "" {
+		user.PagerDutyRoutingKey = request.RoutingKey
+		err = db.UpdateUserPagerDutyRoutingKey(user)
+	} else {
+		var node db.Node
+		node, err = db.FindNodeByPubkey(request.NodePubkey)
+		if err != nil || node.UserID != user.ID {
+			context.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+			context.Abort()
+			return
+		}
+		node.PagerDutyRoutingKey = request.RoutingKey
+		err = db.UpdateNodePagerDutyRoutingKey(node)
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"email": user.Email, "node_pubkey": request.NodePubkey})
+}
+
+// WebhooksRequest is the request body for the SetWebhooks endpoint
+type WebhooksRequest struct {
+	SlackWebhookURL   string `json:"slack_webhook_url"`
+	DiscordWebhookURL string `json:"discord_webhook_url"`
+}
+
+// SetWebhooks sets the Slack and Discord incoming webhooks the authenticated user's alerts are
+// posted to. An empty URL disables the webhook
+func SetWebhooks(context *gin.Context) {
+	var request WebhooksRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	for _, webhook := range []string{request.SlackWebhookURL, request.DiscordWebhookURL} {
+		if webhook != "" && !strings.HasPrefix(webhook, "https://") {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "webhook URLs must use https"})
+			context.Abort()
+			return
+		}
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	user.SlackWebhookURL = request.SlackWebhookURL
+	user.DiscordWebhookURL = request.DiscordWebhookURL
+	if err := db.UpdateUserWebhooks(user); err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{
+		"email":               user.Email,
+		"slack_webhook_url":   user.SlackWebhookURL,
+		"discord_webhook_url": user.DiscordWebhookURL,
+	})
+}
+
+// NostrRequest is the request body for the SetNostr endpoint
+type NostrRequest struct {
+	Pubkey string `json:"pubkey"`
+	NIP    int    `json:"nip"`
+}
+
+// SetNostr sets the npub the authenticated user's alerts are sent to as encrypted nostr direct
+// messages, and whether they are encrypted with NIP-04 or NIP-44 (default). An empty pubkey
+// disables nostr alerts
+func SetNostr(context *gin.Context) {
+	var request NostrRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	if request.NIP == 0 {
+		request.NIP = nostr.NIP44
+	}
+	if request.NIP != nostr.NIP04 && request.NIP != nostr.NIP44 {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "nip must be 4 or 44"})
+		context.Abort()
+		return
+	}
+	if request.Pubkey != "" {
+		if _, err := nostr.DecodePubkey(request.Pubkey); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			context.Abort()
+			return
+		}
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	user.NostrPubkey = request.Pubkey
+	user.NostrNIP = request.NIP
+	if err := db.UpdateUserNostr(user); err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"email": user.Email, "pubkey": user.NostrPubkey, "nip": user.NostrNIP})
+}
+
+// EscalationRequest is the request body for the SetEscalation endpoint
+type EscalationRequest struct {
+	DelayMinutes int      `json:"delay_minutes"`
+	PhoneNumbers []string `json:"phone_numbers"`
+}
+
+// SetEscalation sets how long a critical alert may go unacknowledged before the authenticated
+// user, and then each of the escalation phone numbers in turn, is called. A delay of 0 disables
+// voice calls
+func SetEscalation(context *gin.Context) {
+	var request EscalationRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	if request.DelayMinutes < 0 {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "delay_minutes must not be negative"})
+		context.Abort()
+		return
+	}
+	for i, number := range request.PhoneNumbers {
+		normalized, err := phone.Normalize(number)
+		if err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			context.Abort()
+			return
+		}
+		request.PhoneNumbers[i] = normalized
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	user.EscalationDelayMinutes = request.DelayMinutes
+	user.EscalationPhoneNumbers = strings.Join(request.PhoneNumbers, ",")
+	if err := db.UpdateUserEscalation(user); err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"email": user.Email, "delay_minutes": user.EscalationDelayMinutes, "phone_numbers": request.PhoneNumbers})
+}
+
+// ScheduleRequest is the request body for the SetSchedule endpoint
+type ScheduleRequest struct {
+	Timezone    string   `json:"timezone"`
+	ReportTimes []string `json:"report_times"`
+	Weekdays    []string `json:"weekdays"`
+	QuietStart  string   `json:"quiet_start"`
+	QuietEnd    string   `json:"quiet_end"`
+}
+
+// SetSchedule sets the IANA timezone of the authenticated user, the local times of day ("08:00")
+// and weekdays ("mon") status reports are sent and the quiet hours during which only critical
+// alerts are sent
+func SetSchedule(context *gin.Context) {
+	var request ScheduleRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	reportTimes := strings.Join(request.ReportTimes, ",")
+	weekdays := strings.Join(request.Weekdays, ",")
+	_, err := schedule.Parse(request.Timezone, reportTimes, weekdays, request.QuietStart, request.QuietEnd)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+
+	user, ok := authenticatedUser(context)
+	if !ok {
+		return
+	}
+
+	user.Timezone = request.Timezone
+	user.ReportTimes = reportTimes
+	user.ReportWeekdays = weekdays
+	user.QuietStart = request.QuietStart
+	user.QuietEnd = request.QuietEnd
+	if err := db.UpdateUserSchedule(user); err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.Abort()
+		return
+	}
+	context.JSON(http.StatusOK, request)
+}
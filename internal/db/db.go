@@ -19,9 +19,12 @@ import (
 // Instance is the global database instance
 var Instance *bun.DB
 
+// MigrationTimeout is how long RunMigrations may take. Some migrations rewrite every stored backup
+const MigrationTimeout = 30 * time.Minute
+
 // RunMigrations gets all *.sql files from /migrations and runs them to create tables and constraints
 func RunMigrations() error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), MigrationTimeout)
 	defer cancel()
 
 	migrator := migrate.NewMigrator(Instance, migrations.Migrations)
@@ -0,0 +1,415 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+// Secrets stored in the db (node macaroons and TLS certs, and channel backups) are
+// encrypted with envelope encryption: each row is encrypted with its own random data key using
+// AES-256-GCM, and the data key is stored next to it, wrapped with a master key. Rows record the
+// id of the master key so master keys can be rotated with RotateKeys.
+
+// KeyProvider wraps and unwraps data keys with master keys, e.g. from a key file or a KMS
+type KeyProvider interface {
+	// CurrentKeyID is the id of the master key that new data keys are wrapped with
+	CurrentKeyID() string
+	// WrapKey encrypts a data key with the current master key
+	WrapKey(dataKey []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key with the master key it was wrapped with
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Keys is the provider of the master keys. If it is nil, secrets are stored unencrypted
+var Keys KeyProvider
+
+// ErrNoKeys is returned when an encrypted row is read without a master key provider
+var ErrNoKeys = errors.New("row is encrypted but no master key is configured")
+
+// FileKeys are master keys loaded from a key file
+type FileKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+// LoadKeyFile loads master keys from a file with one "<key id>:<base64 32 byte key>" per line.
+// The first key is the current key, later keys are only used to decrypt rows that have not been
+// rotated yet. Empty lines and lines starting with # are ignored
+func LoadKeyFile(path string) (*FileKeys, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys := &FileKeys{keys: make(map[string][]byte)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(line, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid key file line, expected <key id>:<base64 key>")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("master key %s must be 32 base64 encoded bytes", id)
+		}
+		if _, ok := keys.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate master key %s", id)
+		}
+		if keys.current == "" {
+			keys.current = id
+		}
+		keys.keys[id] = key
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if keys.current == "" {
+		return nil, fmt.Errorf("no master keys in %s", path)
+	}
+	return keys, nil
+}
+
+// CurrentKeyID is the id of the first key in the key file
+func (k *FileKeys) CurrentKeyID() string {
+	return k.current
+}
+
+// WrapKey encrypts a data key with the current master key
+func (k *FileKeys) WrapKey(dataKey []byte) ([]byte, error) {
+	return seal(k.keys[k.current], dataKey, []byte(k.current))
+}
+
+// UnwrapKey decrypts a data key with the master key it was wrapped with
+func (k *FileKeys) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %s", keyID)
+	}
+	return open(key, wrapped, []byte(keyID))
+}
+
+// LoadMasterKeys configures the master keys from a key file. Nothing is encrypted if path is empty
+func LoadMasterKeys(path string) error {
+	if path == "" {
+		return nil
+	}
+	keys, err := LoadKeyFile(path)
+	if err != nil {
+		return err
+	}
+	Keys = keys
+	return nil
+}
+
+// seal encrypts plaintext with AES-GCM, returning the nonce followed by the ciphertext
+func seal(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts the output of seal
+func open(key []byte, sealed []byte, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additionalData)
+}
+
+// envelope holds the data key of a row while its fields are encrypted or decrypted
+type envelope struct {
+	dataKey []byte
+}
+
+// newEnvelope creates a data key and wraps it with the current master key
+func newEnvelope(keys KeyProvider) (envelope, string, string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return envelope{}, "", "", err
+	}
+	wrapped, err := keys.WrapKey(dataKey)
+	if err != nil {
+		return envelope{}, "", "", err
+	}
+	return envelope{dataKey: dataKey}, keys.CurrentKeyID(), base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+// openEnvelope unwraps the data key of a row
+func openEnvelope(keys KeyProvider, keyID string, wrapped string) (envelope, error) {
+	if keys == nil {
+		return envelope{}, ErrNoKeys
+	}
+	decoded, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return envelope{}, err
+	}
+	dataKey, err := keys.UnwrapKey(keyID, decoded)
+	if err != nil {
+		return envelope{}, err
+	}
+	return envelope{dataKey: dataKey}, nil
+}
+
+// encrypt encrypts a field, binding it to its column so fields can't be swapped
+func (e envelope) encrypt(column string, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	sealed, err := seal(e.dataKey, []byte(value), []byte(column))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt decrypts a field encrypted by encrypt
+func (e envelope) decrypt(column string, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(e.dataKey, sealed, []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt %s: %w", column, err)
+	}
+	return string(plaintext), nil
+}
+
+// encryptNode returns a copy of a node with its macaroon and TLS cert encrypted with the current
+// master key, or unencrypted if there is none
+func encryptNode(node Node) (Node, error) {
+	node.KeyID, node.DataKey = "", ""
+	if Keys == nil {
+		return node, nil
+	}
+	env, keyID, dataKey, err := newEnvelope(Keys)
+	if err != nil {
+		return node, err
+	}
+	node.KeyID, node.DataKey = keyID, dataKey
+	if node.Macaroon, err = env.encrypt("nodes.macaroon", node.Macaroon); err != nil {
+		return node, err
+	}
+	if node.TLSCert, err = env.encrypt("nodes.tls_cert", node.TLSCert); err != nil {
+		return node, err
+	}
+	return node, nil
+}
+
+var _ bun.AfterScanRowHook = (*Node)(nil)
+
+// AfterScanRow decrypts the macaroon and TLS cert of a node read from the db
+func (node *Node) AfterScanRow(ctx context.Context) error {
+	if node.KeyID == "" {
+		return nil
+	}
+	env, err := openEnvelope(Keys, node.KeyID, node.DataKey)
+	if err != nil {
+		return err
+	}
+	if node.Macaroon, err = env.decrypt("nodes.macaroon", node.Macaroon); err != nil {
+		return err
+	}
+	node.TLSCert, err = env.decrypt("nodes.tls_cert", node.TLSCert)
+	return err
+}
+
+// encryptMultiChannelBackup returns a copy of a backup encrypted with the current master key, or
+// unencrypted if there is none
+func encryptMultiChannelBackup(backup MultiChannelBackup) (MultiChannelBackup, error) {
+	backup.KeyID, backup.DataKey = "", ""
+	if Keys == nil {
+		return backup, nil
+	}
+	env, keyID, dataKey, err := newEnvelope(Keys)
+	if err != nil {
+		return backup, err
+	}
+	backup.KeyID, backup.DataKey = keyID, dataKey
+	backup.Backup, err = env.encrypt("multi_channel_backups.backup", backup.Backup)
+	return backup, err
+}
+
+var _ bun.AfterScanRowHook = (*MultiChannelBackup)(nil)
+
+// AfterScanRow decrypts a multi-channel backup read from the db
+func (backup *MultiChannelBackup) AfterScanRow(ctx context.Context) error {
+	if backup.KeyID == "" {
+		return nil
+	}
+	env, err := openEnvelope(Keys, backup.KeyID, backup.DataKey)
+	if err != nil {
+		return err
+	}
+	backup.Backup, err = env.decrypt("multi_channel_backups.backup", backup.Backup)
+	return err
+}
+
+// encryptChannelBackup returns a copy of a single channel backup encrypted with the current master
+// key, or unencrypted if there is none
+func encryptChannelBackup(backup ChannelBackup) (ChannelBackup, error) {
+	backup.KeyID, backup.DataKey = "", ""
+	if Keys == nil {
+		return backup, nil
+	}
+	env, keyID, dataKey, err := newEnvelope(Keys)
+	if err != nil {
+		return backup, err
+	}
+	backup.KeyID, backup.DataKey = keyID, dataKey
+	backup.Backup, err = env.encrypt("channel_backups.backup", backup.Backup)
+	return backup, err
+}
+
+var _ bun.AfterScanRowHook = (*ChannelBackup)(nil)
+
+// AfterScanRow decrypts a single channel backup read from the db
+func (backup *ChannelBackup) AfterScanRow(ctx context.Context) error {
+	if backup.KeyID == "" {
+		return nil
+	}
+	env, err := openEnvelope(Keys, backup.KeyID, backup.DataKey)
+	if err != nil {
+		return err
+	}
+	backup.Backup, err = env.decrypt("channel_backups.backup", backup.Backup)
+	return err
+}
+
+// rotateBatchSize is how many rows RotateKeys re-encrypts per query
+const rotateBatchSize = 100
+
+// RotateKeys re-encrypts all node secrets and channel backups that are unencrypted or
+// encrypted with an old master key with the current master key. The old master keys must still
+// be configured. Returns the number of rows re-encrypted
+func RotateKeys(ctx context.Context) (int, error) {
+	if Keys == nil {
+		return 0, errors.New("no master key configured")
+	}
+	current := Keys.CurrentKeyID()
+
+	var nodes []Node
+	err := Instance.NewSelect().
+		Model(&nodes).
+		Where("key_id IS DISTINCT FROM ?", current).
+		Scan(ctx)
+	if err != nil {
+		return 0, err
+	}
+	rotated := 0
+	for _, node := range nodes {
+		encrypted, err := encryptNode(node)
+		if err != nil {
+			return rotated, err
+		}
+		_, err = Instance.NewUpdate().
+			Model(&encrypted).
+			Column("macaroon", "tls_cert", "key_id", "data_key").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+
+	for {
+		var backups []MultiChannelBackup
+		err := Instance.NewSelect().
+			Model(&backups).
+			Column("id", "backup", "key_id", "data_key").
+			Where("key_id IS DISTINCT FROM ?", current).
+			OrderExpr("id ASC").
+			Limit(rotateBatchSize).
+			Scan(ctx)
+		if err != nil {
+			return rotated, err
+		}
+		if len(backups) == 0 {
+			break
+		}
+		for _, backup := range backups {
+			encrypted, err := encryptMultiChannelBackup(backup)
+			if err != nil {
+				return rotated, err
+			}
+			_, err = Instance.NewUpdate().
+				Model(&encrypted).
+				Column("backup", "key_id", "data_key").
+				WherePK().
+				Exec(ctx)
+			if err != nil {
+				return rotated, err
+			}
+			rotated++
+		}
+	}
+
+	for {
+		var backups []ChannelBackup
+		err := Instance.NewSelect().
+			Model(&backups).
+			Column("id", "backup", "key_id", "data_key").
+			Where("key_id IS DISTINCT FROM ?", current).
+			OrderExpr("id ASC").
+			Limit(rotateBatchSize).
+			Scan(ctx)
+		if err != nil {
+			return rotated, err
+		}
+		if len(backups) == 0 {
+			return rotated, nil
+		}
+		for _, backup := range backups {
+			encrypted, err := encryptChannelBackup(backup)
+			if err != nil {
+				return rotated, err
+			}
+			_, err = Instance.NewUpdate().
+				Model(&encrypted).
+				Column("backup", "key_id", "data_key").
+				WherePK().
+				Exec(ctx)
+			if err != nil {
+				return rotated, err
+			}
+			rotated++
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptNode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.keys")
+	contents := "# rotated in march\n" +
+		"new:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=\n" +
+		"old:ICEiIyQlJicoKSorLC0uLzAxMjM0NTY3ODk6Ozw9Pj8=\n"
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.CurrentKeyID() != "new" {
+		t.Errorf("expected the first key to be current, got %s", keys.CurrentKeyID())
+	}
+
+	Keys = keys
+	defer func() { Keys = nil }()
+
+	node := Node{Alias: "alice", Macaroon: "0201036c6e64", TLSCert: "-----BEGIN CERTIFICATE-----"}
+	encrypted, err := encryptNode(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted.KeyID != "new" || encrypted.Macaroon == node.Macaroon || encrypted.TLSCert == node.TLSCert {
+		t.Fatalf("expected secrets encrypted with the current key, got %+v", encrypted)
+	}
+
+	decrypted := encrypted
+	if err := decrypted.AfterScanRow(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if decrypted.Macaroon != node.Macaroon || decrypted.TLSCert != node.TLSCert {
+		t.Errorf("got %+v, want %+v", decrypted, node)
+	}
+
+	swapped := encrypted
+	swapped.Macaroon, swapped.TLSCert = encrypted.TLSCert, encrypted.Macaroon
+	if err := swapped.AfterScanRow(context.Background()); err == nil {
+		t.Error("expected an error when encrypted columns are swapped")
+	}
+
+	Keys = nil
+	if err := encrypted.AfterScanRow(context.Background()); err != ErrNoKeys {
+		t.Errorf("expected ErrNoKeys without a master key, got %v", err)
+	}
+}
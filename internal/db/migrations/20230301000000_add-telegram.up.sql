@@ -0,0 +1,7 @@
+ALTER TABLE "users" ADD COLUMN "telegram_chat_id" int8;
+
+--migration:split
+ALTER TABLE "users" ADD COLUMN "telegram_link_code" varchar;
+
+--migration:split
+ALTER TABLE "users" ADD COLUMN "muted_until" timestamp;
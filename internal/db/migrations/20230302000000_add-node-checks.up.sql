@@ -0,0 +1,24 @@
+CREATE SEQUENCE IF NOT EXISTS "node_checks_id_seq";
+
+--migration:split
+CREATE TABLE "public"."node_checks" (
+    "id" int4 NOT NULL DEFAULT nextval('"node_checks_id_seq"'::regclass),
+    "node_id" int4,
+    "name" varchar,
+    "failing" boolean,
+    "message" varchar,
+    "changed_at" timestamp,
+    PRIMARY KEY ("id")
+);
+
+--migration:split
+ALTER TABLE "node_checks" ADD CONSTRAINT fk_node_check_to_node FOREIGN KEY ("node_id") REFERENCES "nodes" ("id");
+
+--migration:split
+ALTER TABLE "node_checks" ADD CONSTRAINT unique_node_check UNIQUE ("node_id", "name");
+
+--migration:split
+ALTER TABLE "nodes" ADD COLUMN "pagerduty_routing_key" varchar;
+
+--migration:split
+ALTER TABLE "users" ADD COLUMN "pagerduty_routing_key" varchar;
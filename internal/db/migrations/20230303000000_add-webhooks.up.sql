@@ -0,0 +1,4 @@
+ALTER TABLE "users" ADD COLUMN "slack_webhook_url" varchar;
+
+--migration:split
+ALTER TABLE "users" ADD COLUMN "discord_webhook_url" varchar;
@@ -0,0 +1,15 @@
+CREATE SEQUENCE IF NOT EXISTS "nostr_keys_id_seq";
+
+--migration:split
+CREATE TABLE "public"."nostr_keys" (
+    "id" int4 NOT NULL DEFAULT nextval('"nostr_keys_id_seq"'::regclass),
+    "created_at" timestamp,
+    "encrypted_key" varchar,
+    PRIMARY KEY ("id")
+);
+
+--migration:split
+ALTER TABLE "users" ADD COLUMN "nostr_pubkey" varchar;
+
+--migration:split
+ALTER TABLE "users" ADD COLUMN "nostr_nip" int4;
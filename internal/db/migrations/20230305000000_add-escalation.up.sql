@@ -0,0 +1,13 @@
+ALTER TABLE "node_checks" ADD COLUMN "severity" varchar;
+
+--migration:split
+ALTER TABLE "node_checks" ADD COLUMN "acknowledged_at" timestamp;
+
+--migration:split
+ALTER TABLE "node_checks" ADD COLUMN "escalation_step" int4 NOT NULL DEFAULT 0;
+
+--migration:split
+ALTER TABLE "users" ADD COLUMN "escalation_delay_minutes" int4;
+
+--migration:split
+ALTER TABLE "users" ADD COLUMN "escalation_phone_numbers" varchar;
@@ -0,0 +1,34 @@
+CREATE SEQUENCE IF NOT EXISTS "notifications_id_seq";
+
+--migration:split
+CREATE TABLE "public"."notifications" (
+    "id" int4 NOT NULL DEFAULT nextval('"notifications_id_seq"'::regclass),
+    "created_at" timestamp NOT NULL DEFAULT current_timestamp,
+    "user_id" int4,
+    "node_id" int4,
+    "channel" varchar,
+    "recipient" varchar,
+    "event" varchar,
+    "check_name" varchar,
+    "severity" varchar,
+    "body" varchar,
+    "status" varchar,
+    "attempts" int4 NOT NULL DEFAULT 0,
+    "next_attempt_at" timestamp,
+    "last_error" varchar,
+    "provider_id" varchar,
+    "fallback_at" timestamp,
+    PRIMARY KEY ("id")
+);
+
+--migration:split
+ALTER TABLE "notifications" ADD CONSTRAINT fk_notification_to_user FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+--migration:split
+ALTER TABLE "notifications" ADD CONSTRAINT fk_notification_to_node FOREIGN KEY ("node_id") REFERENCES "nodes" ("id");
+
+--migration:split
+CREATE INDEX notifications_status_next_attempt_at ON "notifications" ("status", "next_attempt_at");
+
+--migration:split
+CREATE UNIQUE INDEX notifications_provider_id ON "notifications" ("provider_id");
@@ -0,0 +1,13 @@
+ALTER TABLE "users" ADD COLUMN "timezone" varchar;
+
+--migration:split
+ALTER TABLE "users" ADD COLUMN "report_times" varchar;
+
+--migration:split
+ALTER TABLE "users" ADD COLUMN "report_weekdays" varchar;
+
+--migration:split
+ALTER TABLE "users" ADD COLUMN "quiet_start" varchar;
+
+--migration:split
+ALTER TABLE "users" ADD COLUMN "quiet_end" varchar;
@@ -0,0 +1,29 @@
+CREATE SEQUENCE IF NOT EXISTS "notification_templates_id_seq";
+
+--migration:split
+CREATE TABLE "public"."notification_templates" (
+    "id" int4 NOT NULL DEFAULT nextval('"notification_templates_id_seq"'::regclass),
+    "user_id" int4,
+    "channel" varchar,
+    "event" varchar,
+    "body" varchar,
+    "updated_at" timestamp,
+    PRIMARY KEY ("id")
+);
+
+--migration:split
+ALTER TABLE "notification_templates" ADD CONSTRAINT fk_notification_template_to_user FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+--migration:split
+ALTER TABLE "notification_templates" ADD CONSTRAINT unique_notification_template UNIQUE ("user_id", "channel", "event");
+
+--migration:split
+CREATE TABLE "public"."node_snapshots" (
+    "node_id" int4 NOT NULL,
+    "taken_at" timestamp,
+    "snapshot" varchar,
+    PRIMARY KEY ("node_id")
+);
+
+--migration:split
+ALTER TABLE "node_snapshots" ADD CONSTRAINT fk_node_snapshot_to_node FOREIGN KEY ("node_id") REFERENCES "nodes" ("id");
@@ -0,0 +1,42 @@
+CREATE SEQUENCE IF NOT EXISTS "silences_id_seq";
+
+--migration:split
+CREATE TABLE "public"."silences" (
+    "id" int4 NOT NULL DEFAULT nextval('"silences_id_seq"'::regclass),
+    "created_at" timestamp NOT NULL DEFAULT current_timestamp,
+    "user_id" int4,
+    "node_id" int4,
+    "check_name" varchar,
+    "kind" varchar,
+    "comment" varchar,
+    "starts_at" timestamp,
+    "ends_at" timestamp,
+    "recurrence" varchar,
+    "repeat_until" timestamp,
+    "summary_sent_at" timestamp,
+    PRIMARY KEY ("id")
+);
+
+--migration:split
+ALTER TABLE "silences" ADD CONSTRAINT fk_silence_to_user FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+--migration:split
+ALTER TABLE "silences" ADD CONSTRAINT fk_silence_to_node FOREIGN KEY ("node_id") REFERENCES "nodes" ("id") ON DELETE CASCADE;
+
+--migration:split
+CREATE SEQUENCE IF NOT EXISTS "suppressed_alerts_id_seq";
+
+--migration:split
+CREATE TABLE "public"."suppressed_alerts" (
+    "id" int4 NOT NULL DEFAULT nextval('"suppressed_alerts_id_seq"'::regclass),
+    "created_at" timestamp NOT NULL DEFAULT current_timestamp,
+    "silence_id" int4,
+    "node_id" int4,
+    "check_name" varchar,
+    "event" varchar,
+    "message" varchar,
+    PRIMARY KEY ("id")
+);
+
+--migration:split
+ALTER TABLE "suppressed_alerts" ADD CONSTRAINT fk_suppressed_alert_to_silence FOREIGN KEY ("silence_id") REFERENCES "silences" ("id") ON DELETE CASCADE;
@@ -0,0 +1,37 @@
+CREATE SEQUENCE IF NOT EXISTS "incidents_id_seq";
+
+--migration:split
+CREATE TABLE "public"."incidents" (
+    "id" int4 NOT NULL DEFAULT nextval('"incidents_id_seq"'::regclass),
+    "node_id" int4,
+    "check_name" varchar,
+    "severity" varchar,
+    "message" varchar,
+    "opened_at" timestamp,
+    "acknowledged_at" timestamp,
+    "acknowledged_by" varchar,
+    "closed_at" timestamp,
+    PRIMARY KEY ("id")
+);
+
+--migration:split
+ALTER TABLE "incidents" ADD CONSTRAINT fk_incident_to_node FOREIGN KEY ("node_id") REFERENCES "nodes" ("id") ON DELETE CASCADE;
+
+--migration:split
+CREATE INDEX "incidents_open_idx" ON "incidents" ("node_id", "check_name") WHERE "closed_at" IS NULL;
+
+--migration:split
+CREATE SEQUENCE IF NOT EXISTS "incident_events_id_seq";
+
+--migration:split
+CREATE TABLE "public"."incident_events" (
+    "id" int4 NOT NULL DEFAULT nextval('"incident_events_id_seq"'::regclass),
+    "incident_id" int4,
+    "created_at" timestamp NOT NULL DEFAULT current_timestamp,
+    "kind" varchar,
+    "detail" varchar,
+    PRIMARY KEY ("id")
+);
+
+--migration:split
+ALTER TABLE "incident_events" ADD CONSTRAINT fk_incident_event_to_incident FOREIGN KEY ("incident_id") REFERENCES "incidents" ("id") ON DELETE CASCADE;
@@ -0,0 +1,42 @@
+CREATE SEQUENCE IF NOT EXISTS "escalation_policies_id_seq";
+
+--migration:split
+CREATE TABLE "public"."escalation_policies" (
+    "id" int4 NOT NULL DEFAULT nextval('"escalation_policies_id_seq"'::regclass),
+    "created_at" timestamp NOT NULL DEFAULT current_timestamp,
+    "user_id" int4,
+    "name" varchar,
+    "delay_minutes" int4,
+    PRIMARY KEY ("id")
+);
+
+--migration:split
+ALTER TABLE "escalation_policies" ADD CONSTRAINT fk_escalation_policy_to_user FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+--migration:split
+CREATE SEQUENCE IF NOT EXISTS "escalation_contacts_id_seq";
+
+--migration:split
+CREATE TABLE "public"."escalation_contacts" (
+    "id" int4 NOT NULL DEFAULT nextval('"escalation_contacts_id_seq"'::regclass),
+    "policy_id" int4,
+    "user_id" int4,
+    "position" int4,
+    PRIMARY KEY ("id"),
+    UNIQUE ("policy_id", "user_id")
+);
+
+--migration:split
+ALTER TABLE "escalation_contacts" ADD CONSTRAINT fk_escalation_contact_to_policy FOREIGN KEY ("policy_id") REFERENCES "escalation_policies" ("id") ON DELETE CASCADE;
+
+--migration:split
+ALTER TABLE "escalation_contacts" ADD CONSTRAINT fk_escalation_contact_to_user FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+--migration:split
+ALTER TABLE "nodes" ADD COLUMN "escalation_policy_id" int4;
+
+--migration:split
+ALTER TABLE "nodes" ADD CONSTRAINT fk_node_to_escalation_policy FOREIGN KEY ("escalation_policy_id") REFERENCES "escalation_policies" ("id") ON DELETE SET NULL;
+
+--migration:split
+ALTER TABLE "node_checks" ADD COLUMN "policy_step" int4 NOT NULL DEFAULT 0;
@@ -0,0 +1,23 @@
+ALTER TABLE "users" ADD COLUMN "phone_verified_at" timestamp;
+
+--migration:split
+UPDATE "users" SET "sms_enabled" = false WHERE "phone_verified_at" IS NULL;
+
+--migration:split
+CREATE SEQUENCE IF NOT EXISTS "phone_verifications_id_seq";
+
+--migration:split
+CREATE TABLE "public"."phone_verifications" (
+    "id" int4 NOT NULL DEFAULT nextval('"phone_verifications_id_seq"'::regclass),
+    "created_at" timestamp NOT NULL DEFAULT current_timestamp,
+    "user_id" int4,
+    "phone_number" varchar,
+    "code_hash" varchar,
+    "expires_at" timestamp,
+    "attempts" int4 NOT NULL DEFAULT 0,
+    "verified_at" timestamp,
+    PRIMARY KEY ("id")
+);
+
+--migration:split
+ALTER TABLE "phone_verifications" ADD CONSTRAINT fk_phone_verification_to_user FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
@@ -0,0 +1,33 @@
+ALTER TABLE "multi_channel_backups" ADD COLUMN "content_hash" varchar;
+
+--migration:split
+ALTER TABLE "multi_channel_backups" ADD COLUMN "last_verified_at" timestamp;
+
+--migration:split
+UPDATE "multi_channel_backups" SET "content_hash" = encode(sha256(decode("backup", 'base64')), 'hex')
+WHERE "backup" ~ '^[A-Za-z0-9+/]*={0,2}$' AND length("backup") % 4 = 0;
+
+--migration:split
+WITH "changes" AS (
+    SELECT "id", "node_id", "created_at",
+        CASE WHEN "content_hash" IS NULL OR "content_hash" IS DISTINCT FROM lag("content_hash") OVER "w" THEN 1 ELSE 0 END AS "changed"
+    FROM "multi_channel_backups"
+    WINDOW "w" AS (PARTITION BY "node_id" ORDER BY "created_at", "id")
+), "versions" AS (
+    SELECT "id", "node_id", "created_at",
+        sum("changed") OVER (PARTITION BY "node_id" ORDER BY "created_at", "id") AS "version"
+    FROM "changes"
+)
+UPDATE "multi_channel_backups" SET "last_verified_at" = "verified"."last_seen_at"
+FROM (
+    SELECT min("id") AS "id", max("created_at") AS "last_seen_at"
+    FROM "versions"
+    GROUP BY "node_id", "version"
+) AS "verified"
+WHERE "multi_channel_backups"."id" = "verified"."id";
+
+--migration:split
+DELETE FROM "multi_channel_backups" WHERE "last_verified_at" IS NULL AND "content_hash" IS NOT NULL;
+
+--migration:split
+CREATE INDEX "multi_channel_backups_node_id_created_at_idx" ON "multi_channel_backups" ("node_id", "created_at");
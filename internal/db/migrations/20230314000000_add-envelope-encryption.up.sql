@@ -0,0 +1,10 @@
+ALTER TABLE "nodes" ADD COLUMN "key_id" varchar;
+
+--migration:split
+ALTER TABLE "nodes" ADD COLUMN "data_key" varchar;
+
+--migration:split
+ALTER TABLE "multi_channel_backups" ADD COLUMN "key_id" varchar;
+
+--migration:split
+ALTER TABLE "multi_channel_backups" ADD COLUMN "data_key" varchar;
@@ -0,0 +1,7 @@
+ALTER TABLE "multi_channel_backups" ADD COLUMN "verification" varchar;
+
+--migration:split
+ALTER TABLE "multi_channel_backups" ADD COLUMN "verification_error" varchar;
+
+--migration:split
+ALTER TABLE "multi_channel_backups" ADD COLUMN "verification_checked_at" timestamp;
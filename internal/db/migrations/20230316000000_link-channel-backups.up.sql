@@ -0,0 +1,22 @@
+ALTER TABLE "channel_backups" RENAME COLUMN "funding_txid_bytes" TO "funding_txid";
+
+--migration:split
+ALTER TABLE "channel_backups" ADD COLUMN "channel_id" int4;
+
+--migration:split
+ALTER TABLE "channel_backups" ADD COLUMN "content_hash" varchar;
+
+--migration:split
+ALTER TABLE "channel_backups" ADD COLUMN "last_verified_at" timestamp;
+
+--migration:split
+ALTER TABLE "channel_backups" ADD COLUMN "key_id" varchar;
+
+--migration:split
+ALTER TABLE "channel_backups" ADD COLUMN "data_key" varchar;
+
+--migration:split
+ALTER TABLE "channel_backups" ADD CONSTRAINT fk_channel_backup_to_channel FOREIGN KEY ("channel_id") REFERENCES "channels" ("id") ON DELETE CASCADE;
+
+--migration:split
+CREATE INDEX "channel_backups_channel_id_created_at_idx" ON "channel_backups" ("channel_id", "created_at");
@@ -0,0 +1,17 @@
+CREATE SEQUENCE IF NOT EXISTS "backup_replicas_id_seq";
+
+--migration:split
+CREATE TABLE "public"."backup_replicas" (
+    "id" int4 NOT NULL DEFAULT nextval('"backup_replicas_id_seq"'::regclass),
+    "created_at" timestamp NOT NULL DEFAULT current_timestamp,
+    "backup_id" int4,
+    "target" varchar,
+    "location" varchar,
+    PRIMARY KEY ("id")
+);
+
+--migration:split
+ALTER TABLE "backup_replicas" ADD CONSTRAINT fk_backup_replica_to_multi_channel_backup FOREIGN KEY ("backup_id") REFERENCES "multi_channel_backups" ("id") ON DELETE CASCADE;
+
+--migration:split
+CREATE UNIQUE INDEX "backup_replicas_backup_id_target_idx" ON "backup_replicas" ("backup_id", "target");
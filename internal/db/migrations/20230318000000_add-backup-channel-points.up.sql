@@ -0,0 +1 @@
+ALTER TABLE "multi_channel_backups" ADD COLUMN "channel_points" varchar;
@@ -0,0 +1,31 @@
+ALTER TABLE "channels" ADD COLUMN "state" varchar;
+
+--migration:split
+ALTER TABLE "channels" ADD COLUMN "peer_pubkey" varchar;
+
+--migration:split
+ALTER TABLE "channels" ADD COLUMN "capacity" int8;
+
+--migration:split
+ALTER TABLE "channels" ADD COLUMN "open_height" int4;
+
+--migration:split
+ALTER TABLE "channels" ADD COLUMN "initiator" varchar;
+
+--migration:split
+ALTER TABLE "channels" ADD COLUMN "private" boolean;
+
+--migration:split
+ALTER TABLE "channels" ADD COLUMN "close_type" varchar;
+
+--migration:split
+ALTER TABLE "channels" ADD COLUMN "closing_txid" varchar;
+
+--migration:split
+ALTER TABLE "channels" ADD COLUMN "close_height" int4;
+
+--migration:split
+ALTER TABLE "channels" ADD COLUMN "settled_balance" int8;
+
+--migration:split
+UPDATE "channels" SET "state" = 'open';
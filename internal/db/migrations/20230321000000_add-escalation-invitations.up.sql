@@ -0,0 +1,13 @@
+ALTER TABLE "escalation_contacts" ADD COLUMN "email" varchar;
+
+--migration:split
+ALTER TABLE "escalation_contacts" ADD COLUMN "accepted_at" timestamp;
+
+--migration:split
+UPDATE "escalation_contacts" AS c SET "email" = lower(u.email) FROM "users" AS u WHERE u.id = c.user_id;
+
+--migration:split
+UPDATE "escalation_contacts" AS c SET "accepted_at" = current_timestamp FROM "escalation_policies" AS p WHERE p.id = c.policy_id AND p.user_id = c.user_id;
+
+--migration:split
+ALTER TABLE "escalation_contacts" ADD CONSTRAINT escalation_contacts_policy_id_email_key UNIQUE ("policy_id", "email");
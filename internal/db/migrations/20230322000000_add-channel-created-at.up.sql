@@ -0,0 +1 @@
+ALTER TABLE "channels" ADD COLUMN "created_at" timestamp NOT NULL DEFAULT current_timestamp;
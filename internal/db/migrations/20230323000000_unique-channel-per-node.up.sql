@@ -0,0 +1,4 @@
+ALTER TABLE "channels" DROP CONSTRAINT unique_channel_port;
+
+--migration:split
+ALTER TABLE "channels" ADD CONSTRAINT unique_node_channel_port UNIQUE ("node_id", "funding_txid", "output_index");
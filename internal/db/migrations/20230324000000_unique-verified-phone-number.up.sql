@@ -0,0 +1,12 @@
+UPDATE "users" SET "phone_verified_at" = NULL, "sms_enabled" = false
+WHERE "id" IN (
+    SELECT "id" FROM (
+        SELECT "id", row_number() OVER (PARTITION BY "phone_number" ORDER BY "phone_verified_at", "id") AS "n"
+        FROM "users"
+        WHERE "phone_verified_at" IS NOT NULL
+    ) AS "verified"
+    WHERE "n" > 1
+);
+
+--migration:split
+CREATE UNIQUE INDEX "users_verified_phone_number_idx" ON "users" ("phone_number") WHERE "phone_verified_at" IS NOT NULL;
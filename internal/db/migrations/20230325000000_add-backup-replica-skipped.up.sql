@@ -0,0 +1 @@
+ALTER TABLE "backup_replicas" ADD COLUMN "skipped" varchar;
@@ -20,26 +20,46 @@ type ConnectionParams struct {
 type Node struct {
 	bun.BaseModel `bun:"table:nodes"`
 
-	ID       int64  `bun:"id,pk,autoincrement"`
-	URL      string `bun:"url,unique"`
-	Alias    string `bun:"alias"`
-	Pubkey   string `bun:"pubkey"`
-	Macaroon string `bun:"macaroon"`
-	TLSCert  string `bun:"tls_cert"`
-	UserID   int64  `bun:"user_id"`
+	ID                  int64  `bun:"id,pk,autoincrement"`
+	URL                 string `bun:"url,unique"`
+	Alias               string `bun:"alias"`
+	Pubkey              string `bun:"pubkey"`
+	Macaroon            string `bun:"macaroon"`
+	TLSCert             string `bun:"tls_cert"`
+	UserID              int64  `bun:"user_id"`
+	PagerDutyRoutingKey string `bun:"pagerduty_routing_key,nullzero"`
+	EscalationPolicyID  int64  `bun:"escalation_policy_id,nullzero"`
+	KeyID               string `bun:"key_id,nullzero" json:"-"`
+	DataKey             string `bun:"data_key,nullzero" json:"-"`
 }
 
 // User is a
 type User struct {
 	bun.BaseModel `bun:"table:users"`
 
-	ID            int64     `bun:"id,pk,autoincrement"`
-	Email         string    `bun:"email,unique"`
-	Password      string    `bun:"password"`
-	PhoneNumber   string    `bun:"phone_number"`
-	SmsEnabled    bool      `bun:"sms_enabled"`
-	SmsLastSent   time.Time `bun:"sms_last_sent"`
-	SmsNotifyTime time.Time `bun:"sms_notify_time"`
+	ID                     int64     `bun:"id,pk,autoincrement"`
+	Email                  string    `bun:"email,unique"`
+	Password               string    `bun:"password"`
+	PhoneNumber            string    `bun:"phone_number"`
+	SmsEnabled             bool      `bun:"sms_enabled"`
+	SmsLastSent            time.Time `bun:"sms_last_sent"`
+	SmsNotifyTime          time.Time `bun:"sms_notify_time"`
+	TelegramChatID         int64     `bun:"telegram_chat_id,nullzero"`
+	TelegramLinkCode       string    `bun:"telegram_link_code,nullzero"`
+	MutedUntil             time.Time `bun:"muted_until,nullzero"`
+	PagerDutyRoutingKey    string    `bun:"pagerduty_routing_key,nullzero"`
+	SlackWebhookURL        string    `bun:"slack_webhook_url,nullzero"`
+	DiscordWebhookURL      string    `bun:"discord_webhook_url,nullzero"`
+	NostrPubkey            string    `bun:"nostr_pubkey,nullzero"`
+	NostrNIP               int       `bun:"nostr_nip,nullzero"`
+	EscalationDelayMinutes int       `bun:"escalation_delay_minutes,nullzero"`
+	EscalationPhoneNumbers string    `bun:"escalation_phone_numbers,nullzero"`
+	Timezone               string    `bun:"timezone,nullzero"`
+	ReportTimes            string    `bun:"report_times,nullzero"`
+	ReportWeekdays         string    `bun:"report_weekdays,nullzero"`
+	QuietStart             string    `bun:"quiet_start,nullzero"`
+	QuietEnd               string    `bun:"quiet_end,nullzero"`
+	PhoneVerifiedAt        time.Time `bun:"phone_verified_at,nullzero"`
 }
 
 // HashPassword hashes a password
@@ -61,33 +81,283 @@ func (user *User) CheckPassword(providedPassword string) error {
 	return nil
 }
 
-// Channel is a Lightning Channel
+// NodeCheck is the last known result of a health check on a lightning node
+type NodeCheck struct {
+	bun.BaseModel `bun:"table:node_checks"`
+
+	ID             int64     `bun:"id,pk,autoincrement"`
+	NodeID         int64     `bun:"node_id"`
+	Name           string    `bun:"name"`
+	Severity       string    `bun:"severity"`
+	Failing        bool      `bun:"failing"`
+	Message        string    `bun:"message"`
+	ChangedAt      time.Time `bun:"changed_at"`
+	AcknowledgedAt time.Time `bun:"acknowledged_at,nullzero"`
+	EscalationStep int       `bun:"escalation_step"`
+	PolicyStep     int       `bun:"policy_step"`
+}
+
+// EscalationPolicy decides who is notified about a critical alert of a node that has not been
+// acknowledged: the primary contact, then after DelayMinutes the secondary contact, and so on,
+// and finally all contacts at once
+type EscalationPolicy struct {
+	bun.BaseModel `bun:"table:escalation_policies"`
+
+	ID           int64     `bun:"id,pk,autoincrement"`
+	CreatedAt    time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	UserID       int64     `bun:"user_id"`
+	Name         string    `bun:"name"`
+	DelayMinutes int       `bun:"delay_minutes"`
+}
+
+// EscalationContact is a user notified by an escalation policy. Position 0 is the primary contact.
+// Contacts are invited by email and only notified once the user with that email has accepted,
+// which sets UserID
+type EscalationContact struct {
+	bun.BaseModel `bun:"table:escalation_contacts"`
+
+	ID         int64     `bun:"id,pk,autoincrement"`
+	PolicyID   int64     `bun:"policy_id"`
+	UserID     int64     `bun:"user_id,nullzero"`
+	Position   int       `bun:"position"`
+	Email      string    `bun:"email"`
+	AcceptedAt time.Time `bun:"accepted_at,nullzero"`
+}
+
+// PhoneVerification is a one-time code sent to a user to verify their phone number
+type PhoneVerification struct {
+	bun.BaseModel `bun:"table:phone_verifications"`
+
+	ID          int64     `bun:"id,pk,autoincrement"`
+	CreatedAt   time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	UserID      int64     `bun:"user_id"`
+	PhoneNumber string    `bun:"phone_number"`
+	CodeHash    string    `bun:"code_hash"`
+	ExpiresAt   time.Time `bun:"expires_at"`
+	Attempts    int       `bun:"attempts"`
+	VerifiedAt  time.Time `bun:"verified_at,nullzero"`
+}
+
+// NostrKey is the encrypted private key nodewatcher signs nostr messages with
+type NostrKey struct {
+	bun.BaseModel `bun:"table:nostr_keys"`
+
+	ID           int64     `bun:"id,pk,autoincrement"`
+	CreatedAt    time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	EncryptedKey string    `bun:"encrypted_key"`
+}
+
+// Notification is a message waiting in, or sent from, the notification outbox. DeliveredOver
+// lists the channels, comma separated, the same alert was sent over besides the outbox
+type Notification struct {
+	bun.BaseModel `bun:"table:notifications"`
+
+	ID            int64     `bun:"id,pk,autoincrement"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	UserID        int64     `bun:"user_id"`
+	NodeID        int64     `bun:"node_id,nullzero"`
+	Channel       string    `bun:"channel"`
+	Recipient     string    `bun:"recipient"`
+	Event         string    `bun:"event"`
+	CheckName     string    `bun:"check_name,nullzero"`
+	Severity      string    `bun:"severity"`
+	Body          string    `bun:"body"`
+	Status        string    `bun:"status"`
+	Attempts      int       `bun:"attempts"`
+	NextAttemptAt time.Time `bun:"next_attempt_at,nullzero"`
+	LastError     string    `bun:"last_error,nullzero"`
+	ProviderID    string    `bun:"provider_id,nullzero"`
+	FallbackAt    time.Time `bun:"fallback_at,nullzero"`
+	DeliveredOver string    `bun:"delivered_over,nullzero"`
+}
+
+// NotificationTemplate is a text/template a user has defined for the alerts of one event
+// type sent over one channel
+type NotificationTemplate struct {
+	bun.BaseModel `bun:"table:notification_templates"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	UserID    int64     `bun:"user_id"`
+	Channel   string    `bun:"channel"`
+	Event     string    `bun:"event"`
+	Body      string    `bun:"body"`
+	UpdatedAt time.Time `bun:"updated_at"`
+}
+
+// NodeSnapshot is the JSON encoded state of a lightning node at its last health check
+type NodeSnapshot struct {
+	bun.BaseModel `bun:"table:node_snapshots"`
+
+	NodeID   int64     `bun:"node_id,pk"`
+	TakenAt  time.Time `bun:"taken_at"`
+	Snapshot string    `bun:"snapshot"`
+}
+
+// Silence suppresses the alerts of a user's nodes that match its node and check, during a
+// maintenance window or an ad-hoc silence. An empty NodeID or CheckName matches all. Recurring
+// silences repeat daily or weekly until RepeatUntil
+type Silence struct {
+	bun.BaseModel `bun:"table:silences"`
+
+	ID            int64     `bun:"id,pk,autoincrement"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	UserID        int64     `bun:"user_id"`
+	NodeID        int64     `bun:"node_id,nullzero"`
+	CheckName     string    `bun:"check_name,nullzero"`
+	Kind          string    `bun:"kind"`
+	Comment       string    `bun:"comment,nullzero"`
+	StartsAt      time.Time `bun:"starts_at"`
+	EndsAt        time.Time `bun:"ends_at"`
+	Recurrence    string    `bun:"recurrence,nullzero"`
+	RepeatUntil   time.Time `bun:"repeat_until,nullzero"`
+	SummarySentAt time.Time `bun:"summary_sent_at,nullzero"`
+}
+
+// SuppressedAlert is an alert that was not sent because of a silence
+type SuppressedAlert struct {
+	bun.BaseModel `bun:"table:suppressed_alerts"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	SilenceID int64     `bun:"silence_id"`
+	NodeID    int64     `bun:"node_id"`
+	CheckName string    `bun:"check_name"`
+	Event     string    `bun:"event"`
+	Message   string    `bun:"message"`
+}
+
+// Incident is a critical health check failure of a lightning node, open from the moment the
+// check starts failing until it recovers
+type Incident struct {
+	bun.BaseModel `bun:"table:incidents"`
+
+	ID             int64     `bun:"id,pk,autoincrement"`
+	NodeID         int64     `bun:"node_id"`
+	CheckName      string    `bun:"check_name"`
+	Severity       string    `bun:"severity"`
+	Message        string    `bun:"message"`
+	OpenedAt       time.Time `bun:"opened_at"`
+	AcknowledgedAt time.Time `bun:"acknowledged_at,nullzero"`
+	AcknowledgedBy string    `bun:"acknowledged_by,nullzero"`
+	ClosedAt       time.Time `bun:"closed_at,nullzero"`
+}
+
+// IncidentEvent is an entry in the timeline of an incident
+type IncidentEvent struct {
+	bun.BaseModel `bun:"table:incident_events"`
+
+	ID         int64     `bun:"id,pk,autoincrement"`
+	IncidentID int64     `bun:"incident_id"`
+	CreatedAt  time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	Kind       string    `bun:"kind"`
+	Detail     string    `bun:"detail,nullzero"`
+}
+
+// Channel is a Lightning Channel. Its row is updated as the channel moves from being opened to
+// closed; the close columns are only set once it is closed
 type Channel struct {
 	bun.BaseModel `bun:"table:channels"`
 
-	ID          int64  `bun:"id,pk,autoincrement"`
-	FundingTxid string `bun:"funding_txid"`
-	OutputIndex int64  `bun:"output_index"`
-	NodeID      int64  `bun:"node_id"`
+	ID          int64     `bun:"id,pk,autoincrement"`
+	CreatedAt   time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	FundingTxid string    `bun:"funding_txid"`
+	OutputIndex int64     `bun:"output_index"`
+	NodeID      int64     `bun:"node_id"`
+	State       string    `bun:"state,nullzero"`
+	PeerPubkey  string    `bun:"peer_pubkey,nullzero"`
+	Capacity    int64     `bun:"capacity,nullzero"`
+	OpenHeight  int64     `bun:"open_height,nullzero"`
+	Initiator   string    `bun:"initiator,nullzero"`
+	Private     bool      `bun:"private"`
+
+	CloseType      string `bun:"close_type,nullzero"`
+	ClosingTxid    string `bun:"closing_txid,nullzero"`
+	CloseHeight    int64  `bun:"close_height,nullzero"`
+	SettledBalance int64  `bun:"settled_balance,nullzero"`
 }
 
+// States of a channel
+const (
+	ChannelPendingOpen = "pending_open"
+	ChannelOpen        = "open"
+	ChannelClosing     = "closing"
+	ChannelClosed      = "closed"
+)
+
+// Parties that opened a channel
+const (
+	InitiatorLocal  = "local"
+	InitiatorRemote = "remote"
+	InitiatorBoth   = "both"
+)
+
 // ChannelBackup is an encrypted static channel backup of a single lightning channel
 type ChannelBackup struct {
 	bun.BaseModel `bun:"table:channel_backups"`
 
-	ID               int64     `bun:"id,pk,autoincrement"`
-	CreatedAt        time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
-	FundingTxidBytes string    `bun:"funding_txid_bytes"`
-	OutputIndex      int64     `bun:"output_index"`
-	Backup           string    `bun:"backup"`
+	ID             int64     `bun:"id,pk,autoincrement"`
+	CreatedAt      time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	FundingTxid    string    `bun:"funding_txid"`
+	OutputIndex    int64     `bun:"output_index"`
+	Backup         string    `bun:"backup"`
+	ContentHash    string    `bun:"content_hash"`
+	LastVerifiedAt time.Time `bun:"last_verified_at,nullzero"`
+	ChannelID      int64     `bun:"channel_id"`
+	KeyID          string    `bun:"key_id,nullzero" json:"-"`
+	DataKey        string    `bun:"data_key,nullzero" json:"-"`
 }
 
 // MultiChannelBackup is an encrypted backup of a lightning channel state
 type MultiChannelBackup struct {
 	bun.BaseModel `bun:"table:multi_channel_backups"`
 
+	ID             int64     `bun:"id,pk,autoincrement"`
+	CreatedAt      time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	Backup         string    `bun:"backup"`
+	ContentHash    string    `bun:"content_hash"`
+	LastVerifiedAt time.Time `bun:"last_verified_at,nullzero"`
+	NodeID         int64     `bun:"node_id"`
+	KeyID          string    `bun:"key_id,nullzero" json:"-"`
+	DataKey        string    `bun:"data_key,nullzero" json:"-"`
+	ChannelPoints  string    `bun:"channel_points"`
+
+	Verification          string    `bun:"verification,nullzero"`
+	VerificationError     string    `bun:"verification_error,nullzero"`
+	VerificationCheckedAt time.Time `bun:"verification_checked_at,nullzero"`
+}
+
+// BackupReplica records that a multi-channel backup was copied to a replication target, such as
+// an S3 bucket, so it is copied there only once. Skipped is why a backup that cannot be copied
+// was left out instead, and its Location is empty
+type BackupReplica struct {
+	bun.BaseModel `bun:"table:backup_replicas"`
+
 	ID        int64     `bun:"id,pk,autoincrement"`
 	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
-	Backup    string    `bun:"backup"`
-	NodeID    int64     `bun:"node_id"`
+	BackupID  int64     `bun:"backup_id"`
+	Target    string    `bun:"target"`
+	Location  string    `bun:"location"`
+	Skipped   string    `bun:"skipped,nullzero"`
+}
+
+// Results of verifying a multi-channel backup with LND
+const (
+	BackupValid   = "valid"
+	BackupInvalid = "invalid"
+)
+
+// VerifiedAt is the last time the backup was known to be the node's current backup
+func (backup *MultiChannelBackup) VerifiedAt() time.Time {
+	if backup.LastVerifiedAt.IsZero() {
+		return backup.CreatedAt
+	}
+	return backup.LastVerifiedAt
+}
+
+// VerifiedAt is the last time the backup was known to be the channel's current backup
+func (backup *ChannelBackup) VerifiedAt() time.Time {
+	if backup.LastVerifiedAt.IsZero() {
+		return backup.CreatedAt
+	}
+	return backup.LastVerifiedAt
 }
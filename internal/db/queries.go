@@ -4,11 +4,11 @@ package db
 
 import (
 	"context"
-	"strconv"
-	"strings"
+	"database/sql"
+	"errors"
 	"time"
 
-	"github.com/lightninglabs/lndclient"
+	"github.com/uptrace/bun"
 )
 
 // InsertNode adds a lightning node to the database
@@ -16,10 +16,15 @@ func InsertNode(node *Node) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
 	defer cancel()
 
-	_, err := Instance.NewInsert().
-		Model(node).
+	encrypted, err := encryptNode(*node)
+	if err != nil {
+		return err
+	}
+	_, err = Instance.NewInsert().
+		Model(&encrypted).
 		On("conflict (\"pubkey\") do nothing").
 		Exec(ctx)
+	node.ID = encrypted.ID
 
 	return err
 }
@@ -38,6 +43,20 @@ func FindNodeByPubkey(pubkey string) (Node, error) {
 	return node, err
 }
 
+// FindNodeByID gets a lightning node from the db
+func FindNodeByID(id int64) (Node, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var node Node
+	err := Instance.NewSelect().
+		Model(&node).
+		Where("id = ?", id).
+		Scan(ctx, &node)
+
+	return node, err
+}
+
 // FindAllNodes gets node from the db
 func FindAllNodes(ctx context.Context) ([]Node, error) {
 	var nodes []Node
@@ -48,93 +67,1067 @@ func FindAllNodes(ctx context.Context) ([]Node, error) {
 	return nodes, err
 }
 
-// InsertChannel adds a channel to the db
-func InsertChannel(channel lndclient.ChannelInfo, pubkey string) error {
+// FindNodesByUserID gets all nodes belonging to a user from the db
+func FindNodesByUserID(userID int64) ([]Node, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var nodes []Node
+	err := Instance.NewSelect().
+		Model(&nodes).
+		Where("user_id = ?", userID).
+		OrderExpr("alias ASC").
+		Scan(ctx, &nodes)
+
+	return nodes, err
+}
+
+// FindNodeChecks gets the last known health check results of a node from the db
+func FindNodeChecks(nodeID int64) ([]NodeCheck, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var checks []NodeCheck
+	err := Instance.NewSelect().
+		Model(&checks).
+		Where("node_id = ?", nodeID).
+		Scan(ctx, &checks)
+
+	return checks, err
+}
+
+// UpsertNodeCheck adds or updates the result of a health check in the db
+func UpsertNodeCheck(check *NodeCheck) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(check).
+		On("CONFLICT (node_id, name) DO UPDATE").
+		Set("severity = EXCLUDED.severity").
+		Set("failing = EXCLUDED.failing").
+		Set("message = EXCLUDED.message").
+		Set("changed_at = EXCLUDED.changed_at").
+		Set("acknowledged_at = EXCLUDED.acknowledged_at").
+		Set("escalation_step = EXCLUDED.escalation_step").
+		Set("policy_step = EXCLUDED.policy_step").
+		Exec(ctx)
+
+	return err
+}
+
+// UpdateNodeCheckEscalation updates how far a failing health check has been escalated in the db
+func UpdateNodeCheckEscalation(check NodeCheck) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewUpdate().
+		Model(&check).
+		Column("escalation_step").
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
+
+// UpdateNodeCheckPolicyStep updates how far the escalation policy of a failing health check has
+// been followed in the db
+func UpdateNodeCheckPolicyStep(check NodeCheck) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewUpdate().
+		Model(&check).
+		Column("policy_step").
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
+
+// AcknowledgeNodeChecks marks all failing, unacknowledged health checks of a node as
+// acknowledged in the db and returns how many were acknowledged
+func AcknowledgeNodeChecks(nodeID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	result, err := Instance.NewUpdate().
+		Model((*NodeCheck)(nil)).
+		Set("acknowledged_at = ?", time.Now().UTC()).
+		Where("node_id = ?", nodeID).
+		Where("failing").
+		Where("acknowledged_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// AcknowledgeNodeCheck marks a failing health check of a node as acknowledged in the db
+func AcknowledgeNodeCheck(nodeID int64, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewUpdate().
+		Model((*NodeCheck)(nil)).
+		Set("acknowledged_at = ?", time.Now().UTC()).
+		Where("node_id = ?", nodeID).
+		Where("name = ?", name).
+		Where("failing").
+		Where("acknowledged_at IS NULL").
+		Exec(ctx)
+
+	return err
+}
+
+// InsertIncident adds an incident to the db
+func InsertIncident(incident *Incident) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(incident).
+		Exec(ctx)
+
+	return err
+}
+
+// UpdateIncident updates the acknowledgement and closing time of an incident in the db
+func UpdateIncident(incident Incident) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewUpdate().
+		Model(&incident).
+		Column("acknowledged_at", "acknowledged_by", "closed_at").
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
+
+// FindIncidentByID gets an incident from the db
+func FindIncidentByID(id int64) (Incident, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var incident Incident
+	err := Instance.NewSelect().
+		Model(&incident).
+		Where("id = ?", id).
+		Scan(ctx, &incident)
+
+	return incident, err
+}
+
+// FindOpenIncidents gets the open incidents of a node from the db
+func FindOpenIncidents(nodeID int64) ([]Incident, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var incidents []Incident
+	err := Instance.NewSelect().
+		Model(&incidents).
+		Where("node_id = ?", nodeID).
+		Where("closed_at IS NULL").
+		Order("opened_at ASC").
+		Scan(ctx, &incidents)
+
+	return incidents, err
+}
+
+// FindIncidentsByNodeIDs gets the incidents of the given nodes from the db, newest first
+func FindIncidentsByNodeIDs(nodeIDs []int64, limit int) ([]Incident, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var incidents []Incident
+	if len(nodeIDs) == 0 {
+		return incidents, nil
+	}
+	err := Instance.NewSelect().
+		Model(&incidents).
+		Where("node_id IN (?)", bun.In(nodeIDs)).
+		Order("opened_at DESC").
+		Limit(limit).
+		Scan(ctx, &incidents)
+
+	return incidents, err
+}
+
+// InsertIncidentEvent adds an entry to the timeline of an incident in the db
+func InsertIncidentEvent(event *IncidentEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(event).
+		Exec(ctx)
+
+	return err
+}
+
+// FindIncidentEvents gets the timeline of an incident from the db
+func FindIncidentEvents(incidentID int64) ([]IncidentEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var events []IncidentEvent
+	err := Instance.NewSelect().
+		Model(&events).
+		Where("incident_id = ?", incidentID).
+		Order("id ASC").
+		Scan(ctx, &events)
+
+	return events, err
+}
+
+// UpdateNodeEscalationPolicy updates the escalation policy of a node in the db
+func UpdateNodeEscalationPolicy(node Node) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewUpdate().
+		Model(&node).
+		Column("escalation_policy_id").
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
+
+// InsertEscalationPolicy adds an escalation policy and its contacts, in order, to the db
+func InsertEscalationPolicy(policy *EscalationPolicy, contacts []EscalationContact) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	return Instance.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewInsert().
+			Model(policy).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		for i := range contacts {
+			contacts[i].PolicyID = policy.ID
+			contacts[i].Position = i
+			_, err := tx.NewInsert().
+				Model(&contacts[i]).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindEscalationPolicyByID gets an escalation policy from the db
+func FindEscalationPolicyByID(id int64) (EscalationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var policy EscalationPolicy
+	err := Instance.NewSelect().
+		Model(&policy).
+		Where("id = ?", id).
+		Scan(ctx, &policy)
+
+	return policy, err
+}
+
+// FindEscalationPoliciesByUserID gets the escalation policies of a user from the db
+func FindEscalationPoliciesByUserID(userID int64) ([]EscalationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var policies []EscalationPolicy
+	err := Instance.NewSelect().
+		Model(&policies).
+		Where("user_id = ?", userID).
+		Order("name ASC").
+		Scan(ctx, &policies)
+
+	return policies, err
+}
+
+// FindEscalationContacts gets the users notified by an escalation policy from the db, primary
+// contact first. Contacts that have not accepted their invitation are left out
+func FindEscalationContacts(policyID int64) ([]User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var users []User
+	err := Instance.NewSelect().
+		Model(&users).
+		Join(`JOIN escalation_contacts AS c ON c.user_id = "user".id`).
+		Where("c.policy_id = ?", policyID).
+		Where("c.accepted_at IS NOT NULL").
+		OrderExpr("c.position ASC").
+		Scan(ctx, &users)
+
+	return users, err
+}
+
+// FindEscalationInvitations gets the contacts of an escalation policy from the db, including
+// those that have not accepted their invitation, primary contact first
+func FindEscalationInvitations(policyID int64) ([]EscalationContact, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var contacts []EscalationContact
+	err := Instance.NewSelect().
+		Model(&contacts).
+		Where("policy_id = ?", policyID).
+		Order("position ASC").
+		Scan(ctx, &contacts)
+
+	return contacts, err
+}
+
+// FindEscalationInvitationsByEmail gets the invitations sent to an email to be a contact of an
+// escalation policy from the db
+func FindEscalationInvitationsByEmail(email string) ([]EscalationContact, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var contacts []EscalationContact
+	err := Instance.NewSelect().
+		Model(&contacts).
+		Where("email = lower(?)", email).
+		Order("policy_id ASC").
+		Scan(ctx, &contacts)
+
+	return contacts, err
+}
+
+// AcceptEscalationInvitation records that a user accepted to be a contact of an escalation
+// policy in the db
+func AcceptEscalationInvitation(contact EscalationContact) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewUpdate().
+		Model(&contact).
+		Column("user_id", "accepted_at").
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
+
+// DeleteEscalationContact removes a contact from an escalation policy in the db
+func DeleteEscalationContact(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewDelete().
+		Model((*EscalationContact)(nil)).
+		Where("id = ?", id).
+		Exec(ctx)
+
+	return err
+}
+
+// FindNodesByEscalationContact gets the nodes whose escalation policy notifies a user from the db
+func FindNodesByEscalationContact(userID int64) ([]Node, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var nodes []Node
+	err := Instance.NewSelect().
+		Model(&nodes).
+		Join("JOIN escalation_contacts AS c ON c.policy_id = node.escalation_policy_id").
+		Where("c.user_id = ?", userID).
+		Where("c.accepted_at IS NOT NULL").
+		OrderExpr("node.alias ASC").
+		Scan(ctx, &nodes)
+
+	return nodes, err
+}
+
+// DeleteEscalationPolicy removes an escalation policy of a user from the db. Its nodes are left
+// without a policy
+func DeleteEscalationPolicy(userID int64, id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewDelete().
+		Model((*EscalationPolicy)(nil)).
+		Where("user_id = ?", userID).
+		Where("id = ?", id).
+		Exec(ctx)
+
+	return err
+}
+
+// UpsertNodeSnapshot stores the latest snapshot of a node in the db
+func UpsertNodeSnapshot(snapshot *NodeSnapshot) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(snapshot).
+		On("CONFLICT (node_id) DO UPDATE").
+		Set("taken_at = EXCLUDED.taken_at").
+		Set("snapshot = EXCLUDED.snapshot").
+		Exec(ctx)
+
+	return err
+}
+
+// FindNodeSnapshot gets the latest snapshot of a node from the db
+func FindNodeSnapshot(nodeID int64) (NodeSnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var snapshot NodeSnapshot
+	err := Instance.NewSelect().
+		Model(&snapshot).
+		Where("node_id = ?", nodeID).
+		Scan(ctx, &snapshot)
+
+	return snapshot, err
+}
+
+// FindNotificationTemplates gets the notification templates of a user from the db
+func FindNotificationTemplates(userID int64) ([]NotificationTemplate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var templates []NotificationTemplate
+	err := Instance.NewSelect().
+		Model(&templates).
+		Where("user_id = ?", userID).
+		Order("channel ASC", "event ASC").
+		Scan(ctx, &templates)
+
+	return templates, err
+}
+
+// UpsertNotificationTemplate adds or replaces a notification template of a user in the db
+func UpsertNotificationTemplate(template *NotificationTemplate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(template).
+		On("CONFLICT (user_id, channel, event) DO UPDATE").
+		Set("body = EXCLUDED.body").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(ctx)
+
+	return err
+}
+
+// DeleteNotificationTemplate removes a notification template of a user from the db
+func DeleteNotificationTemplate(userID int64, channel string, event string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
 	defer cancel()
 
-	nodeFromDB, err := FindNodeByPubkey(pubkey)
-	if err != nil {
-		return err
+	_, err := Instance.NewDelete().
+		Model((*NotificationTemplate)(nil)).
+		Where("user_id = ?", userID).
+		Where("channel = ?", channel).
+		Where("event = ?", event).
+		Exec(ctx)
+
+	return err
+}
+
+// InsertSilence adds a silence to the db
+func InsertSilence(silence *Silence) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(silence).
+		Exec(ctx)
+
+	return err
+}
+
+// FindSilencesByUserID gets the silences of a user from the db
+func FindSilencesByUserID(userID int64) ([]Silence, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var silences []Silence
+	err := Instance.NewSelect().
+		Model(&silences).
+		Where("user_id = ?", userID).
+		Order("starts_at ASC").
+		Scan(ctx, &silences)
+
+	return silences, err
+}
+
+// FindAllSilences gets all silences from the db
+func FindAllSilences(ctx context.Context) ([]Silence, error) {
+	var silences []Silence
+	err := Instance.NewSelect().
+		Model(&silences).
+		Scan(ctx, &silences)
+
+	return silences, err
+}
+
+// UpdateSilenceWindow updates when a silence starts, ends and repeats in the db
+func UpdateSilenceWindow(silence Silence) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewUpdate().
+		Model(&silence).
+		Column("starts_at", "ends_at", "recurrence", "repeat_until").
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
+
+// UpdateSilenceSummarySent updates when the summary of a silence was last sent in the db
+func UpdateSilenceSummarySent(silence Silence) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewUpdate().
+		Model(&silence).
+		Column("summary_sent_at").
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
+
+// InsertSuppressedAlert records an alert suppressed by a silence in the db
+func InsertSuppressedAlert(alert *SuppressedAlert) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(alert).
+		Exec(ctx)
+
+	return err
+}
+
+// FindSuppressedAlerts gets the alerts suppressed by a silence between two times from the db
+func FindSuppressedAlerts(silenceID int64, from time.Time, to time.Time) ([]SuppressedAlert, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var alerts []SuppressedAlert
+	err := Instance.NewSelect().
+		Model(&alerts).
+		Where("silence_id = ?", silenceID).
+		Where("created_at >= ?", from).
+		Where("created_at <= ?", to).
+		Order("id ASC").
+		Scan(ctx, &alerts)
+
+	return alerts, err
+}
+
+// InsertNotification adds a notification to the outbox in the db
+func InsertNotification(notification *Notification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(notification).
+		Exec(ctx)
+
+	return err
+}
+
+// UpdateNotification updates the delivery state of a notification in the db
+func UpdateNotification(notification Notification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewUpdate().
+		Model(&notification).
+		Column("status", "attempts", "next_attempt_at", "last_error", "provider_id", "fallback_at").
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
+
+// FindDueNotifications gets the notifications with one of the given statuses that are due to
+// be sent from the db, oldest first
+func FindDueNotifications(statuses []string, now time.Time) ([]Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var notifications []Notification
+	err := Instance.NewSelect().
+		Model(&notifications).
+		Where("status IN (?)", bun.In(statuses)).
+		Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+		Order("id ASC").
+		Scan(ctx, &notifications)
+
+	return notifications, err
+}
+
+// FindNotificationsNeedingFallback gets the failed notifications that have not yet been sent
+// over a fallback channel from the db
+func FindNotificationsNeedingFallback() ([]Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var notifications []Notification
+	err := Instance.NewSelect().
+		Model(&notifications).
+		Where("status IN (?)", bun.In([]string{"failed", "undelivered"})).
+		Where("fallback_at IS NULL").
+		Order("id ASC").
+		Scan(ctx, &notifications)
+
+	return notifications, err
+}
+
+// UpdateNotificationStatus sets the delivery status reported by the provider for the
+// notification it identifies by providerID in the db
+func UpdateNotificationStatus(providerID string, status string, lastError string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewUpdate().
+		Model((*Notification)(nil)).
+		Set("status = ?", status).
+		Set("last_error = COALESCE(NULLIF(?, ''), last_error)", lastError).
+		Where("provider_id = ?", providerID).
+		Exec(ctx)
+
+	return err
+}
+
+// UpdateNodePagerDutyRoutingKey updates the PagerDuty routing key of a node in the db
+func UpdateNodePagerDutyRoutingKey(node Node) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(&node).
+		On("CONFLICT (id) DO UPDATE").
+		Set("pagerduty_routing_key = EXCLUDED.pagerduty_routing_key").
+		Exec(ctx)
+
+	return err
+}
+
+// UpsertChannel adds a channel of a node to the db, or updates the given columns of the channel if
+// it is already there. Columns that are NULL in the new row keep their stored value, and a channel
+// stored as closed is only updated with the details of its close, e.g. not set back to closing
+// while LND still lists a force close as pending
+func UpsertChannel(channel Channel, columns ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	query := Instance.NewInsert().
+		Model(&channel).
+		On("conflict (\"node_id\",\"funding_txid\",\"output_index\") do update").
+		Where("?TableAlias.state IS DISTINCT FROM ? OR EXCLUDED.state = ?", ChannelClosed, ChannelClosed)
+	for _, column := range columns {
+		query = query.Set("? = COALESCE(EXCLUDED.?, ?TableAlias.?)", bun.Ident(column), bun.Ident(column), bun.Ident(column))
+	}
+	_, err := query.Exec(ctx)
+
+	return err
+}
+
+// FindChannelByNodeID gets channel from the db
+func FindChannelByNodeID(id int64) (Channel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var c Channel
+	err := Instance.NewSelect().
+		Model(&c).
+		Where("node_id = ?", id).
+		Scan(ctx, &c)
+
+	return c, err
+}
+
+// FindChannelsByNodeID gets all channels of a node from the db
+func FindChannelsByNodeID(id int64) ([]Channel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var channels []Channel
+	err := Instance.NewSelect().
+		Model(&channels).
+		Where("node_id = ?", id).
+		Scan(ctx, &channels)
+
+	return channels, err
+}
+
+// FindAllChannels gets channel from the db
+func FindAllChannels(ctx context.Context) ([]Channel, error) {
+	var channels []Channel
+	err := Instance.NewSelect().
+		Model(&channels).
+		Scan(ctx, &channels)
+
+	return channels, err
+}
+
+// FindChannelByPoint gets a channel of a node by its funding txid and output index
+func FindChannelByPoint(nodeID int64, txid string, outputIndex int64) (Channel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var channel Channel
+	err := Instance.NewSelect().
+		Model(&channel).
+		Where("node_id = ?", nodeID).
+		Where("funding_txid = ?", txid).
+		Where("output_index = ?", outputIndex).
+		Scan(ctx)
+
+	return channel, err
+}
+
+// InsertChannelBackup adds a static channel backup of a single channel to the database, unless the
+// channel already has a backup, in which case that backup is marked as verified. The backup of a
+// channel only holds what does not change while it is open, but LND encrypts every export with a
+// new nonce, so backups are deduplicated by channel rather than by content
+func InsertChannelBackup(channel Channel, backup string, contentHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	now := time.Now()
+	var latest ChannelBackup
+	err := Instance.NewSelect().
+		Model(&latest).
+		Column("id").
+		Where("channel_id = ?", channel.ID).
+		OrderExpr("created_at DESC").
+		Limit(1).
+		Scan(ctx)
+	if err == nil {
+		latest.LastVerifiedAt = now
+		_, err = Instance.NewUpdate().
+			Model(&latest).
+			Column("last_verified_at").
+			WherePK().
+			Exec(ctx)
+		return err
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	chanBackup, err := encryptChannelBackup(ChannelBackup{
+		CreatedAt:      now,
+		FundingTxid:    channel.FundingTxid,
+		OutputIndex:    channel.OutputIndex,
+		Backup:         backup,
+		ContentHash:    contentHash,
+		LastVerifiedAt: now,
+		ChannelID:      channel.ID,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = Instance.NewInsert().
+		Model(&chanBackup).
+		Exec(ctx)
+
+	return err
+}
+
+// FindChannelBackup gets the most recent backup of a single channel from the db
+func FindChannelBackup(channelID int64) (ChannelBackup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var chanBackup ChannelBackup
+	err := Instance.NewSelect().
+		Model(&chanBackup).
+		Where("channel_id = ?", channelID).
+		OrderExpr("created_at DESC").
+		Limit(1).
+		Scan(ctx)
+
+	return chanBackup, err
+}
+
+// FindAllMultiChannelBackups gets channel from the db
+func FindAllMultiChannelBackups(ctx context.Context) ([]MultiChannelBackup, error) {
+	var channels []MultiChannelBackup
+	err := Instance.NewSelect().
+		Model(&channels).
+		Scan(ctx, &channels)
+
+	return channels, err
+}
+
+// unchangedBackup reports whether a new multi-channel backup is the same as the node's latest
+// backup. LND encrypts every export with a new nonce, so backups of the same channels differ in
+// content; they are the same if they cover the same sorted channel points and the latest backup
+// was verified
+func unchangedBackup(latest MultiChannelBackup, contentHash string, channelPoints string) bool {
+	if latest.ContentHash == contentHash {
+		return true
+	}
+	return latest.Verification == BackupValid && latest.ChannelPoints == channelPoints
+}
+
+// InsertMultiChannelBackup adds a static channel backup of all channels to the database, unless
+// it is the same as the node's latest backup, in which case that backup is marked as verified.
+// channelPoints are the sorted, comma separated channel points in the backup. Returns the stored
+// backup, without its content
+func InsertMultiChannelBackup(backup string, contentHash string, channelPoints string, pubkey string) (MultiChannelBackup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	nodeFromDB, err := FindNodeByPubkey(pubkey)
+	if err != nil {
+		return MultiChannelBackup{}, err
+	}
+
+	now := time.Now()
+	var latest MultiChannelBackup
+	err = Instance.NewSelect().
+		Model(&latest).
+		Column("id", "created_at", "content_hash", "channel_points", "node_id", "verification", "verification_error", "verification_checked_at").
+		Where("node_id = ?", nodeFromDB.ID).
+		OrderExpr("created_at DESC").
+		Limit(1).
+		Scan(ctx)
+	if err == nil && unchangedBackup(latest, contentHash, channelPoints) {
+		latest.LastVerifiedAt = now
+		latest.ChannelPoints = channelPoints
+		_, err = Instance.NewUpdate().
+			Model(&latest).
+			Column("last_verified_at", "channel_points").
+			WherePK().
+			Exec(ctx)
+		return latest, err
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return MultiChannelBackup{}, err
+	}
+
+	multiBackup, err := encryptMultiChannelBackup(MultiChannelBackup{
+		ID:             0,
+		Backup:         backup,
+		ContentHash:    contentHash,
+		ChannelPoints:  channelPoints,
+		NodeID:         nodeFromDB.ID,
+		CreatedAt:      now,
+		LastVerifiedAt: now,
+	})
+	if err != nil {
+		return MultiChannelBackup{}, err
+	}
+	_, err = Instance.NewInsert().
+		Model(&multiBackup).
+		Exec(ctx)
+	multiBackup.Backup = ""
+
+	return multiBackup, err
+}
+
+// UpdateMultiChannelBackupVerification records whether LND could verify a multi-channel backup
+func UpdateMultiChannelBackupVerification(backup MultiChannelBackup) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewUpdate().
+		Model(&backup).
+		Column("verification", "verification_error", "verification_checked_at").
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
+
+// FindLatestMultiChannelBackupVerification gets the latest multi-channel backup of a node with
+// the given verification result, or the latest backup if verification is empty, without its content
+func FindLatestMultiChannelBackupVerification(nodeID int64, verification string) (MultiChannelBackup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var backup MultiChannelBackup
+	query := Instance.NewSelect().
+		Model(&backup).
+		Column("id", "created_at", "last_verified_at", "node_id", "verification", "verification_error", "verification_checked_at").
+		Where("node_id = ?", nodeID)
+	if verification != "" {
+		query = query.Where("verification = ?", verification)
+	}
+	err := query.
+		OrderExpr("created_at DESC").
+		Limit(1).
+		Scan(ctx)
+
+	return backup, err
+}
+
+// FindLatestMultiChannelBackupCoverage gets the latest multi-channel backup of a node whose
+// channel points are known, without its content. Backups stored before channel points were
+// recorded have a NULL channel_points
+func FindLatestMultiChannelBackupCoverage(nodeID int64) (MultiChannelBackup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var backup MultiChannelBackup
+	err := Instance.NewSelect().
+		Model(&backup).
+		Column("id", "created_at", "last_verified_at", "node_id", "channel_points").
+		Where("node_id = ?", nodeID).
+		Where("channel_points IS NOT NULL").
+		OrderExpr("created_at DESC").
+		Limit(1).
+		Scan(ctx)
+
+	return backup, err
+}
+
+// FindMultiChannelBackupVersions gets when each multi-channel backup of a node was taken, oldest
+// first, without the backups themselves
+func FindMultiChannelBackupVersions(nodeID int64) ([]MultiChannelBackup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // todo
+	defer cancel()
+
+	var backups []MultiChannelBackup
+	err := Instance.NewSelect().
+		Model(&backups).
+		Column("id", "created_at", "last_verified_at", "node_id").
+		Where("node_id = ?", nodeID).
+		OrderExpr("created_at ASC, id ASC").
+		Scan(ctx)
+
+	return backups, err
+}
+
+// DeleteMultiChannelBackups removes multi-channel backups from the db
+func DeleteMultiChannelBackups(ids []int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // todo
+	defer cancel()
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result, err := Instance.NewDelete().
+		Model((*MultiChannelBackup)(nil)).
+		Where("id IN (?)", bun.In(ids)).
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// FindChannelBackupVersions gets the id and times of every backup of a channel from the db,
+// oldest first, without their content
+func FindChannelBackupVersions(channelID int64) ([]ChannelBackup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // todo
+	defer cancel()
+
+	var backups []ChannelBackup
+	err := Instance.NewSelect().
+		Model(&backups).
+		Column("id", "created_at", "last_verified_at", "channel_id").
+		Where("channel_id = ?", channelID).
+		OrderExpr("created_at ASC, id ASC").
+		Scan(ctx)
+
+	return backups, err
+}
+
+// DeleteChannelBackups removes backups of single channels from the db
+func DeleteChannelBackups(ids []int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // todo
+	defer cancel()
+
+	if len(ids) == 0 {
+		return 0, nil
 	}
-
-	splits := strings.Split(channel.ChannelPoint, ":")
-	txid := splits[0]
-	output, err := strconv.ParseInt(splits[1], 10, 32)
+	result, err := Instance.NewDelete().
+		Model((*ChannelBackup)(nil)).
+		Where("id IN (?)", bun.In(ids)).
+		Exec(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return result.RowsAffected()
+}
 
-	mychan := &Channel{
-		ID:          0,
-		FundingTxid: txid,
-		OutputIndex: output,
-		NodeID:      nodeFromDB.ID,
-	}
+// FindUnreplicatedMultiChannelBackups gets up to limit multi-channel backups, oldest first, that
+// have not been copied to a replication target yet. Older backups are not backfilled to a new
+// target: only the latest backup of each node, and the backups taken after the first one of the
+// node copied to the target, are returned
+func FindUnreplicatedMultiChannelBackups(target string, limit int) ([]MultiChannelBackup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // todo
+	defer cancel()
 
-	_, err = Instance.NewInsert().
-		Model(mychan).
-		On("conflict (\"funding_txid\",\"output_index\") do nothing").
-		Exec(ctx)
+	var backups []MultiChannelBackup
+	err := Instance.NewSelect().
+		Model(&backups).
+		Where("NOT EXISTS (SELECT 1 FROM backup_replicas AS r WHERE r.backup_id = multi_channel_backup.id AND r.target = ?)", target).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("NOT EXISTS (SELECT 1 FROM multi_channel_backups AS newer WHERE newer.node_id = multi_channel_backup.node_id AND newer.created_at > multi_channel_backup.created_at)").
+				WhereOr("multi_channel_backup.created_at > (SELECT min(b.created_at) FROM backup_replicas AS r JOIN multi_channel_backups AS b ON b.id = r.backup_id WHERE r.target = ? AND b.node_id = multi_channel_backup.node_id)", target)
+		}).
+		OrderExpr("created_at ASC, id ASC").
+		Limit(limit).
+		Scan(ctx)
 
-	return err
+	return backups, err
 }
 
-// FindChannelByNodeID gets channel from the db
-func FindChannelByNodeID(id int64) (Channel, error) {
+// InsertBackupReplica records that a multi-channel backup was copied to a replication target
+func InsertBackupReplica(replica *BackupReplica) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
 	defer cancel()
 
-	var c Channel
-	err := Instance.NewSelect().
-		Model(&c).
-		Where("node_id = ?", id).
-		Scan(ctx, &c)
+	_, err := Instance.NewInsert().
+		Model(replica).
+		Exec(ctx)
 
-	return c, err
+	return err
 }
 
-// FindAllChannels gets channel from the db
-func FindAllChannels(ctx context.Context) ([]Channel, error) {
-	var channels []Channel
-	err := Instance.NewSelect().
-		Model(&channels).
-		Scan(ctx, &channels)
-
-	return channels, err
-}
+// FindMultiChannelBackupByID gets a multi-channel backup from the db
+func FindMultiChannelBackupByID(id int64) (MultiChannelBackup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
 
-// FindAllMultiChannelBackups gets channel from the db
-func FindAllMultiChannelBackups(ctx context.Context) ([]MultiChannelBackup, error) {
-	var channels []MultiChannelBackup
+	var mc MultiChannelBackup
 	err := Instance.NewSelect().
-		Model(&channels).
-		Scan(ctx, &channels)
+		Model(&mc).
+		Where("id = ?", id).
+		Scan(ctx)
 
-	return channels, err
+	return mc, err
 }
 
-// InsertMultiChannelBackup adds a static channel backup of all channels to the database
-func InsertMultiChannelBackup(backup string, pubkey string) error {
+// FindMultiChannelBackupAt gets the multi-channel backup of a node that was current at a time,
+// i.e. the latest backup taken at or before it
+func FindMultiChannelBackupAt(nodeID int64, at time.Time) (MultiChannelBackup, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
 	defer cancel()
 
-	nodeFromDB, err := FindNodeByPubkey(pubkey)
-	if err != nil {
-		return err
-	}
-
-	multiBackup := &MultiChannelBackup{
-		ID:        0,
-		Backup:    backup,
-		NodeID:    nodeFromDB.ID,
-		CreatedAt: time.Now(),
-	}
-	_, err = Instance.NewInsert().
-		Model(multiBackup).
-		Exec(ctx)
+	var mc MultiChannelBackup
+	err := Instance.NewSelect().
+		Model(&mc).
+		Where("node_id = ?", nodeID).
+		Where("created_at <= ?", at).
+		OrderExpr("created_at DESC").
+		Limit(1).
+		Scan(ctx)
 
-	return err
+	return mc, err
 }
 
 // FindMultiChannelBackupByPubkey gets the most recent multi-channel backup from the db
@@ -200,6 +1193,37 @@ func FindUserByID(id int64) (User, error) {
 	return user, err
 }
 
+// FindUserByPhoneNumber gets the user that verified a phone number from the db
+func FindUserByPhoneNumber(phoneNumber string) (User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var user User
+	err := Instance.NewSelect().
+		Model(&user).
+		Where("phone_number = ?", phoneNumber).
+		Where("phone_verified_at IS NOT NULL").
+		Scan(ctx, &user)
+
+	return user, err
+}
+
+// FindUsersByUnverifiedPhoneNumber gets the users that registered a phone number but have not
+// verified it yet from the db
+func FindUsersByUnverifiedPhoneNumber(phoneNumber string) ([]User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var users []User
+	err := Instance.NewSelect().
+		Model(&users).
+		Where("phone_number = ?", phoneNumber).
+		Where("phone_verified_at IS NULL").
+		Scan(ctx, &users)
+
+	return users, err
+}
+
 // FindAllUsers gets users from the db
 func FindAllUsers(ctx context.Context) ([]User, error) {
 	var users []User
@@ -210,6 +1234,112 @@ func FindAllUsers(ctx context.Context) ([]User, error) {
 	return users, err
 }
 
+// UpdateUserPhone updates the phone number of a user, whether it is verified and whether the
+// user receives sms in the db
+func UpdateUserPhone(user User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewUpdate().
+		Model(&user).
+		Column("phone_number", "phone_verified_at", "sms_enabled").
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
+
+// InsertPhoneVerification adds a verification code sent to a user to the db
+func InsertPhoneVerification(verification *PhoneVerification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(verification).
+		Exec(ctx)
+
+	return err
+}
+
+// FindPhoneVerifications gets the verification codes sent to a user since a time from the db,
+// oldest first
+func FindPhoneVerifications(userID int64, since time.Time) ([]PhoneVerification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var verifications []PhoneVerification
+	err := Instance.NewSelect().
+		Model(&verifications).
+		Where("user_id = ?", userID).
+		Where("created_at >= ?", since).
+		Order("id ASC").
+		Scan(ctx, &verifications)
+
+	return verifications, err
+}
+
+// FindPhoneVerificationsByNumber gets the verification codes sent to a phone number since a
+// time from the db, for any user, oldest first
+func FindPhoneVerificationsByNumber(phoneNumber string, since time.Time) ([]PhoneVerification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var verifications []PhoneVerification
+	err := Instance.NewSelect().
+		Model(&verifications).
+		Where("phone_number = ?", phoneNumber).
+		Where("created_at >= ?", since).
+		Order("id ASC").
+		Scan(ctx, &verifications)
+
+	return verifications, err
+}
+
+// FindVerifiedPhoneNumbers gets the phone numbers a user has confirmed a verification code for
+// from the db
+func FindVerifiedPhoneNumbers(userID int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var numbers []string
+	err := Instance.NewSelect().
+		Model((*PhoneVerification)(nil)).
+		ColumnExpr("DISTINCT phone_number").
+		Where("user_id = ?", userID).
+		Where("verified_at IS NOT NULL").
+		Scan(ctx, &numbers)
+
+	return numbers, err
+}
+
+// UpdatePhoneVerification updates the attempts and verification time of a code in the db
+func UpdatePhoneVerification(verification PhoneVerification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewUpdate().
+		Model(&verification).
+		Column("attempts", "verified_at").
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
+
+// UpdateUserSmsEnabled updates whether a user receives sms in the db
+func UpdateUserSmsEnabled(user User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(&user).
+		On("CONFLICT (id) DO UPDATE").
+		Set("sms_enabled = EXCLUDED.sms_enabled").
+		Exec(ctx)
+
+	return err
+}
+
 // UpdateUserLastSent updates user in the db
 func UpdateUserLastSent(user User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
@@ -223,3 +1353,164 @@ func UpdateUserLastSent(user User) error {
 
 	return err
 }
+
+// FindUserByTelegramChatID gets the user linked to a telegram chat from the db
+func FindUserByTelegramChatID(chatID int64) (User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var user User
+	err := Instance.NewSelect().
+		Model(&user).
+		Where("telegram_chat_id = ?", chatID).
+		Scan(ctx, &user)
+
+	return user, err
+}
+
+// FindUserByTelegramLinkCode gets the user that requested a telegram link code from the db
+func FindUserByTelegramLinkCode(code string) (User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var user User
+	err := Instance.NewSelect().
+		Model(&user).
+		Where("telegram_link_code = ?", code).
+		Scan(ctx, &user)
+
+	return user, err
+}
+
+// UpdateUserTelegram updates the telegram chat and link code of a user in the db
+func UpdateUserTelegram(user User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(&user).
+		On("CONFLICT (id) DO UPDATE").
+		Set("telegram_chat_id = EXCLUDED.telegram_chat_id").
+		Set("telegram_link_code = EXCLUDED.telegram_link_code").
+		Exec(ctx)
+
+	return err
+}
+
+// UpdateUserMutedUntil updates the time until which alerts are muted for a user in the db
+func UpdateUserMutedUntil(user User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(&user).
+		On("CONFLICT (id) DO UPDATE").
+		Set("muted_until = EXCLUDED.muted_until").
+		Exec(ctx)
+
+	return err
+}
+
+// UpdateUserPagerDutyRoutingKey updates the PagerDuty routing key of a user in the db
+func UpdateUserPagerDutyRoutingKey(user User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(&user).
+		On("CONFLICT (id) DO UPDATE").
+		Set("pagerduty_routing_key = EXCLUDED.pagerduty_routing_key").
+		Exec(ctx)
+
+	return err
+}
+
+// UpdateUserWebhooks updates the Slack and Discord webhook URLs of a user in the db
+func UpdateUserWebhooks(user User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(&user).
+		On("CONFLICT (id) DO UPDATE").
+		Set("slack_webhook_url = EXCLUDED.slack_webhook_url").
+		Set("discord_webhook_url = EXCLUDED.discord_webhook_url").
+		Exec(ctx)
+
+	return err
+}
+
+// UpdateUserNostr updates the npub and encryption NIP used for nostr direct messages to a user in the db
+func UpdateUserNostr(user User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(&user).
+		On("CONFLICT (id) DO UPDATE").
+		Set("nostr_pubkey = EXCLUDED.nostr_pubkey").
+		Set("nostr_nip = EXCLUDED.nostr_nip").
+		Exec(ctx)
+
+	return err
+}
+
+// FindNostrKey gets the oldest nostr key from the db
+func FindNostrKey() (NostrKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	var key NostrKey
+	err := Instance.NewSelect().
+		Model(&key).
+		OrderExpr("id ASC").
+		Limit(1).
+		Scan(ctx, &key)
+
+	return key, err
+}
+
+// InsertNostrKey adds a nostr key to the db
+func InsertNostrKey(key *NostrKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(key).
+		Exec(ctx)
+
+	return err
+}
+
+// UpdateUserEscalation updates the voice call escalation settings of a user in the db
+func UpdateUserEscalation(user User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(&user).
+		On("CONFLICT (id) DO UPDATE").
+		Set("escalation_delay_minutes = EXCLUDED.escalation_delay_minutes").
+		Set("escalation_phone_numbers = EXCLUDED.escalation_phone_numbers").
+		Exec(ctx)
+
+	return err
+}
+
+// UpdateUserSchedule updates the timezone, report schedule and quiet hours of a user in the db
+func UpdateUserSchedule(user User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second) // todo
+	defer cancel()
+
+	_, err := Instance.NewInsert().
+		Model(&user).
+		On("CONFLICT (id) DO UPDATE").
+		Set("timezone = EXCLUDED.timezone").
+		Set("report_times = EXCLUDED.report_times").
+		Set("report_weekdays = EXCLUDED.report_weekdays").
+		Set("quiet_start = EXCLUDED.quiet_start").
+		Set("quiet_end = EXCLUDED.quiet_end").
+		Exec(ctx)
+
+	return err
+}
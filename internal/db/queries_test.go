@@ -0,0 +1,22 @@
+package db
+
+import "testing"
+
+func TestUnchangedBackup(t *testing.T) {
+	points := "aa:0,bb:1"
+	latest := MultiChannelBackup{ContentHash: "hash", ChannelPoints: points, Verification: BackupValid}
+
+	if !unchangedBackup(latest, "other", points) {
+		t.Error("expected a re-encrypted backup of the same channels to be unchanged")
+	}
+	if unchangedBackup(latest, "other", "aa:0") {
+		t.Error("expected a backup of other channels to be new")
+	}
+	latest.Verification = BackupInvalid
+	if unchangedBackup(latest, "other", points) {
+		t.Error("expected a backup to replace one that failed verification")
+	}
+	if !unchangedBackup(latest, "hash", points) {
+		t.Error("expected a backup with the same content to be unchanged")
+	}
+}
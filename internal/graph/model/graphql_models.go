@@ -15,10 +15,29 @@ type Node struct {
 
 // Channel is a Lightning Channel
 type Channel struct {
-	ID          int64  `json:"id"`
-	FundingTxid string `json:"funding_txid"`
-	OutputIndex int64  `json:"output_index"`
-	NodeID      int64  `json:"node_id"`
+	ID             int64          `json:"id"`
+	FundingTxid    string         `json:"funding_txid"`
+	OutputIndex    int64          `json:"output_index"`
+	NodeID         int64          `json:"node_id"`
+	State          string         `json:"state"`
+	PeerPubkey     string         `json:"peer_pubkey"`
+	Capacity       int64          `json:"capacity"`
+	OpenHeight     int64          `json:"open_height"`
+	Initiator      string         `json:"initiator"`
+	Private        bool           `json:"private"`
+	CloseType      string         `json:"close_type"`
+	ClosingTxid    string         `json:"closing_txid"`
+	CloseHeight    int64          `json:"close_height"`
+	SettledBalance int64          `json:"settled_balance"`
+	Backup         *ChannelBackup `json:"backup"`
+}
+
+// ChannelBackup is the latest backup of a single lightning channel
+type ChannelBackup struct {
+	ID             int64  `json:"id"`
+	CreatedAt      string `json:"created_at"`
+	LastVerifiedAt string `json:"last_verified_at"`
+	Backup         string `json:"backup"`
 }
 
 // MultiChannelBackup is an encrypted backup of a lightning channel state
@@ -39,3 +58,26 @@ type User struct {
 	SmsLastSent   time.Time `json:"sms_last_sent"`
 	SmsNotifyTime time.Time `json:"sms_notify_time"`
 }
+
+// Incident is a critical health check failure of a lightning node. Times are empty until set
+type Incident struct {
+	ID             int64            `json:"id"`
+	NodeID         int64            `json:"node_id"`
+	Alias          string           `json:"alias"`
+	Check          string           `json:"check"`
+	Severity       string           `json:"severity"`
+	Message        string           `json:"message"`
+	State          string           `json:"state"`
+	OpenedAt       string           `json:"opened_at"`
+	AcknowledgedAt string           `json:"acknowledged_at"`
+	AcknowledgedBy string           `json:"acknowledged_by"`
+	ClosedAt       string           `json:"closed_at"`
+	Timeline       []*IncidentEvent `json:"timeline"`
+}
+
+// IncidentEvent is an entry in the timeline of an incident
+type IncidentEvent struct {
+	CreatedAt string `json:"created_at"`
+	Kind      string `json:"kind"`
+	Detail    string `json:"detail"`
+}
@@ -1,5 +1,16 @@
 package graph
 
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/graph/model"
+	"github.com/mvpratt/nodewatcher/internal/incident"
+	"github.com/mvpratt/nodewatcher/internal/middlewares"
+)
+
 //go:generate go run github.com/99designs/gqlgen generate
 
 // This file will not be regenerated automatically.
@@ -7,3 +18,61 @@ package graph
 // Resolver serves as dependency injection for your app, add any dependencies you require here.
 type Resolver struct {
 }
+
+// incidentLimit is how many of the most recent incidents the incidents query returns
+const incidentLimit = 100
+
+// errUnauthenticated is returned by resolvers that need the JWT of a user
+var errUnauthenticated = errors.New("request does not contain a valid access token")
+
+// authenticatedUser returns the user the JWT of a request was issued to
+func authenticatedUser(ctx context.Context) (db.User, error) {
+	claims, ok := middlewares.ForContext(ctx)
+	if !ok {
+		return db.User{}, errUnauthenticated
+	}
+	user, err := db.FindUserByEmail(claims.Email)
+	if err != nil {
+		return db.User{}, errUnauthenticated
+	}
+	return user, nil
+}
+
+// formatTime formats a time for the schema, or returns an empty string for the zero time
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC850)
+}
+
+// graphIncident converts an incident and its timeline to its graphql model
+func graphIncident(i db.Incident, alias string) (*model.Incident, error) {
+	events, err := db.FindIncidentEvents(i.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &model.Incident{
+		ID:             i.ID,
+		NodeID:         i.NodeID,
+		Alias:          alias,
+		Check:          i.CheckName,
+		Severity:       i.Severity,
+		Message:        i.Message,
+		State:          incident.State(i),
+		OpenedAt:       formatTime(i.OpenedAt),
+		AcknowledgedAt: formatTime(i.AcknowledgedAt),
+		AcknowledgedBy: i.AcknowledgedBy,
+		ClosedAt:       formatTime(i.ClosedAt),
+		Timeline:       []*model.IncidentEvent{},
+	}
+	for _, event := range events {
+		g.Timeline = append(g.Timeline, &model.IncidentEvent{
+			CreatedAt: formatTime(event.CreatedAt),
+			Kind:      event.Kind,
+			Detail:    event.Detail,
+		})
+	}
+	return g, nil
+}
@@ -6,11 +6,15 @@ package graph
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
 	"github.com/mvpratt/nodewatcher/internal/db"
 	"github.com/mvpratt/nodewatcher/internal/graph/model"
+	"github.com/mvpratt/nodewatcher/internal/incident"
+	"github.com/mvpratt/nodewatcher/internal/phone"
+	"github.com/mvpratt/nodewatcher/internal/util"
 )
 
 // CreatedAt is the resolver for the created_at field.
@@ -20,6 +24,10 @@ func (r *multiChannelBackupResolver) CreatedAt(ctx context.Context, obj *model.M
 
 // CreateNode is the resolver for the createNode field.
 func (r *mutationResolver) CreateNode(ctx context.Context, input model.NewNode) (*model.Node, error) {
+	if err := util.ValidatePubkey(input.Pubkey); err != nil {
+		return nil, err
+	}
+
 	node := &model.Node{
 		ID:       int64(input.ID),
 		URL:      input.URL,
@@ -58,12 +66,22 @@ func (r *mutationResolver) CreateUser(ctx context.Context, input model.NewUser)
 		log.Print(err.Error())
 	}
 
+	// the phone number is optional, like in the REST API, and can be set later
+	phoneNumber := input.PhoneNumber
+	if phoneNumber != "" {
+		phoneNumber, err = phone.Normalize(phoneNumber)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// sms can only be enabled once the phone number is verified
 	user := &model.User{
 		ID:            int64(input.ID),
 		Email:         input.Email,
 		Password:      input.Password,
-		PhoneNumber:   input.PhoneNumber,
-		SmsEnabled:    input.SmsEnabled,
+		PhoneNumber:   phoneNumber,
+		SmsEnabled:    false,
 		SmsLastSent:   lastSent,
 		SmsNotifyTime: notifyTime, // todo - notify hour (int)
 	}
@@ -72,8 +90,8 @@ func (r *mutationResolver) CreateUser(ctx context.Context, input model.NewUser)
 		ID:            0,
 		Email:         input.Email,
 		Password:      input.Password,
-		PhoneNumber:   input.PhoneNumber,
-		SmsEnabled:    input.SmsEnabled,
+		PhoneNumber:   phoneNumber,
+		SmsEnabled:    false,
 		SmsLastSent:   lastSent,
 		SmsNotifyTime: notifyTime,
 	}
@@ -85,6 +103,28 @@ func (r *mutationResolver) CreateUser(ctx context.Context, input model.NewUser)
 	return user, nil
 }
 
+// AcknowledgeIncident is the resolver for the acknowledgeIncident field.
+func (r *mutationResolver) AcknowledgeIncident(ctx context.Context, id int) (*model.Incident, error) {
+	user, err := authenticatedUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	i, err := db.FindIncidentByID(int64(id))
+	if err != nil {
+		return nil, err
+	}
+	node, ok := incident.FindNode(user, i.NodeID)
+	if !ok {
+		return nil, errors.New("incident not found")
+	}
+
+	i, err = incident.Acknowledge(i, user.Email+" via graphql")
+	if err != nil {
+		return nil, err
+	}
+	return graphIncident(i, node.Alias)
+}
+
 // Nodes is the resolver for the nodes field.
 func (r *queryResolver) Nodes(ctx context.Context) ([]*model.Node, error) {
 	nodes, err := db.FindAllNodes(ctx)
@@ -112,20 +152,50 @@ func (r *queryResolver) Nodes(ctx context.Context) ([]*model.Node, error) {
 
 // Channels is the resolver for the channels field.
 func (r *queryResolver) Channels(ctx context.Context) ([]*model.Channel, error) {
-	channels, err := db.FindAllChannels(ctx)
+	user, err := authenticatedUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := db.FindNodesByUserID(user.ID)
 	if err != nil {
 		return nil, err
 	}
+	var channels []db.Channel
+	for _, node := range nodes {
+		nodeChannels, err := db.FindChannelsByNodeID(node.ID)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, nodeChannels...)
+	}
 
 	var graphChannels []*model.Channel
 
 	var g *model.Channel
 	for _, channel := range channels {
 		g = &model.Channel{
-			ID:          channel.ID,
-			FundingTxid: channel.FundingTxid,
-			OutputIndex: channel.OutputIndex,
-			NodeID:      channel.NodeID,
+			ID:             channel.ID,
+			FundingTxid:    channel.FundingTxid,
+			OutputIndex:    channel.OutputIndex,
+			NodeID:         channel.NodeID,
+			State:          channel.State,
+			PeerPubkey:     channel.PeerPubkey,
+			Capacity:       channel.Capacity,
+			OpenHeight:     channel.OpenHeight,
+			Initiator:      channel.Initiator,
+			Private:        channel.Private,
+			CloseType:      channel.CloseType,
+			ClosingTxid:    channel.ClosingTxid,
+			CloseHeight:    channel.CloseHeight,
+			SettledBalance: channel.SettledBalance,
+		}
+		if backup, err := db.FindChannelBackup(channel.ID); err == nil {
+			g.Backup = &model.ChannelBackup{
+				ID:             backup.ID,
+				CreatedAt:      formatTime(backup.CreatedAt),
+				LastVerifiedAt: formatTime(backup.LastVerifiedAt),
+				Backup:         backup.Backup,
+			}
 		}
 		graphChannels = append(graphChannels, g)
 	}
@@ -179,6 +249,38 @@ func (r *queryResolver) Users(ctx context.Context) ([]*model.User, error) {
 	return graphUsers, nil
 }
 
+// Incidents is the resolver for the incidents field.
+func (r *queryResolver) Incidents(ctx context.Context) ([]*model.Incident, error) {
+	user, err := authenticatedUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := incident.Nodes(user)
+	if err != nil {
+		return nil, err
+	}
+	nodeIDs := make([]int64, 0, len(nodes))
+	aliases := make(map[int64]string)
+	for _, node := range nodes {
+		nodeIDs = append(nodeIDs, node.ID)
+		aliases[node.ID] = node.Alias
+	}
+	incidents, err := db.FindIncidentsByNodeIDs(nodeIDs, incidentLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	graphIncidents := []*model.Incident{}
+	for _, i := range incidents {
+		g, err := graphIncident(i, aliases[i.NodeID])
+		if err != nil {
+			return nil, err
+		}
+		graphIncidents = append(graphIncidents, g)
+	}
+	return graphIncidents, nil
+}
+
 // SmsNotifyTime is the resolver for the sms_notify_time field.
 func (r *userResolver) SmsNotifyTime(ctx context.Context, obj *model.User) (string, error) {
 	return obj.SmsNotifyTime.Format(time.RFC850), nil
@@ -0,0 +1,340 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lightninglabs/lndclient"
+	"github.com/mvpratt/nodewatcher/internal/backup"
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/incident"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+	"github.com/mvpratt/nodewatcher/internal/schedule"
+	"github.com/mvpratt/nodewatcher/internal/silence"
+	"github.com/mvpratt/nodewatcher/internal/templates"
+)
+
+// Names of the health checks run against each node
+const (
+	CheckNodeDown   = "node_down"
+	CheckChainSync  = "synced_to_chain"
+	CheckGraphSync  = "synced_to_graph"
+	CheckForceClose = "force_close"
+	CheckBackup     = "channel_backup"
+	CheckCoverage   = "backup_coverage"
+)
+
+// maxListedChannels is the most uncovered channel points listed in a backup coverage alert
+const maxListedChannels = 3
+
+// checkResult is the outcome of a single health check
+type checkResult struct {
+	name     string
+	severity notify.Severity
+	failing  bool
+	message  string
+}
+
+// evaluateChecks runs the health checks against the state of a node. The force close check
+// is skipped if the pending channels are unknown
+func evaluateChecks(info *lndclient.Info, pending *lndclient.PendingChannels) []checkResult {
+	chainSync := checkResult{name: CheckChainSync, severity: notify.SeverityWarning, message: "Lightning node is fully synced."}
+	if !info.SyncedToChain {
+		chainSync.failing = true
+		chainSync.message = "Lightning node is not fully synced."
+	}
+
+	graphSync := checkResult{name: CheckGraphSync, severity: notify.SeverityWarning, message: "Network graph is fully synced."}
+	if !info.SyncedToGraph {
+		graphSync.failing = true
+		graphSync.message = "Network graph is not fully synced."
+	}
+
+	nodeUp := checkResult{name: CheckNodeDown, severity: notify.SeverityCritical, message: "Lightning node is reachable."}
+	results := []checkResult{nodeUp, chainSync, graphSync}
+
+	if pending != nil {
+		forceClose := checkResult{name: CheckForceClose, severity: notify.SeverityCritical, message: "No channels are being force closed."}
+		if count := len(pending.PendingForceClose); count > 0 {
+			forceClose.failing = true
+			forceClose.message = fmt.Sprintf("%d channel(s) are being force closed.", count)
+		}
+		results = append(results, forceClose)
+	}
+	return results
+}
+
+// evaluateBackup checks that the latest multi-channel backup of a node passed verification by
+// LND, and that a verified backup was current within MaxBackupAge. The check is skipped until the
+// node has a backup that LND was asked to verify
+func evaluateBackup(latest db.MultiChannelBackup, lastValid db.MultiChannelBackup, now time.Time) (checkResult, bool) {
+	result := checkResult{name: CheckBackup, severity: notify.SeverityCritical, message: "Channel backup is verified."}
+	switch {
+	case latest.ID == 0 || latest.Verification == "":
+		return result, false
+	case latest.Verification == db.BackupInvalid:
+		result.failing = true
+		result.message = fmt.Sprintf("Channel backup failed verification: %s", latest.VerificationError)
+	case lastValid.ID == 0:
+		result.failing = true
+		result.message = "No channel backup has been verified."
+	case now.Sub(lastValid.VerifiedAt()) > MaxBackupAge:
+		result.failing = true
+		result.message = fmt.Sprintf("No verified channel backup in %s.", now.Sub(lastValid.VerifiedAt()).Round(time.Hour))
+	}
+	return result, true
+}
+
+// backupCheck runs the channel backup check against the stored backups of a node
+func backupCheck(node db.Node) (checkResult, bool) {
+	latest, err := db.FindLatestMultiChannelBackupVerification(node.ID, "")
+	if err != nil {
+		return checkResult{}, false
+	}
+	lastValid, _ := db.FindLatestMultiChannelBackupVerification(node.ID, db.BackupValid)
+	return evaluateBackup(latest, lastValid, time.Now().UTC())
+}
+
+// coverageGrace is how long a new channel may be missing from the channel backup, so a channel
+// opened since the last backup poll does not fail the coverage check
+const coverageGrace = backup.DefaultPollInterval
+
+// evaluateCoverage checks that every channel open on a node is in the multi-channel backup that
+// covers the most channels, i.e. its latest backup. covered is the latest backup whose channel
+// points are known, and the check is skipped while that is not the latest backup. Channels first
+// seen less than coverageGrace ago, or not stored yet, are not reported missing
+func evaluateCoverage(open []string, latest db.MultiChannelBackup, covered db.MultiChannelBackup, firstSeen map[string]time.Time, now time.Time) (checkResult, bool) {
+	result := checkResult{name: CheckCoverage, severity: notify.SeverityCritical, message: "All channels are in the channel backup."}
+	if latest.ID != covered.ID {
+		return result, false
+	}
+
+	inBackup := make(map[string]bool)
+	if covered.ChannelPoints != "" {
+		for _, point := range strings.Split(covered.ChannelPoints, ",") {
+			inBackup[point] = true
+		}
+	}
+	var missing []string
+	for _, point := range open {
+		seen, ok := firstSeen[point]
+		if !inBackup[point] && ok && now.Sub(seen) >= coverageGrace {
+			missing = append(missing, point)
+		}
+	}
+	if len(missing) == 0 {
+		return result, true
+	}
+
+	listed := strings.Join(missing, ", ")
+	if len(missing) > maxListedChannels {
+		listed = fmt.Sprintf("%s and %d more", strings.Join(missing[:maxListedChannels], ", "), len(missing)-maxListedChannels)
+	}
+	result.failing = true
+	result.message = fmt.Sprintf("%d channel(s) are not in any stored channel backup: %s", len(missing), listed)
+	return result, true
+}
+
+// coverageCheck runs the backup coverage check against the open and pending channels of a node
+func coverageCheck(node db.Node, client lndclient.LightningClient, pending *lndclient.PendingChannels) (checkResult, bool) {
+	open, err := openChannelPoints(client, pending)
+	if err != nil {
+		log.Printf("Error getting channels of LND node %s: %s", node.Alias, err)
+		return checkResult{}, false
+	}
+	channels, err := db.FindChannelsByNodeID(node.ID)
+	if err != nil {
+		log.Printf("Error getting channels of LND node %s: %s", node.Alias, err)
+		return checkResult{}, false
+	}
+	firstSeen := make(map[string]time.Time)
+	for _, channel := range channels {
+		firstSeen[fmt.Sprintf("%s:%d", channel.FundingTxid, channel.OutputIndex)] = channel.CreatedAt
+	}
+	latest, _ := db.FindLatestMultiChannelBackupVerification(node.ID, "")
+	covered, _ := db.FindLatestMultiChannelBackupCoverage(node.ID)
+	return evaluateCoverage(open, latest, covered, firstSeen, time.Now().UTC())
+}
+
+// saveSnapshot stores the latest snapshot of a node, e.g. to preview notification templates
+func saveSnapshot(node db.Node, snapshot *notify.Snapshot) {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return
+	}
+	err = db.UpsertNodeSnapshot(&db.NodeSnapshot{NodeID: node.ID, TakenAt: time.Now().UTC(), Snapshot: string(data)})
+	if err != nil {
+		log.Printf("Error saving snapshot of LND node %s: %s", node.Alias, err)
+	}
+}
+
+func newSnapshot(info *lndclient.Info) *notify.Snapshot {
+	return &notify.Snapshot{
+		SyncedToChain:    info.SyncedToChain,
+		SyncedToGraph:    info.SyncedToGraph,
+		BlockHeight:      info.BlockHeight,
+		ActiveChannels:   info.ActiveChannels,
+		InactiveChannels: info.InactiveChannels,
+		PendingChannels:  info.PendingChannels,
+	}
+}
+
+// changedChecks returns the results that differ from the last known state of each check.
+// A check without a previous result is assumed to have been passing
+func changedChecks(previous []db.NodeCheck, results []checkResult) []checkResult {
+	failing := make(map[string]bool)
+	for _, check := range previous {
+		failing[check.Name] = check.Failing
+	}
+
+	var changed []checkResult
+	for _, result := range results {
+		if failing[result.name] != result.failing {
+			changed = append(changed, result)
+		}
+	}
+	return changed
+}
+
+// notifyAll sends an alert over every notifier, with the user's templates applied, and returns
+// the channels it was sent over. Notifiers the user has not configured are skipped
+func notifyAll(notifiers []notify.Notifier, user db.User, userTemplates *templates.Set, alert notify.Alert) []string {
+	var channels []string
+	for _, notifier := range notifiers {
+		err := notifier.Notify(user, userTemplates.ApplyTo(notifier, alert))
+		if errors.Is(err, notify.ErrNotConfigured) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error notifying user %s: %s", user.Email, err)
+			continue
+		}
+		if n, ok := notifier.(notify.ChannelNotifier); ok {
+			channels = append(channels, n.Channel())
+		}
+	}
+	return channels
+}
+
+// sentDetail is the incident timeline entry for an alert sent over channels
+func sentDetail(event notify.Event, channels []string) string {
+	return fmt.Sprintf("%s alert sent over %s", event, strings.Join(channels, ", "))
+}
+
+// incidentNotifiers returns the notifiers that keep an incident open until it is resolved
+func incidentNotifiers(notifiers []notify.Notifier) []notify.Notifier {
+	var tracking []notify.Notifier
+	for _, notifier := range notifiers {
+		if n, ok := notifier.(notify.IncidentNotifier); ok && n.TracksIncidents() {
+			tracking = append(tracking, notifier)
+		}
+	}
+	return tracking
+}
+
+// trackIncident opens an incident for a critical check that started failing and closes the
+// incident of a check that recovered. It returns the incident the alert about the check belongs to
+func trackIncident(node db.Node, result checkResult) (db.Incident, bool) {
+	if !result.failing {
+		open, ok := incident.Find(node.ID, result.name)
+		if ok {
+			if err := incident.Close(node.ID, result.name, result.message); err != nil {
+				log.Printf("Error closing incident %d of LND node %s: %s", open.ID, node.Alias, err)
+			}
+		}
+		return open, ok
+	}
+	if result.severity != notify.SeverityCritical {
+		return db.Incident{}, false
+	}
+	open, err := incident.Open(node, result.name, string(result.severity), result.message)
+	if err != nil {
+		log.Printf("Error opening incident for %s of LND node %s: %s", result.name, node.Alias, err)
+		return open, false
+	}
+	return open, true
+}
+
+// updateChecks stores the check results of a node and alerts the user about every check
+// that started failing or recovered. Only critical checks are alerted during quiet hours, and
+// alerts matched by an active silence are recorded instead of sent. Resolves that are held back
+// are still sent to notifiers that track incidents, so an incident opened before is not left
+// open. Critical failures open an incident whose timeline records what happened to each alert
+func updateChecks(notifiers []notify.Notifier, user db.User, node db.Node, snapshot *notify.Snapshot, results []checkResult) {
+	previous, err := db.FindNodeChecks(node.ID)
+	if err != nil {
+		log.Printf("Error getting health checks of LND node %s: %s", node.Alias, err)
+		return
+	}
+
+	muted := time.Now().Before(user.MutedUntil)
+	sched, _ := schedule.FromUser(user)
+	quiet := sched.Quiet(time.Now())
+	silences, _ := db.FindSilencesByUserID(user.ID)
+	userTemplates := templates.Load(user)
+	for _, result := range changedChecks(previous, results) {
+		err := db.UpsertNodeCheck(&db.NodeCheck{
+			NodeID:    node.ID,
+			Name:      result.name,
+			Severity:  string(result.severity),
+			Failing:   result.failing,
+			Message:   result.message,
+			ChangedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			log.Printf("Error saving health check %s of LND node %s: %s", result.name, node.Alias, err)
+			continue
+		}
+
+		alert := notify.Alert{
+			Node:     node,
+			Event:    notify.EventTrigger,
+			Check:    result.name,
+			Severity: result.severity,
+			Message:  warning(result.message),
+			Snapshot: snapshot,
+		}
+		if !result.failing {
+			alert.Event = notify.EventResolve
+			alert.Severity = notify.SeverityInfo
+			alert.Message = fmt.Sprintf("\n\nRESOLVED: %s", result.message)
+		}
+		log.Printf("\nHealth check %s of LND node %s: %s", result.name, node.Alias, alert.Event)
+		open, tracked := trackIncident(node, result)
+
+		var detail string
+		if s, silenced := silence.Find(silences, node.ID, result.name, time.Now().UTC()); silenced {
+			suppress(s, alert)
+			detail = fmt.Sprintf("%s alert suppressed by %s %d", alert.Event, s.Kind, s.ID)
+		} else if muted {
+			detail = fmt.Sprintf("%s alert not sent, alerts muted until %s", alert.Event, user.MutedUntil.Format(time.RFC850))
+		} else if quiet && result.severity != notify.SeverityCritical {
+			detail = fmt.Sprintf("%s alert not sent during quiet hours", alert.Event)
+		} else if channels := notifyAll(notifiers, user, userTemplates, alert); len(channels) > 0 && tracked {
+			incident.Record(open, incident.EventNotified, sentDetail(alert.Event, channels))
+		}
+		if detail != "" && tracked {
+			incident.Record(open, incident.EventSuppressed, detail)
+		}
+		if detail != "" && alert.Event == notify.EventResolve {
+			if channels := notifyAll(incidentNotifiers(notifiers), user, userTemplates, alert); len(channels) > 0 && tracked {
+				incident.Record(open, incident.EventNotified, sentDetail(alert.Event, channels))
+			}
+		}
+	}
+}
+
+// Unreachable records that an LND node could not be reached and alerts its owner
+func Unreachable(notifiers []notify.Notifier, node db.Node, reason error) {
+	user, _ := db.FindUserByID(node.UserID)
+	updateChecks(notifiers, user, node, nil, []checkResult{{
+		name:     CheckNodeDown,
+		severity: notify.SeverityCritical,
+		failing:  true,
+		message:  fmt.Sprintf("Lightning node is unreachable: %s", reason),
+	}})
+}
@@ -12,8 +12,8 @@ import (
 
 	"github.com/lightninglabs/lndclient"
 	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/notify"
 	twilio "github.com/twilio/twilio-go"
-	openapi "github.com/twilio/twilio-go/rest/api/v2010"
 )
 
 // GithubLatestReleaseResponse is the response from the Github API
@@ -35,14 +35,6 @@ type MonitorParams struct {
 	NotifyTime int
 }
 
-// SmsDetails contains the parameters for sending an SMS message
-type SmsDetails struct {
-	To           string
-	From         string
-	Body         string
-	TwilioClient *twilio.RestClient
-}
-
 // Get latest release tag from Github
 func getLatestReleaseTag(org string, repo string) (string, error) {
 	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", org, repo)
@@ -70,20 +62,6 @@ func compareVersions(githubTag string, lndVersionString string) bool {
 	return githubTag == lndVersionString
 }
 
-// Send a text message
-func sendSMS(details SmsDetails) error {
-	params := &openapi.CreateMessageParams{}
-	params.SetTo(details.To)
-	params.SetFrom(details.From)
-	params.SetBody(details.Body)
-
-	_, err := details.TwilioClient.Api.CreateMessage(params)
-	if err != nil {
-		return fmt.Errorf("%s", err.Error())
-	}
-	return nil
-}
-
 func warning(warn string) string {
 	return fmt.Sprintf("\n\nWARNING: %s", warn)
 }
@@ -130,8 +108,81 @@ func getNodeInfo(client lndclient.LightningClient) (*lndclient.Info, error) {
 	return client.GetInfo(ctx)
 }
 
-// Check node status, send a text message if user has SMS enabled
-func Check(twilioConfig TwilioConfig, node db.Node, lndClient *lndclient.LightningClient) error {
+// getPendingChannels - Get channels that are being opened or closed from lnd
+func getPendingChannels(client lndclient.LightningClient) (*lndclient.PendingChannels, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return client.PendingChannels(ctx)
+}
+
+// openChannelPoints gets the channel points of the channels of a node that LND keeps in its
+// channel backup: open channels, channels being opened and channels waiting to close
+func openChannelPoints(client lndclient.LightningClient, pending *lndclient.PendingChannels) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	channels, err := client.ListChannels(ctx, false, false)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]string, 0, len(channels)+len(pending.PendingOpen)+len(pending.WaitingClose))
+	for _, channel := range channels {
+		points = append(points, channel.ChannelPoint)
+	}
+	for _, channel := range pending.PendingOpen {
+		points = append(points, channel.ChannelPoint.String())
+	}
+	for _, channel := range pending.WaitingClose {
+		points = append(points, channel.ChannelPoint.String())
+	}
+	return points, nil
+}
+
+// Status gets the current status message of an LND node
+func Status(lndClient *lndclient.LightningClient) (string, error) {
+	nodeInfo, err := getNodeInfo(*lndClient)
+	if err != nil {
+		return "", err
+	}
+	return generateStatusMessage(nodeInfo)
+}
+
+// GetSnapshot gets the current state of an LND node, including its balances and the time of
+// its last multi-channel backup
+func GetSnapshot(node db.Node, lndClient *lndclient.LightningClient) (*notify.Snapshot, error) {
+	nodeInfo, err := getNodeInfo(*lndClient)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := newSnapshot(nodeInfo)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	channelBalance, err := (*lndClient).ChannelBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.ChannelBalance = int64(channelBalance.Balance)
+	snapshot.PendingChannelBalance = int64(channelBalance.PendingBalance)
+
+	walletBalance, err := (*lndClient).WalletBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.WalletBalance = int64(walletBalance.Confirmed)
+	snapshot.UnconfirmedBalance = int64(walletBalance.Unconfirmed)
+
+	lastBackup, err := db.FindMultiChannelBackupByPubkey(node.Pubkey)
+	if err == nil {
+		snapshot.LastBackup = lastBackup.VerifiedAt()
+	}
+	return snapshot, nil
+}
+
+// Check node status and alert the user when a health check starts failing or recovers. Status
+// reports are sent separately for all of a user's nodes by SendReports
+func Check(notifiers []notify.Notifier, node db.Node, lndClient *lndclient.LightningClient) error {
 	log.Printf("\nChecking node status: %s", node.Alias)
 
 	user, _ := db.FindUserByID(node.UserID)
@@ -141,32 +192,30 @@ func Check(twilioConfig TwilioConfig, node db.Node, lndClient *lndclient.Lightni
 
 	nodeInfo, err := getNodeInfo(*lndClient)
 	if err != nil {
+		Unreachable(notifiers, node, err)
 		return err
 	}
-
-	statusMsg, err := generateStatusMessage(nodeInfo)
+	pending, err := getPendingChannels(*lndClient)
 	if err != nil {
-		return err
+		log.Printf("Error getting pending channels of LND node %s: %s", node.Alias, err)
 	}
 
-	sendWindow := time.Now().UTC().Hour() == user.SmsNotifyTime.Hour() // 1-hour notify window
-	alreadySent := time.Since(user.SmsLastSent) < time.Hour*24         // only send once per 24 hours
-
-	// todo - check for twilio env vars before trying to send SMS
-	if sendWindow && user.SmsEnabled && !alreadySent {
-		smsDetails := SmsDetails{
-			To:           user.PhoneNumber,
-			From:         twilioConfig.From,
-			Body:         statusMsg,
-			TwilioClient: twilioConfig.TwilioClient,
-		}
-		err := sendSMS(smsDetails)
-		if err != nil {
-			return err
+	snapshot := newSnapshot(nodeInfo)
+	saveSnapshot(node, snapshot)
+	results := evaluateChecks(nodeInfo, pending)
+	if result, ok := backupCheck(node); ok {
+		results = append(results, result)
+	}
+	if pending != nil {
+		if result, ok := coverageCheck(node, *lndClient, pending); ok {
+			results = append(results, result)
 		}
-		log.Println("\nSMS sent successfully!")
-		user.SmsLastSent = time.Now().UTC()
-		db.UpdateUserLastSent(user)
+	}
+	updateChecks(notifiers, user, node, snapshot, results)
+
+	statusMsg, err := generateStatusMessage(nodeInfo)
+	if err != nil {
+		return err
 	}
 	log.Println(statusMsg)
 	return nil
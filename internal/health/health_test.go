@@ -1,10 +1,18 @@
 package health
 
 import (
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/lightninglabs/lndclient"
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/nostr"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+	"github.com/mvpratt/nodewatcher/internal/pagerduty"
+	"github.com/mvpratt/nodewatcher/internal/templates"
+	"github.com/mvpratt/nodewatcher/internal/webhook"
 )
 
 // Assumes:
@@ -44,3 +52,290 @@ func TestGenerateStatusMessage(t *testing.T) {
 	}
 
 }
+
+func TestChangedChecks(t *testing.T) {
+	info := &lndclient.Info{SyncedToChain: false, SyncedToGraph: true}
+	results := evaluateChecks(info, nil)
+
+	changed := changedChecks(nil, results)
+	if len(changed) != 1 || changed[0].name != CheckChainSync {
+		t.Errorf("expected only %s to trigger, got %+v", CheckChainSync, changed)
+	}
+
+	previous := []db.NodeCheck{
+		{Name: CheckChainSync, Failing: true},
+		{Name: CheckNodeDown, Failing: true},
+	}
+	changed = changedChecks(previous, results)
+	if len(changed) != 1 || changed[0].name != CheckNodeDown || changed[0].failing {
+		t.Errorf("expected only %s to resolve, got %+v", CheckNodeDown, changed)
+	}
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Notify(user db.User, alert notify.Alert) error { return nil }
+
+func TestIncidentNotifiers(t *testing.T) {
+	pd := pagerduty.NewNotifier("")
+	tracking := incidentNotifiers([]notify.Notifier{logNotifier{}, pd})
+	if len(tracking) != 1 || tracking[0] != notify.Notifier(pd) {
+		t.Errorf("expected only the PagerDuty notifier to receive held back resolves, got %+v", tracking)
+	}
+}
+
+// telegramNotifier stands in for the Telegram bot, failing with err
+type telegramNotifier struct{ err error }
+
+func (n telegramNotifier) Notify(user db.User, alert notify.Alert) error { return n.err }
+
+func (telegramNotifier) Channel() string { return notify.ChannelTelegram }
+
+func TestNotifyAllSkipsUnconfigured(t *testing.T) {
+	user := db.User{Email: "alice@example.com", TelegramChatID: 42}
+	alert := notify.Alert{Event: notify.EventTrigger, Check: CheckNodeDown, Severity: notify.SeverityCritical}
+	unconfigured := []notify.Notifier{
+		webhook.NewSlackNotifier(""),
+		webhook.NewDiscordNotifier(""),
+		nostr.NewNotifier(nil, nil),
+		pagerduty.NewNotifier(""),
+	}
+
+	// the user only linked Telegram, so when Telegram fails nothing was delivered and the
+	// text message falls back to every notifier
+	notifiers := append([]notify.Notifier{telegramNotifier{errors.New("telegram is down")}}, unconfigured...)
+	if channels := notifyAll(notifiers, user, &templates.Set{}, alert); len(channels) != 0 {
+		t.Errorf("expected no channels to deliver the alert, got %v", channels)
+	}
+
+	notifiers = append([]notify.Notifier{telegramNotifier{}}, unconfigured...)
+	channels := notifyAll(notifiers, user, &templates.Set{}, alert)
+	if len(channels) != 1 || channels[0] != notify.ChannelTelegram {
+		t.Errorf("expected only telegram to deliver the alert, got %v", channels)
+	}
+}
+
+func TestSentDetailTelegramOnly(t *testing.T) {
+	user := db.User{Email: "alice@example.com", TelegramChatID: 42}
+	notifiers := []notify.Notifier{
+		telegramNotifier{},
+		webhook.NewSlackNotifier(""),
+		webhook.NewDiscordNotifier(""),
+		nostr.NewNotifier(nil, nil),
+		pagerduty.NewNotifier(""),
+	}
+	alert := notify.Alert{Event: notify.EventTrigger, Check: CheckNodeDown, Severity: notify.SeverityCritical}
+
+	detail := sentDetail(alert.Event, notifyAll(notifiers, user, &templates.Set{}, alert))
+	if detail != "trigger alert sent over telegram" {
+		t.Errorf("expected the timeline to only list telegram, got %q", detail)
+	}
+}
+
+func TestEscalationDue(t *testing.T) {
+	failedAt := time.Date(2023, 3, 1, 3, 0, 0, 0, time.UTC)
+	check := db.NodeCheck{Name: CheckNodeDown, Severity: "critical", Failing: true, ChangedAt: failedAt}
+	delay := 10 * time.Minute
+
+	if escalationDue(check, delay, failedAt.Add(5*time.Minute)) {
+		t.Error("expected no call before the delay")
+	}
+	if !escalationDue(check, delay, failedAt.Add(10*time.Minute)) {
+		t.Error("expected first call after the delay")
+	}
+
+	check.EscalationStep = 1
+	if escalationDue(check, delay, failedAt.Add(15*time.Minute)) {
+		t.Error("expected second call to wait for another delay")
+	}
+	if !escalationDue(check, delay, failedAt.Add(20*time.Minute)) {
+		t.Error("expected second call after two delays")
+	}
+
+	check.AcknowledgedAt = failedAt.Add(12 * time.Minute)
+	if escalationDue(check, delay, failedAt.Add(20*time.Minute)) {
+		t.Error("expected no calls after acknowledgement")
+	}
+}
+
+func TestEscalationChain(t *testing.T) {
+	user := db.User{PhoneNumber: "+15555555555", EscalationPhoneNumbers: "+15555550001, +15555550002"}
+	verified := map[string]bool{"+15555550002": true}
+
+	chain := escalationChain(user, verified)
+	if len(chain) != 1 || chain[0] != "+15555550002" {
+		t.Errorf("expected only the verified escalation number, got %v", chain)
+	}
+
+	user.PhoneVerifiedAt = time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	chain = escalationChain(user, verified)
+	if len(chain) != 2 || chain[0] != "+15555555555" {
+		t.Errorf("expected the verified primary number first, got %v", chain)
+	}
+	if chain := escalationChain(db.User{}, verified); len(chain) != 0 {
+		t.Errorf("expected no calls without a phone number, got %v", chain)
+	}
+}
+
+func TestEvaluateBackup(t *testing.T) {
+	now := time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC)
+	valid := db.MultiChannelBackup{ID: 1, Verification: db.BackupValid, LastVerifiedAt: now.Add(-time.Hour)}
+
+	if _, ok := evaluateBackup(db.MultiChannelBackup{ID: 2}, db.MultiChannelBackup{}, now); ok {
+		t.Error("expected the check to wait for the first verification")
+	}
+	if result, ok := evaluateBackup(valid, valid, now); !ok || result.failing {
+		t.Errorf("expected a recently verified backup to pass, got %+v", result)
+	}
+
+	invalid := db.MultiChannelBackup{ID: 2, Verification: db.BackupInvalid, VerificationError: "unable to unpack"}
+	result, _ := evaluateBackup(invalid, valid, now)
+	if !result.failing || result.message != "Channel backup failed verification: unable to unpack" {
+		t.Errorf("expected a failed verification to fail the check, got %+v", result)
+	}
+
+	valid.LastVerifiedAt = now.Add(-30 * time.Hour)
+	result, _ = evaluateBackup(valid, valid, now)
+	if !result.failing || result.message != "No verified channel backup in 30h0m0s." {
+		t.Errorf("expected a stale verified backup to fail the check, got %+v", result)
+	}
+}
+
+func TestEvaluateCoverage(t *testing.T) {
+	now := time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC)
+	a, b := strings.Repeat("a", 64)+":0", strings.Repeat("b", 64)+":1"
+	covered := db.MultiChannelBackup{ID: 2, ChannelPoints: a + "," + b}
+	c := strings.Repeat("c", 64) + ":2"
+	firstSeen := map[string]time.Time{a: now.Add(-time.Hour), b: now.Add(-time.Hour), c: now.Add(-time.Hour)}
+
+	if result, ok := evaluateCoverage([]string{a, b}, covered, covered, firstSeen, now); !ok || result.failing {
+		t.Errorf("expected covered channels to pass, got %+v", result)
+	}
+	if _, ok := evaluateCoverage([]string{a, b}, db.MultiChannelBackup{ID: 3}, covered, firstSeen, now); ok {
+		t.Error("expected the check to wait until the channels of the latest backup are known")
+	}
+
+	result, _ := evaluateCoverage([]string{a, b, c}, covered, covered, firstSeen, now)
+	if !result.failing || result.message != "1 channel(s) are not in any stored channel backup: "+c {
+		t.Errorf("expected a new channel to fail the check, got %+v", result)
+	}
+
+	firstSeen[c] = now.Add(-time.Minute)
+	if result, _ := evaluateCoverage([]string{a, b, c}, covered, covered, firstSeen, now); result.failing {
+		t.Errorf("expected a channel opened since the last poll to pass, got %+v", result)
+	}
+	delete(firstSeen, c)
+	if result, _ := evaluateCoverage([]string{a, b, c}, covered, covered, firstSeen, now); result.failing {
+		t.Errorf("expected a channel that is not stored yet to pass, got %+v", result)
+	}
+
+	result, _ = evaluateCoverage([]string{a}, db.MultiChannelBackup{}, db.MultiChannelBackup{}, firstSeen, now)
+	if !result.failing {
+		t.Errorf("expected channels of a node without backups to fail the check, got %+v", result)
+	}
+	if result, _ := evaluateCoverage(nil, db.MultiChannelBackup{}, db.MultiChannelBackup{}, firstSeen, now); result.failing {
+		t.Errorf("expected a node without channels to pass, got %+v", result)
+	}
+}
+
+func TestPolicySteps(t *testing.T) {
+	primary := db.User{ID: 1, Email: "primary@example.com"}
+	secondary := db.User{ID: 2, Email: "secondary@example.com"}
+
+	steps := policySteps([]db.User{primary, secondary})
+	if len(steps) != 3 || steps[0][0].ID != 1 || steps[1][0].ID != 2 || len(steps[2]) != 2 {
+		t.Errorf("expected primary, secondary, then everyone, got %+v", steps)
+	}
+	if steps := policySteps([]db.User{primary}); len(steps) != 1 {
+		t.Errorf("expected a single contact to be notified once, got %+v", steps)
+	}
+
+	if !ownerOnly(steps[0], db.Node{UserID: 1}) || ownerOnly(steps[1], db.Node{UserID: 1}) || ownerOnly(steps[2], db.Node{UserID: 1}) {
+		t.Error("expected only the step notifying just the owner to be skipped")
+	}
+
+	failedAt := time.Date(2023, 3, 1, 3, 0, 0, 0, time.UTC)
+	check := db.NodeCheck{Name: CheckNodeDown, Severity: "critical", Failing: true, ChangedAt: failedAt}
+	delay := 15 * time.Minute
+	if !policyStepDue(check, delay, failedAt) {
+		t.Error("expected primary contact to be notified right away")
+	}
+	check.PolicyStep = 1
+	if policyStepDue(check, delay, failedAt.Add(10*time.Minute)) {
+		t.Error("expected secondary contact to wait for the delay")
+	}
+	if !policyStepDue(check, delay, failedAt.Add(15*time.Minute)) {
+		t.Error("expected secondary contact after the delay")
+	}
+	check.AcknowledgedAt = failedAt.Add(12 * time.Minute)
+	if policyStepDue(check, delay, failedAt.Add(15*time.Minute)) {
+		t.Error("expected no escalation after acknowledgement")
+	}
+}
+
+func TestReportMessage(t *testing.T) {
+	now := time.Date(2023, 3, 1, 8, 0, 0, 0, time.UTC)
+	nodes := []nodeReport{
+		{
+			Alias:      "alice",
+			Snapshot:   &notify.Snapshot{BlockHeight: 780000, ActiveChannels: 3, InactiveChannels: 1},
+			TakenAt:    now.Add(-time.Minute),
+			LastBackup: now.Add(-2 * time.Hour),
+		},
+		{
+			Alias:      "bob",
+			Snapshot:   &notify.Snapshot{BlockHeight: 779990},
+			TakenAt:    now.Add(-3 * time.Hour),
+			Failing:    []db.NodeCheck{{Name: CheckNodeDown, Failing: true, Message: "Lightning node is unreachable."}},
+			LastBackup: now.Add(-48 * time.Hour),
+		},
+	}
+
+	expected := "\nNodewatcher status report: 2 node(s)" +
+		"\n\n[alice] OK" +
+		"\nBlock 780000, 3 active / 1 inactive channel(s)" +
+		"\nChannel backup taken 2h0m0s ago" +
+		"\n\n[bob] 1 issue(s)" +
+		"\nBlock 779990, 0 active / 0 inactive channel(s)" +
+		"\nLast seen 3h0m0s ago" +
+		"\nWARNING: Lightning node is unreachable." +
+		"\nWARNING: Channel backup is stale, last taken 48h0m0s ago"
+	actual := reportMessage(nodes, now)
+	if actual != expected {
+		t.Errorf("got %q, want %q", actual, expected)
+	}
+}
+
+func TestSummaryMessage(t *testing.T) {
+	start := time.Date(2023, 3, 1, 2, 0, 0, 0, time.UTC)
+	s := db.Silence{Kind: "maintenance", Comment: "Upgrading LND"}
+	suppressed := []db.SuppressedAlert{
+		{CreatedAt: start.Add(5 * time.Minute), NodeID: 7, CheckName: CheckNodeDown, Event: "trigger", Message: "WARNING: Lightning node is unreachable."},
+	}
+
+	expected := "\nMaintenance window ended (Mar 1 02:00 - Mar 1 03:00 UTC), 1 alert(s) suppressed:" +
+		"\nUpgrading LND" +
+		"\n02:05 [alice] node_down trigger: WARNING: Lightning node is unreachable."
+	actual := summaryMessage(s, start, start.Add(time.Hour), suppressed, map[int64]string{7: "alice"})
+	if actual != expected {
+		t.Errorf("got %q, want %q", actual, expected)
+	}
+}
+
+func TestStillFailing(t *testing.T) {
+	suppressed := []db.SuppressedAlert{
+		{NodeID: 7, CheckName: CheckNodeDown, Event: "trigger"},
+		{NodeID: 7, CheckName: CheckNodeDown, Event: "resolve"},
+		{NodeID: 7, CheckName: CheckNodeDown, Event: "trigger"},
+		{NodeID: 7, CheckName: CheckChainSync, Event: "trigger"},
+	}
+	checks := map[int64][]db.NodeCheck{7: {
+		{NodeID: 7, Name: CheckNodeDown, Failing: true},
+		{NodeID: 7, Name: CheckChainSync, Failing: false},
+	}}
+
+	failing := stillFailing(suppressed, checks)
+	if len(failing) != 1 || failing[0].Name != CheckNodeDown {
+		t.Errorf("expected only %s to be alerted once, got %+v", CheckNodeDown, failing)
+	}
+}
@@ -0,0 +1,125 @@
+package health
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/incident"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+	"github.com/mvpratt/nodewatcher/internal/outbox"
+	"github.com/mvpratt/nodewatcher/internal/silence"
+	"github.com/mvpratt/nodewatcher/internal/templates"
+)
+
+// policySteps lists who is notified at each step of an escalation policy: each contact in
+// turn, then all contacts at once. A single contact is only notified once
+func policySteps(contacts []db.User) [][]db.User {
+	var steps [][]db.User
+	for _, contact := range contacts {
+		steps = append(steps, []db.User{contact})
+	}
+	if len(contacts) > 1 {
+		steps = append(steps, contacts)
+	}
+	return steps
+}
+
+// policyStepDue reports whether the next step of an escalation policy should be notified about
+// a check: the primary contact right away, and each further step once the check has been
+// failing unacknowledged for another delay
+func policyStepDue(check db.NodeCheck, delay time.Duration, now time.Time) bool {
+	if !check.Failing || !check.AcknowledgedAt.IsZero() || check.Severity != string(notify.SeverityCritical) {
+		return false
+	}
+	due := check.ChangedAt.Add(delay * time.Duration(check.PolicyStep))
+	return !now.Before(due)
+}
+
+// ownerOnly reports whether a step of an escalation policy only notifies the owner of the node,
+// who updateChecks already alerted when the check started failing
+func ownerOnly(step []db.User, node db.Node) bool {
+	return len(step) == 1 && step[0].ID == node.UserID
+}
+
+// FollowPolicy notifies the next step of the node's escalation policy about every critical
+// health check of the node that has not been acknowledged in time. Contacts are notified over
+// all of their own channels, including sms
+func FollowPolicy(notifiers []notify.Notifier, node db.Node) error {
+	if node.EscalationPolicyID == 0 {
+		return nil
+	}
+	policy, err := db.FindEscalationPolicyByID(node.EscalationPolicyID)
+	if err != nil {
+		return err
+	}
+	contacts, err := db.FindEscalationContacts(policy.ID)
+	if err != nil {
+		return err
+	}
+	steps := policySteps(contacts)
+	delay := time.Duration(policy.DelayMinutes) * time.Minute
+
+	checks, err := db.FindNodeChecks(node.ID)
+	if err != nil {
+		return err
+	}
+	silences, err := db.FindSilencesByUserID(node.UserID)
+	if err != nil {
+		return err
+	}
+
+	for _, check := range checks {
+		if !policyStepDue(check, delay, time.Now().UTC()) || check.PolicyStep >= len(steps) {
+			continue
+		}
+		if _, silenced := silence.Find(silences, node.ID, check.Name, time.Now().UTC()); silenced {
+			continue
+		}
+
+		if check.PolicyStep == 0 && ownerOnly(steps[0], node) {
+			check.PolicyStep++
+			if err := db.UpdateNodeCheckPolicyStep(check); err != nil {
+				return err
+			}
+			continue
+		}
+
+		alert := notify.Alert{
+			Node:     node,
+			Event:    notify.EventTrigger,
+			Check:    check.Name,
+			Severity: notify.SeverityCritical,
+			Message:  warning(check.Message),
+		}
+		if check.PolicyStep > 0 {
+			alert.Message += fmt.Sprintf("\n\nNot acknowledged for %s, escalated by policy %s.",
+				time.Since(check.ChangedAt).Round(time.Minute), policy.Name)
+		}
+
+		var notified []string
+		for _, contact := range steps[check.PolicyStep] {
+			channels := notifyAll(notifiers, contact, templates.Load(contact), alert)
+			if contact.SmsEnabled {
+				if err := outbox.EnqueueSMS(contact, alert, channels); err != nil {
+					log.Printf("Error sending escalation to user %s: %s", contact.Email, err)
+				}
+			}
+			notified = append(notified, contact.Email)
+		}
+		log.Printf("\nEscalated %s of LND node %s to %s", check.Name, node.Alias, strings.Join(notified, ", "))
+		if open, ok := incident.Find(node.ID, check.Name); ok {
+			incident.Record(open, incident.EventEscalated,
+				fmt.Sprintf("policy %s notified %s (step %d)", policy.Name, strings.Join(notified, ", "), check.PolicyStep+1))
+		}
+
+		check.PolicyStep++
+		err = db.UpdateNodeCheckPolicyStep(check)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+	"github.com/mvpratt/nodewatcher/internal/outbox"
+	"github.com/mvpratt/nodewatcher/internal/schedule"
+	"github.com/mvpratt/nodewatcher/internal/templates"
+)
+
+// MaxBackupAge is the age after which a multi-channel backup is reported as stale and the
+// channel_backup check fails
+var MaxBackupAge = 24 * time.Hour
+
+// staleSnapshot is the age after which a node is reported as last seen at its snapshot time
+const staleSnapshot = 10 * time.Minute
+
+// nodeReport is the state of one node in a status report
+type nodeReport struct {
+	Alias      string
+	Snapshot   *notify.Snapshot
+	TakenAt    time.Time
+	Failing    []db.NodeCheck
+	LastBackup time.Time
+}
+
+// loadNodeReport gets the latest known state of a node from the db
+func loadNodeReport(node db.Node) nodeReport {
+	report := nodeReport{Alias: node.Alias}
+
+	saved, err := db.FindNodeSnapshot(node.ID)
+	if err == nil {
+		report.Snapshot = &notify.Snapshot{}
+		report.TakenAt = saved.TakenAt
+		if json.Unmarshal([]byte(saved.Snapshot), report.Snapshot) != nil {
+			report.Snapshot = nil
+		}
+	}
+
+	checks, _ := db.FindNodeChecks(node.ID)
+	for _, check := range checks {
+		if check.Failing {
+			report.Failing = append(report.Failing, check)
+		}
+	}
+
+	backup, err := db.FindMultiChannelBackupByPubkey(node.Pubkey)
+	if err == nil {
+		report.LastBackup = backup.VerifiedAt()
+	}
+	return report
+}
+
+// reportMessage renders the status report of a user's nodes
+func reportMessage(nodes []nodeReport, now time.Time) string {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "\nNodewatcher status report: %d node(s)", len(nodes))
+
+	for _, node := range nodes {
+		status := "OK"
+		if len(node.Failing) > 0 {
+			status = fmt.Sprintf("%d issue(s)", len(node.Failing))
+		}
+		fmt.Fprintf(&msg, "\n\n[%s] %s", node.Alias, status)
+
+		if node.Snapshot != nil {
+			fmt.Fprintf(&msg, "\nBlock %d, %d active / %d inactive channel(s)",
+				node.Snapshot.BlockHeight, node.Snapshot.ActiveChannels, node.Snapshot.InactiveChannels)
+		}
+		if node.Snapshot == nil || now.Sub(node.TakenAt) > staleSnapshot {
+			if node.TakenAt.IsZero() {
+				msg.WriteString("\nNever seen online")
+			} else {
+				fmt.Fprintf(&msg, "\nLast seen %s ago", now.Sub(node.TakenAt).Round(time.Minute))
+			}
+		}
+
+		for _, check := range node.Failing {
+			fmt.Fprintf(&msg, "\nWARNING: %s", check.Message)
+		}
+
+		switch {
+		case node.LastBackup.IsZero():
+			msg.WriteString("\nWARNING: No channel backup")
+		case now.Sub(node.LastBackup) > MaxBackupAge:
+			fmt.Fprintf(&msg, "\nWARNING: Channel backup is stale, last taken %s ago", now.Sub(node.LastBackup).Round(time.Hour))
+		default:
+			fmt.Fprintf(&msg, "\nChannel backup taken %s ago", now.Sub(node.LastBackup).Round(time.Minute))
+		}
+	}
+	return msg.String()
+}
+
+// SendReports sends every user whose report is due a single status report covering all of
+// their nodes, by text message (if SMS is enabled, through the notification outbox) and
+// through any other messaging services the user has linked
+func SendReports(notifiers []notify.Notifier) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	users, err := db.FindAllUsers(ctx)
+	if err != nil {
+		log.Printf("Error getting users: %s", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, user := range users {
+		sched, err := schedule.FromUser(user)
+		if err != nil {
+			log.Printf("Error getting schedule of user %s: %s", user.Email, err)
+			continue
+		}
+		reportDue := sched.ReportDue(now, user.SmsLastSent) // once per scheduled report time
+		quiet := sched.Quiet(now)                           // only critical alerts during quiet hours
+		muted := now.Before(user.MutedUntil)
+		if !reportDue || quiet || muted {
+			continue
+		}
+
+		nodes, err := db.FindNodesByUserID(user.ID)
+		if err != nil || len(nodes) == 0 {
+			continue
+		}
+		var reports []nodeReport
+		for _, node := range nodes {
+			reports = append(reports, loadNodeReport(node))
+		}
+
+		report := notify.Alert{
+			Event:    notify.EventReport,
+			Severity: notify.SeverityInfo,
+			Message:  reportMessage(reports, now),
+		}
+		channels := notifyAll(notifiers, user, templates.Load(user), report)
+		if user.SmsEnabled {
+			if err := outbox.EnqueueSMS(user, report, channels); err != nil {
+				log.Printf("Error sending status report to user %s: %s", user.Email, err)
+			}
+		}
+
+		user.SmsLastSent = now
+		db.UpdateUserLastSent(user)
+		log.Printf("\nStatus report sent to user %s", user.Email)
+	}
+}
@@ -0,0 +1,182 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/incident"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+	"github.com/mvpratt/nodewatcher/internal/outbox"
+	"github.com/mvpratt/nodewatcher/internal/schedule"
+	"github.com/mvpratt/nodewatcher/internal/silence"
+	"github.com/mvpratt/nodewatcher/internal/templates"
+)
+
+// suppress records an alert that was not sent because of a silence
+func suppress(s db.Silence, alert notify.Alert) {
+	err := db.InsertSuppressedAlert(&db.SuppressedAlert{
+		CreatedAt: time.Now().UTC(),
+		SilenceID: s.ID,
+		NodeID:    alert.Node.ID,
+		CheckName: alert.Check,
+		Event:     string(alert.Event),
+		Message:   strings.TrimSpace(alert.Message),
+	})
+	if err != nil {
+		log.Printf("Error recording alert suppressed by silence %d: %s", s.ID, err)
+	}
+	log.Printf("\nHealth check %s of LND node %s silenced by %s %d", alert.Check, alert.Node.Alias, s.Kind, s.ID)
+}
+
+// summaryMessage lists the alerts suppressed during a silence
+func summaryMessage(s db.Silence, start time.Time, end time.Time, suppressed []db.SuppressedAlert, aliases map[int64]string) string {
+	var msg strings.Builder
+	label := "Silence"
+	if s.Kind == silence.KindMaintenance {
+		label = "Maintenance window"
+	}
+	fmt.Fprintf(&msg, "\n%s ended (%s - %s UTC), %d alert(s) suppressed:",
+		label, start.Format("Jan 2 15:04"), end.Format("Jan 2 15:04"), len(suppressed))
+	if s.Comment != "" {
+		fmt.Fprintf(&msg, "\n%s", s.Comment)
+	}
+	for _, alert := range suppressed {
+		fmt.Fprintf(&msg, "\n%s [%s] %s %s: %s",
+			alert.CreatedAt.Format("15:04"), aliases[alert.NodeID], alert.CheckName, alert.Event, alert.Message)
+	}
+	return msg.String()
+}
+
+// SendSilenceSummaries sends users a summary of the alerts that were suppressed by each of
+// their maintenance windows and silences that has ended since its last summary, and alerts them
+// about the checks whose trigger was suppressed and that are still failing
+func SendSilenceSummaries(notifiers []notify.Notifier) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	silences, err := db.FindAllSilences(ctx)
+	if err != nil {
+		log.Printf("Error getting silences: %s", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, s := range silences {
+		start, end, ok := silence.LastEnded(s, now)
+		if !ok || !end.After(s.SummarySentAt) {
+			continue
+		}
+
+		suppressed, err := db.FindSuppressedAlerts(s.ID, start, end)
+		if err != nil {
+			log.Printf("Error getting alerts suppressed by silence %d: %s", s.ID, err)
+			continue
+		}
+		if len(suppressed) > 0 {
+			sendSilenceSummary(notifiers, s, start, end, suppressed)
+			alertStillFailing(notifiers, s, suppressed)
+		}
+
+		s.SummarySentAt = end
+		err = db.UpdateSilenceSummarySent(s)
+		if err != nil {
+			log.Printf("Error updating silence %d: %s", s.ID, err)
+		}
+	}
+}
+
+func sendSilenceSummary(notifiers []notify.Notifier, s db.Silence, start time.Time, end time.Time, suppressed []db.SuppressedAlert) {
+	user, err := db.FindUserByID(s.UserID)
+	if err != nil {
+		log.Printf("Error getting user of silence %d: %s", s.ID, err)
+		return
+	}
+	nodes, _ := db.FindNodesByUserID(user.ID)
+	aliases := make(map[int64]string)
+	for _, node := range nodes {
+		aliases[node.ID] = node.Alias
+	}
+
+	summary := notify.Alert{
+		Event:    notify.EventReport,
+		Severity: notify.SeverityInfo,
+		Message:  summaryMessage(s, start, end, suppressed, aliases),
+	}
+	channels := notifyAll(notifiers, user, templates.Load(user), summary)
+	if user.SmsEnabled {
+		if err := outbox.EnqueueSMS(user, summary, channels); err != nil {
+			log.Printf("Error sending silence summary to user %s: %s", user.Email, err)
+		}
+	}
+}
+
+// stillFailing returns the health checks whose triggers were suppressed and that are still failing
+func stillFailing(suppressed []db.SuppressedAlert, checks map[int64][]db.NodeCheck) []db.NodeCheck {
+	var failing []db.NodeCheck
+	seen := make(map[string]bool)
+	for _, alert := range suppressed {
+		key := fmt.Sprintf("%d-%s", alert.NodeID, alert.CheckName)
+		if alert.Event != string(notify.EventTrigger) || seen[key] {
+			continue
+		}
+		seen[key] = true
+		for _, check := range checks[alert.NodeID] {
+			if check.Name == alert.CheckName && check.Failing {
+				failing = append(failing, check)
+			}
+		}
+	}
+	return failing
+}
+
+// alertStillFailing sends the triggers a silence suppressed again for the checks that are still
+// failing when it ends. They do not change again, so updateChecks would never alert about them
+func alertStillFailing(notifiers []notify.Notifier, s db.Silence, suppressed []db.SuppressedAlert) {
+	user, err := db.FindUserByID(s.UserID)
+	if err != nil {
+		log.Printf("Error getting user of silence %d: %s", s.ID, err)
+		return
+	}
+	nodes, _ := db.FindNodesByUserID(user.ID)
+	byID := make(map[int64]db.Node)
+	checks := make(map[int64][]db.NodeCheck)
+	for _, node := range nodes {
+		byID[node.ID] = node
+		checks[node.ID], _ = db.FindNodeChecks(node.ID)
+	}
+
+	now := time.Now().UTC()
+	muted := now.Before(user.MutedUntil)
+	sched, _ := schedule.FromUser(user)
+	quiet := sched.Quiet(now)
+	silences, _ := db.FindSilencesByUserID(user.ID)
+	userTemplates := templates.Load(user)
+	for _, check := range stillFailing(suppressed, checks) {
+		node := byID[check.NodeID]
+		alert := notify.Alert{
+			Node:     node,
+			Event:    notify.EventTrigger,
+			Check:    check.Name,
+			Severity: notify.Severity(check.Severity),
+			Message:  warning(check.Message),
+		}
+		if other, silenced := silence.Find(silences, node.ID, check.Name, now); silenced {
+			suppress(other, alert)
+			continue
+		}
+		if muted || (quiet && alert.Severity != notify.SeverityCritical) {
+			continue
+		}
+
+		log.Printf("\nHealth check %s of LND node %s still failing after %s %d ended", check.Name, node.Alias, s.Kind, s.ID)
+		channels := notifyAll(notifiers, user, userTemplates, alert)
+		if open, ok := incident.Find(node.ID, check.Name); ok && len(channels) > 0 {
+			incident.Record(open, incident.EventNotified,
+				fmt.Sprintf("%s after %s %d ended", sentDetail(alert.Event, channels), s.Kind, s.ID))
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package health
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/incident"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+	"github.com/mvpratt/nodewatcher/internal/phone"
+	"github.com/mvpratt/nodewatcher/internal/silence"
+	twilio "github.com/twilio/twilio-go"
+	openapi "github.com/twilio/twilio-go/rest/api/v2010"
+)
+
+// CallDetails contains the parameters for placing a voice call
+type CallDetails struct {
+	To           string
+	From         string
+	Speech       string
+	TwilioClient *twilio.RestClient
+}
+
+// twiml returns TwiML that reads the speech text twice using text-to-speech
+func twiml(speech string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(speech)) //nolint:errcheck
+	return fmt.Sprintf(`<Response><Say voice="alice" loop="2">%s</Say></Response>`, escaped.String())
+}
+
+// Place a voice call
+func sendVoiceCall(details CallDetails) error {
+	params := &openapi.CreateCallParams{}
+	params.SetTo(details.To)
+	params.SetFrom(details.From)
+	params.SetTwiml(twiml(details.Speech))
+
+	_, err := details.TwilioClient.Api.CreateCall(params)
+	if err != nil {
+		return fmt.Errorf("%s", err.Error())
+	}
+	return nil
+}
+
+// escalationChain is the user's own phone number followed by their escalation phone numbers.
+// Only numbers the user has verified with a code are called, so nodewatcher never calls a number
+// whose owner did not agree to it
+func escalationChain(user db.User, verified map[string]bool) []string {
+	var chain []string
+	if user.PhoneNumber != "" && phone.Verified(user) {
+		chain = append(chain, user.PhoneNumber)
+	}
+	for _, number := range strings.Split(user.EscalationPhoneNumbers, ",") {
+		if number = strings.TrimSpace(number); number != "" && verified[number] {
+			chain = append(chain, number)
+		}
+	}
+	return chain
+}
+
+// escalationDue reports whether the next step of the escalation chain should be called for a
+// check: each step is called once the check has been failing unacknowledged for another delay
+func escalationDue(check db.NodeCheck, delay time.Duration, now time.Time) bool {
+	if !check.Failing || !check.AcknowledgedAt.IsZero() || check.Severity != string(notify.SeverityCritical) {
+		return false
+	}
+	due := check.ChangedAt.Add(delay * time.Duration(check.EscalationStep+1))
+	return !now.Before(due)
+}
+
+// Escalate calls the next phone number in the owner's escalation chain for every critical
+// health check of the node that has not been acknowledged within the owner's escalation delay.
+// No calls are made while the owner has muted alerts. A number that cannot be called is skipped
+// and the next number in the chain is called instead
+func Escalate(twilioConfig TwilioConfig, node db.Node) error {
+	user, err := db.FindUserByID(node.UserID)
+	if err != nil {
+		return err
+	}
+	if user.EscalationDelayMinutes <= 0 || time.Now().Before(user.MutedUntil) {
+		return nil
+	}
+	delay := time.Duration(user.EscalationDelayMinutes) * time.Minute
+	verified, err := phone.VerifiedNumbers(user)
+	if err != nil {
+		return err
+	}
+	chain := escalationChain(user, verified)
+
+	checks, err := db.FindNodeChecks(node.ID)
+	if err != nil {
+		return err
+	}
+
+	silences, err := db.FindSilencesByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, check := range checks {
+		if !escalationDue(check, delay, time.Now().UTC()) || check.EscalationStep >= len(chain) {
+			continue
+		}
+		if _, silenced := silence.Find(silences, node.ID, check.Name, time.Now().UTC()); silenced {
+			continue
+		}
+		open, hasIncident := incident.Find(node.ID, check.Name)
+
+		for check.EscalationStep < len(chain) {
+			callDetails := CallDetails{
+				To:   chain[check.EscalationStep],
+				From: twilioConfig.From,
+				Speech: fmt.Sprintf("This is nodewatcher with a critical alert for lightning node %s. %s "+
+					"Acknowledge the alert to stop further calls.", node.Alias, check.Message),
+				TwilioClient: twilioConfig.TwilioClient,
+			}
+			check.EscalationStep++
+			if err := sendVoiceCall(callDetails); err != nil {
+				log.Printf("\nError calling %s about %s of LND node %s: %s", callDetails.To, check.Name, node.Alias, err)
+				if hasIncident {
+					incident.Record(open, incident.EventEscalated, fmt.Sprintf("call to %s failed (step %d): %s", callDetails.To, check.EscalationStep, err))
+				}
+				continue
+			}
+			log.Printf("\nCalled %s about %s of LND node %s", callDetails.To, check.Name, node.Alias)
+			if hasIncident {
+				incident.Record(open, incident.EventEscalated, fmt.Sprintf("called %s (step %d)", callDetails.To, check.EscalationStep))
+			}
+			break
+		}
+
+		err = db.UpdateNodeCheckEscalation(check)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
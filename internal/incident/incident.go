@@ -0,0 +1,189 @@
+// Package incident tracks critical health check failures as incidents that users acknowledge,
+// with a timeline of everything that happened while they were open
+package incident
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+// Kinds of incident timeline events
+const (
+	EventOpened       = "opened"
+	EventNotified     = "notified"
+	EventSuppressed   = "suppressed"
+	EventEscalated    = "escalated"
+	EventAcknowledged = "acknowledged"
+	EventClosed       = "closed"
+)
+
+// States of an incident
+const (
+	StateOpen         = "open"
+	StateAcknowledged = "acknowledged"
+	StateClosed       = "closed"
+)
+
+// State is whether an incident is open, acknowledged or closed
+func State(incident db.Incident) string {
+	switch {
+	case !incident.ClosedAt.IsZero():
+		return StateClosed
+	case !incident.AcknowledgedAt.IsZero():
+		return StateAcknowledged
+	default:
+		return StateOpen
+	}
+}
+
+// find returns the open incident of a check from a list of incidents
+func find(incidents []db.Incident, check string) (db.Incident, bool) {
+	for _, incident := range incidents {
+		if incident.CheckName == check && incident.ClosedAt.IsZero() {
+			return incident, true
+		}
+	}
+	return db.Incident{}, false
+}
+
+// Find gets the open incident of a health check of a node, if there is one
+func Find(nodeID int64, check string) (db.Incident, bool) {
+	incidents, err := db.FindOpenIncidents(nodeID)
+	if err != nil {
+		log.Printf("Error getting incidents of node %d: %s", nodeID, err)
+		return db.Incident{}, false
+	}
+	return find(incidents, check)
+}
+
+// Open opens an incident for a failing health check of a node. If the check already has an
+// open incident, that incident is returned
+func Open(node db.Node, check string, severity string, message string) (db.Incident, error) {
+	if incident, ok := Find(node.ID, check); ok {
+		return incident, nil
+	}
+
+	incident := db.Incident{
+		NodeID:    node.ID,
+		CheckName: check,
+		Severity:  severity,
+		Message:   message,
+		OpenedAt:  time.Now().UTC(),
+	}
+	err := db.InsertIncident(&incident)
+	if err != nil {
+		return incident, err
+	}
+	Record(incident, EventOpened, message)
+	log.Printf("\nOpened incident %d for %s of LND node %s", incident.ID, check, node.Alias)
+	return incident, nil
+}
+
+// Record adds an event to the timeline of an incident
+func Record(incident db.Incident, kind string, detail string) {
+	err := db.InsertIncidentEvent(&db.IncidentEvent{
+		IncidentID: incident.ID,
+		CreatedAt:  time.Now().UTC(),
+		Kind:       kind,
+		Detail:     detail,
+	})
+	if err != nil {
+		log.Printf("Error recording %s event of incident %d: %s", kind, incident.ID, err)
+	}
+}
+
+// Close closes the open incident of a health check of a node that recovered
+func Close(nodeID int64, check string, message string) error {
+	incident, ok := Find(nodeID, check)
+	if !ok {
+		return nil
+	}
+
+	incident.ClosedAt = time.Now().UTC()
+	err := db.UpdateIncident(incident)
+	if err != nil {
+		return err
+	}
+	Record(incident, EventClosed, message)
+	return nil
+}
+
+// Acknowledge marks an open incident as acknowledged by a user, which stops the escalation
+// calls for its health check. Closed or already acknowledged incidents are returned unchanged
+func Acknowledge(incident db.Incident, by string) (db.Incident, error) {
+	if State(incident) != StateOpen {
+		return incident, nil
+	}
+
+	incident.AcknowledgedAt = time.Now().UTC()
+	incident.AcknowledgedBy = by
+	err := db.UpdateIncident(incident)
+	if err != nil {
+		return incident, err
+	}
+	err = db.AcknowledgeNodeCheck(incident.NodeID, incident.CheckName)
+	if err != nil {
+		return incident, err
+	}
+	Record(incident, EventAcknowledged, fmt.Sprintf("by %s", by))
+	return incident, nil
+}
+
+// AcknowledgeNode acknowledges the open incidents and failing health checks of a node and
+// returns how many were acknowledged
+func AcknowledgeNode(nodeID int64, by string) (int64, error) {
+	incidents, err := db.FindOpenIncidents(nodeID)
+	if err != nil {
+		return 0, err
+	}
+
+	var acknowledged int64
+	for _, incident := range incidents {
+		if State(incident) != StateOpen {
+			continue
+		}
+		if _, err := Acknowledge(incident, by); err != nil {
+			return acknowledged, err
+		}
+		acknowledged++
+	}
+
+	checks, err := db.AcknowledgeNodeChecks(nodeID)
+	return acknowledged + checks, err
+}
+
+// Nodes returns the nodes whose incidents a user can see and acknowledge: the user's own nodes
+// and the nodes whose escalation policy notifies the user
+func Nodes(user db.User) ([]db.Node, error) {
+	nodes, err := db.FindNodesByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	escalated, err := db.FindNodesByEscalationContact(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range escalated {
+		if node.UserID != user.ID {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// FindNode returns the node with the given ID if a user can see and acknowledge its incidents
+func FindNode(user db.User, nodeID int64) (db.Node, bool) {
+	nodes, err := Nodes(user)
+	if err != nil {
+		return db.Node{}, false
+	}
+	for _, node := range nodes {
+		if node.ID == nodeID {
+			return node, true
+		}
+	}
+	return db.Node{}, false
+}
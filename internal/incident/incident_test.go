@@ -0,0 +1,41 @@
+package incident
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+func TestState(t *testing.T) {
+	now := time.Date(2023, 3, 1, 2, 0, 0, 0, time.UTC)
+	incident := db.Incident{CheckName: "node_down", OpenedAt: now}
+	if got := State(incident); got != StateOpen {
+		t.Errorf("expected open incident, got %s", got)
+	}
+
+	incident.AcknowledgedAt = now.Add(time.Minute)
+	if got := State(incident); got != StateAcknowledged {
+		t.Errorf("expected acknowledged incident, got %s", got)
+	}
+
+	incident.ClosedAt = now.Add(time.Hour)
+	if got := State(incident); got != StateClosed {
+		t.Errorf("expected closed incident, got %s", got)
+	}
+}
+
+func TestFind(t *testing.T) {
+	now := time.Date(2023, 3, 1, 2, 0, 0, 0, time.UTC)
+	incidents := []db.Incident{
+		{ID: 1, CheckName: "node_down", OpenedAt: now, ClosedAt: now.Add(time.Hour)},
+		{ID: 2, CheckName: "force_close", OpenedAt: now},
+		{ID: 3, CheckName: "node_down", OpenedAt: now.Add(2 * time.Hour)},
+	}
+	if incident, ok := find(incidents, "node_down"); !ok || incident.ID != 3 {
+		t.Errorf("expected open node_down incident, got %d", incident.ID)
+	}
+	if _, ok := find(incidents, "synced_to_chain"); ok {
+		t.Error("expected no incident for a check without one")
+	}
+}
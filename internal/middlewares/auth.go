@@ -5,7 +5,11 @@ import (
 	"github.com/mvpratt/nodewatcher/internal/auth"
 )
 
-// Auth is a middleware that checks for a valid JWT in the Authorization header
+// ClaimsKey is the gin context key of the claims of the JWT validated by Auth
+const ClaimsKey = "claims"
+
+// Auth is a middleware that checks for a valid JWT in the Authorization header and puts its
+// claims into the gin context, so handlers act on the user the token was issued to
 func Auth() gin.HandlerFunc {
 	return func(context *gin.Context) {
 		tokenString := context.GetHeader("Authorization")
@@ -14,12 +18,23 @@ func Auth() gin.HandlerFunc {
 			context.Abort()
 			return
 		}
-		err := auth.ValidateToken(tokenString)
+		claims, err := auth.ValidateToken(tokenString)
 		if err != nil {
 			context.JSON(401, gin.H{"error": err.Error()})
 			context.Abort()
 			return
 		}
+		context.Set(ClaimsKey, claims)
 		context.Next()
 	}
 }
+
+// Claims returns the claims of the JWT validated by Auth
+func Claims(context *gin.Context) (*auth.JWTClaim, bool) {
+	claims, ok := context.Get(ClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	jwtClaims, ok := claims.(*auth.JWTClaim)
+	return jwtClaims, ok
+}
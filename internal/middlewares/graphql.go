@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mvpratt/nodewatcher/internal/auth"
+)
+
+type claimsContextKey struct{}
+
+// GraphQL is an http middleware for the GraphQL server that checks the JWT in the Authorization
+// header, if there is one, and puts its claims into the request context. Resolvers that act on
+// a user's data get them with ForContext
+func GraphQL(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := r.Header.Get("Authorization")
+		if tokenString == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, err := auth.ValidateToken(tokenString)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey{}, claims)))
+	})
+}
+
+// ForContext returns the claims of the JWT validated by GraphQL
+func ForContext(ctx context.Context) (*auth.JWTClaim, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*auth.JWTClaim)
+	return claims, ok
+}
@@ -0,0 +1,99 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+// DiscoveryDevice groups the entities of a node in Home Assistant
+type DiscoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// DiscoveryConfig is a Home Assistant MQTT discovery payload
+type DiscoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	ValueTemplate     string          `json:"value_template"`
+	AvailabilityTopic string          `json:"availability_topic"`
+	UnitOfMeasurement string          `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string          `json:"device_class,omitempty"`
+	PayloadOn         string          `json:"payload_on,omitempty"`
+	PayloadOff        string          `json:"payload_off,omitempty"`
+	Device            DiscoveryDevice `json:"device"`
+}
+
+// entity is a value from the status payload exposed to Home Assistant
+type entity struct {
+	component   string
+	key         string
+	name        string
+	unit        string
+	deviceClass string
+}
+
+var entities = []entity{
+	{component: "binary_sensor", key: "online", name: "Online", deviceClass: "connectivity"},
+	{component: "binary_sensor", key: "synced_to_chain", name: "Synced to chain"},
+	{component: "binary_sensor", key: "synced_to_graph", name: "Synced to graph"},
+	{component: "sensor", key: "block_height", name: "Block height"},
+	{component: "sensor", key: "active_channels", name: "Active channels"},
+	{component: "sensor", key: "inactive_channels", name: "Inactive channels"},
+	{component: "sensor", key: "pending_channels", name: "Pending channels"},
+	{component: "sensor", key: "channel_balance", name: "Channel balance", unit: "sat"},
+	{component: "sensor", key: "wallet_balance", name: "Wallet balance", unit: "sat"},
+	{component: "sensor", key: "last_backup", name: "Last backup", deviceClass: "timestamp"},
+}
+
+// discoveryConfigs returns the discovery topic and payload of every entity of a node
+func discoveryConfigs(prefix string, discoveryPrefix string, node db.Node) map[string]DiscoveryConfig {
+	id := nodeID(node)
+	device := DiscoveryDevice{
+		Identifiers:  []string{"nodewatcher_" + id},
+		Name:         node.Alias,
+		Manufacturer: "nodewatcher",
+		Model:        "LND",
+	}
+
+	configs := make(map[string]DiscoveryConfig)
+	for _, e := range entities {
+		uniqueID := fmt.Sprintf("nodewatcher_%s_%s", id, e.key)
+		config := DiscoveryConfig{
+			Name:              fmt.Sprintf("%s %s", node.Alias, e.name),
+			UniqueID:          uniqueID,
+			StateTopic:        stateTopic(prefix, node),
+			ValueTemplate:     fmt.Sprintf("{{ value_json.%s }}", e.key),
+			AvailabilityTopic: availabilityTopic(prefix),
+			UnitOfMeasurement: e.unit,
+			DeviceClass:       e.deviceClass,
+			Device:            device,
+		}
+		if e.component == "binary_sensor" {
+			config.ValueTemplate = fmt.Sprintf("{{ 'ON' if value_json.%s else 'OFF' }}", e.key)
+			config.PayloadOn = "ON"
+			config.PayloadOff = "OFF"
+		}
+		configs[fmt.Sprintf("%s/%s/%s/config", discoveryPrefix, e.component, uniqueID)] = config
+	}
+	return configs
+}
+
+// publishDiscovery publishes retained Home Assistant discovery payloads for a node
+func (p *Publisher) publishDiscovery(node db.Node) error {
+	for topic, config := range discoveryConfigs(p.Prefix, p.DiscoveryPrefix, node) {
+		payload, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		if err := p.Client.Publish(topic, payload, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
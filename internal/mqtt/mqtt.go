@@ -0,0 +1,285 @@
+// Package mqtt publishes node status snapshots to an MQTT broker, e.g. for Home Assistant
+// dashboards. It includes a minimal MQTT 3.1.1 client that only publishes at QoS 0
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPingreq    = 12
+	packetDisconnect = 14
+)
+
+// Options configure the connection to the broker
+type Options struct {
+	// Broker is host:port, optionally prefixed with tcp:// or ssl://
+	Broker    string
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+
+	// Will is published by the broker if the connection is lost
+	WillTopic   string
+	WillPayload []byte
+	WillRetain  bool
+
+	// Birth is published after every successful connect, e.g. to replace a retained Will the
+	// broker published while the connection was lost
+	BirthTopic   string
+	BirthPayload []byte
+	BirthRetain  bool
+}
+
+// Client is a connection to an MQTT broker
+type Client struct {
+	opts Options
+
+	mu   sync.Mutex
+	conn net.Conn
+	done chan struct{}
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// appendRemainingLength encodes the length of the rest of a packet as a variable length integer
+func appendRemainingLength(buf []byte, length int) []byte {
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		buf = append(buf, digit)
+		if length == 0 {
+			return buf
+		}
+	}
+}
+
+func packet(packetType byte, flags byte, body []byte) []byte {
+	buf := []byte{packetType<<4 | flags}
+	buf = appendRemainingLength(buf, len(body))
+	return append(buf, body...)
+}
+
+func encodeConnect(opts Options) []byte {
+	flags := byte(0x02) // clean session
+	if opts.WillTopic != "" {
+		flags |= 0x04
+		if opts.WillRetain {
+			flags |= 0x20
+		}
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive.Seconds()))
+	body = appendString(body, opts.ClientID)
+	if opts.WillTopic != "" {
+		body = appendString(body, opts.WillTopic)
+		body = appendString(body, string(opts.WillPayload))
+	}
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+	}
+	if opts.Password != "" {
+		body = appendString(body, opts.Password)
+	}
+	return packet(packetConnect, 0, body)
+}
+
+func encodePublish(topic string, payload []byte, retain bool) []byte {
+	var flags byte
+	if retain {
+		flags = 0x01
+	}
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	return packet(packetPublish, flags, body)
+}
+
+// readPacket reads a packet and returns its type and body
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		if digit&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+		multiplier *= 128
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return header >> 4, body, err
+}
+
+func dial(broker string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	switch {
+	case strings.HasPrefix(broker, "ssl://"), strings.HasPrefix(broker, "tls://"):
+		return tls.DialWithDialer(dialer, "tcp", broker[len("ssl://"):], nil)
+	default:
+		return dialer.Dial("tcp", strings.TrimPrefix(broker, "tcp://"))
+	}
+}
+
+// Connect connects to the broker and publishes the birth message, if any
+func Connect(opts Options) (*Client, error) {
+	client := &Client{opts: opts}
+	if err := client.connect(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (c *Client) connect() error {
+	conn, err := dial(c.opts.Broker)
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second)) //nolint:errcheck
+	if _, err := conn.Write(encodeConnect(c.opts)); err != nil {
+		conn.Close()
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	packetType, body, err := readPacket(reader)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if packetType != packetConnack || len(body) != 2 {
+		conn.Close()
+		return fmt.Errorf("mqtt: expected CONNACK, got packet type %d", packetType)
+	}
+	if body[1] != 0 {
+		conn.Close()
+		return fmt.Errorf("mqtt: connection refused with return code %d", body[1])
+	}
+	if c.opts.BirthTopic != "" {
+		if _, err := conn.Write(encodePublish(c.opts.BirthTopic, c.opts.BirthPayload, c.opts.BirthRetain)); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	conn.SetDeadline(time.Time{}) //nolint:errcheck
+
+	c.conn = conn
+	c.done = make(chan struct{})
+	go c.readLoop(conn, reader)
+	go c.keepAlive(conn, c.done)
+	return nil
+}
+
+// readLoop discards packets from the broker (only PINGRESP is expected) until the
+// connection is closed
+func (c *Client) readLoop(conn net.Conn, reader *bufio.Reader) {
+	for {
+		if _, _, err := readPacket(reader); err != nil {
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (c *Client) keepAlive(conn net.Conn, done chan struct{}) {
+	if c.opts.KeepAlive <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.opts.KeepAlive / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			_, err := conn.Write(packet(packetPingreq, 0, nil))
+			c.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) closeConn() {
+	if c.conn == nil {
+		return
+	}
+	close(c.done)
+	c.conn.Close()
+	c.conn = nil
+}
+
+// Publish sends a message at QoS 0, reconnecting once if the connection was lost
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	msg := encodePublish(topic, payload, retain)
+	if c.conn != nil {
+		if _, err := c.conn.Write(msg); err == nil {
+			return nil
+		}
+		c.closeConn()
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+// Close disconnects from the broker. The will message is not published after a clean disconnect
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	_, err := c.conn.Write(packet(packetDisconnect, 0, nil))
+	c.closeConn()
+	return err
+}
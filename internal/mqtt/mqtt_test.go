@@ -0,0 +1,116 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+func TestAppendRemainingLength(t *testing.T) {
+	cases := map[int][]byte{
+		0:     {0x00},
+		127:   {0x7f},
+		128:   {0x80, 0x01},
+		16383: {0xff, 0x7f},
+		16384: {0x80, 0x80, 0x01},
+	}
+	for length, expected := range cases {
+		if actual := appendRemainingLength(nil, length); !bytes.Equal(actual, expected) {
+			t.Errorf("length %d encoded as %x, expected %x", length, actual, expected)
+		}
+	}
+}
+
+// TestPublisher runs a fake broker that accepts connections and records published messages
+func TestPublisher(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	published := make(chan []byte, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker(t, conn, published)
+		}
+	}()
+
+	opts := Options{Broker: listener.Addr().String(), ClientID: "test", KeepAlive: time.Minute}
+	publisher, err := NewPublisher(opts, "nodewatcher", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+
+	if msg := <-published; !bytes.HasSuffix(msg, []byte(online)) {
+		t.Errorf("expected online message, got %q", msg)
+	}
+
+	node := db.Node{ID: 1, Alias: "My Node!"}
+	if err := publisher.PublishStatus(node, nil); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-published
+	topic := "nodewatcher/my_node/state"
+	if string(msg[2:2+len(topic)]) != topic {
+		t.Fatalf("unexpected topic in %q", msg)
+	}
+	var status Status
+	if err := json.Unmarshal(msg[2+len(topic):], &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Online || status.Alias != "My Node!" {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	// the broker published the Last Will when the connection was lost, so the reconnect must
+	// mark the watcher online again before anything else is published
+	publisher.Client.mu.Lock()
+	publisher.Client.conn.Close()
+	publisher.Client.mu.Unlock()
+	if err := publisher.PublishStatus(node, nil); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-published; !bytes.HasSuffix(msg, []byte(online)) {
+		t.Errorf("expected online message after reconnecting, got %q", msg)
+	}
+	if msg := <-published; string(msg[2:2+len(topic)]) != topic {
+		t.Errorf("expected status after the online message, got %q", msg)
+	}
+}
+
+// broker accepts a connection with a Last Will and records the messages published over it
+func broker(t *testing.T, conn net.Conn, published chan<- []byte) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	packetType, body, err := readPacket(reader)
+	if err != nil || packetType != packetConnect {
+		t.Errorf("expected CONNECT, got %d: %v", packetType, err)
+		return
+	}
+	if !bytes.Contains(body, []byte("nodewatcher/status")) || !bytes.Contains(body, []byte(offline)) {
+		t.Errorf("expected last will in CONNECT %q", body)
+	}
+	conn.Write([]byte{packetConnack << 4, 2, 0, 0})
+
+	for {
+		packetType, body, err := readPacket(reader)
+		if err != nil {
+			return
+		}
+		if packetType == packetPublish {
+			published <- body
+		}
+	}
+}
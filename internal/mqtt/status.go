@@ -0,0 +1,141 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+)
+
+// Payloads published to the availability topic of the watcher
+const (
+	online  = "online"
+	offline = "offline"
+)
+
+// Status is the JSON payload published for each node
+type Status struct {
+	Alias                 string    `json:"alias"`
+	Pubkey                string    `json:"pubkey"`
+	Online                bool      `json:"online"`
+	SyncedToChain         bool      `json:"synced_to_chain"`
+	SyncedToGraph         bool      `json:"synced_to_graph"`
+	BlockHeight           uint32    `json:"block_height"`
+	ActiveChannels        uint32    `json:"active_channels"`
+	InactiveChannels      uint32    `json:"inactive_channels"`
+	PendingChannels       uint32    `json:"pending_channels"`
+	ChannelBalance        int64     `json:"channel_balance"`
+	PendingChannelBalance int64     `json:"pending_channel_balance"`
+	WalletBalance         int64     `json:"wallet_balance"`
+	UnconfirmedBalance    int64     `json:"unconfirmed_balance"`
+	LastBackup            time.Time `json:"last_backup"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+// Publisher publishes retained node status messages under a topic prefix
+type Publisher struct {
+	Client *Client
+	Prefix string
+	// DiscoveryPrefix enables Home Assistant MQTT discovery if set, usually "homeassistant"
+	DiscoveryPrefix string
+
+	discovered map[int64]bool
+}
+
+var unsafeTopicChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// nodeID is a topic-safe identifier for a node
+func nodeID(node db.Node) string {
+	id := unsafeTopicChars.ReplaceAllString(strings.ToLower(node.Alias), "_")
+	id = strings.Trim(id, "_")
+	if id == "" {
+		id = fmt.Sprintf("node_%d", node.ID)
+	}
+	return id
+}
+
+func availabilityTopic(prefix string) string {
+	return prefix + "/status"
+}
+
+func stateTopic(prefix string, node db.Node) string {
+	return fmt.Sprintf("%s/%s/state", prefix, nodeID(node))
+}
+
+// NewPublisher connects to the broker with a Last Will that marks the watcher offline, and
+// marks it online whenever it connects or reconnects
+func NewPublisher(opts Options, prefix string, discoveryPrefix string) (*Publisher, error) {
+	opts.WillTopic = availabilityTopic(prefix)
+	opts.WillPayload = []byte(offline)
+	opts.WillRetain = true
+	opts.BirthTopic = availabilityTopic(prefix)
+	opts.BirthPayload = []byte(online)
+	opts.BirthRetain = true
+
+	client, err := Connect(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Publisher{
+		Client:          client,
+		Prefix:          prefix,
+		DiscoveryPrefix: discoveryPrefix,
+		discovered:      make(map[int64]bool),
+	}, nil
+}
+
+func newStatus(node db.Node, snapshot *notify.Snapshot) Status {
+	status := Status{
+		Alias:     node.Alias,
+		Pubkey:    node.Pubkey,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if snapshot == nil {
+		return status
+	}
+
+	status.Online = true
+	status.SyncedToChain = snapshot.SyncedToChain
+	status.SyncedToGraph = snapshot.SyncedToGraph
+	status.BlockHeight = snapshot.BlockHeight
+	status.ActiveChannels = snapshot.ActiveChannels
+	status.InactiveChannels = snapshot.InactiveChannels
+	status.PendingChannels = snapshot.PendingChannels
+	status.ChannelBalance = snapshot.ChannelBalance
+	status.PendingChannelBalance = snapshot.PendingChannelBalance
+	status.WalletBalance = snapshot.WalletBalance
+	status.UnconfirmedBalance = snapshot.UnconfirmedBalance
+	status.LastBackup = snapshot.LastBackup
+	return status
+}
+
+// PublishStatus publishes the status of a node as a retained message. A nil snapshot
+// publishes the node as offline
+func (p *Publisher) PublishStatus(node db.Node, snapshot *notify.Snapshot) error {
+	if p.DiscoveryPrefix != "" && !p.discovered[node.ID] {
+		if err := p.publishDiscovery(node); err != nil {
+			return err
+		}
+		p.discovered[node.ID] = true
+	}
+
+	payload, err := json.Marshal(newStatus(node, snapshot))
+	if err != nil {
+		return err
+	}
+	return p.Client.Publish(stateTopic(p.Prefix, node), payload, true)
+}
+
+// Close marks the watcher offline and disconnects from the broker
+func (p *Publisher) Close() error {
+	err := p.Client.Publish(availabilityTopic(p.Prefix), []byte(offline), true)
+	if err != nil {
+		return err
+	}
+	return p.Client.Close()
+}
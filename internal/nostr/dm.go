@@ -0,0 +1,106 @@
+package nostr
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// NIPs supported for encrypting direct messages
+const (
+	NIP04 = 4
+	NIP44 = 44
+)
+
+// randomPastTimestamp returns a time up to two days in the past, so gift wraps don't reveal
+// when a message was sent
+func randomPastTimestamp() int64 {
+	offset, err := rand.Int(rand.Reader, big.NewInt(2*24*60*60))
+	if err != nil {
+		return time.Now().Unix()
+	}
+	return time.Now().Unix() - offset.Int64()
+}
+
+// nip04Message returns a kind 4 encrypted direct message
+func nip04Message(sender *btcec.PrivateKey, recipient *btcec.PublicKey, text string) (Event, error) {
+	content, err := encryptNIP04(sender, recipient, text)
+	if err != nil {
+		return Event{}, err
+	}
+	event := Event{
+		CreatedAt: time.Now().Unix(),
+		Kind:      KindEncryptedDirectMessage,
+		Tags:      [][]string{{"p", hex.EncodeToString(schnorr.SerializePubKey(recipient))}},
+		Content:   content,
+	}
+	err = event.sign(sender)
+	return event, err
+}
+
+// giftWrappedMessage returns a NIP-17 private direct message: an unsigned kind 14 message,
+// sealed with NIP-44 by the sender and gift wrapped with NIP-44 by a one-time key
+func giftWrappedMessage(sender *btcec.PrivateKey, recipient *btcec.PublicKey, text string) (Event, error) {
+	recipientHex := hex.EncodeToString(schnorr.SerializePubKey(recipient))
+
+	rumor := Event{
+		PubKey:    hex.EncodeToString(schnorr.SerializePubKey(sender.PubKey())),
+		CreatedAt: time.Now().Unix(),
+		Kind:      KindPrivateDirectMessage,
+		Tags:      [][]string{{"p", recipientHex}},
+		Content:   text,
+	}
+	if err := rumor.computeID(); err != nil {
+		return Event{}, err
+	}
+	rumorJSON, err := marshal(rumor)
+	if err != nil {
+		return Event{}, err
+	}
+
+	sealContent, err := encryptNIP44Random(sender, recipient, string(rumorJSON))
+	if err != nil {
+		return Event{}, err
+	}
+	seal := Event{
+		CreatedAt: randomPastTimestamp(),
+		Kind:      KindSeal,
+		Content:   sealContent,
+	}
+	if err := seal.sign(sender); err != nil {
+		return Event{}, err
+	}
+	sealJSON, err := marshal(seal)
+	if err != nil {
+		return Event{}, err
+	}
+
+	oneTimeKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		return Event{}, err
+	}
+	wrapContent, err := encryptNIP44Random(oneTimeKey, recipient, string(sealJSON))
+	if err != nil {
+		return Event{}, err
+	}
+	wrap := Event{
+		CreatedAt: randomPastTimestamp(),
+		Kind:      KindGiftWrap,
+		Tags:      [][]string{{"p", recipientHex}},
+		Content:   wrapContent,
+	}
+	err = wrap.sign(oneTimeKey)
+	return wrap, err
+}
+
+// directMessage returns an encrypted direct message to the recipient using the given NIP
+func directMessage(sender *btcec.PrivateKey, recipient *btcec.PublicKey, text string, nip int) (Event, error) {
+	if nip == NIP04 {
+		return nip04Message(sender, recipient, text)
+	}
+	return giftWrappedMessage(sender, recipient, text)
+}
@@ -0,0 +1,111 @@
+package nostr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+// Event kinds used by nodewatcher
+const (
+	KindEncryptedDirectMessage = 4
+	KindSeal                   = 13
+	KindPrivateDirectMessage   = 14
+	KindGiftWrap               = 1059
+)
+
+// Event is a nostr event as defined in NIP-01
+type Event struct {
+	ID        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig,omitempty"`
+}
+
+// marshal encodes a value as JSON without escaping HTML characters, as required for
+// computing event IDs
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// computeID sets the ID of the event to the hash of its serialized contents
+func (e *Event) computeID() error {
+	if e.Tags == nil {
+		e.Tags = [][]string{}
+	}
+	serialized, err := marshal([]interface{}{0, e.PubKey, e.CreatedAt, e.Kind, e.Tags, e.Content})
+	if err != nil {
+		return err
+	}
+	id := sha256.Sum256(serialized)
+	e.ID = hex.EncodeToString(id[:])
+	return nil
+}
+
+// sign sets the pubkey, ID and schnorr signature of the event
+func (e *Event) sign(key *btcec.PrivateKey) error {
+	e.PubKey = hex.EncodeToString(schnorr.SerializePubKey(key.PubKey()))
+	if err := e.computeID(); err != nil {
+		return err
+	}
+	id, _ := hex.DecodeString(e.ID)
+	sig, err := schnorr.Sign(key, id)
+	if err != nil {
+		return err
+	}
+	e.Sig = hex.EncodeToString(sig.Serialize())
+	return nil
+}
+
+// DecodePubkey parses a public key given as an npub or as 32 hex encoded bytes
+func DecodePubkey(pubkey string) (*btcec.PublicKey, error) {
+	var raw []byte
+	if strings.HasPrefix(pubkey, "npub1") {
+		hrp, data, err := bech32.Decode(pubkey)
+		if err != nil {
+			return nil, err
+		}
+		if hrp != "npub" {
+			return nil, fmt.Errorf("nostr: unexpected prefix %q", hrp)
+		}
+		raw, err = bech32.ConvertBits(data, 5, 8, false)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		raw, err = hex.DecodeString(pubkey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("nostr: public key must be 32 bytes, got %d", len(raw))
+	}
+	return schnorr.ParsePubKey(raw)
+}
+
+// EncodeNpub encodes a public key as an npub
+func EncodeNpub(pubkey *btcec.PublicKey) (string, error) {
+	data, err := bech32.ConvertBits(schnorr.SerializePubKey(pubkey), 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return bech32.Encode("npub", data)
+}
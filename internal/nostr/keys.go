@@ -0,0 +1,81 @@
+package nostr
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+func newGCM(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptKey encrypts a private key with AES-GCM using a key derived from secret
+func encryptKey(secret string, key []byte) (string, error) {
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, key, nil)), nil
+}
+
+// decryptKey reverses encryptKey
+func decryptKey(secret string, encrypted string) ([]byte, error) {
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("nostr: encrypted key is too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// LoadOrCreateKey loads the private key nodewatcher signs nostr messages with from the db,
+// generating and storing a new key on first use. The key is stored encrypted with secret
+func LoadOrCreateKey(secret string) (*btcec.PrivateKey, error) {
+	stored, err := db.FindNostrKey()
+	if err == nil {
+		raw, err := decryptKey(secret, stored.EncryptedKey)
+		if err != nil {
+			return nil, err
+		}
+		key, _ := btcec.PrivKeyFromBytes(raw)
+		return key, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	key, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := encryptKey(secret, key.Serialize())
+	if err != nil {
+		return nil, err
+	}
+	err = db.InsertNostrKey(&db.NostrKey{EncryptedKey: encrypted})
+	return key, err
+}
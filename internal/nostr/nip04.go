@@ -0,0 +1,39 @@
+package nostr
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// encryptNIP04 encrypts a direct message as defined in NIP-04: AES-256-CBC keyed with the
+// x coordinate of the ECDH shared point
+func encryptNIP04(sender *btcec.PrivateKey, recipient *btcec.PublicKey, plaintext string) (string, error) {
+	key := btcec.GenerateSharedSecret(sender, recipient)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	// PKCS#7 padding
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append([]byte(plaintext), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	return fmt.Sprintf("%s?iv=%s",
+		base64.StdEncoding.EncodeToString(ciphertext),
+		base64.StdEncoding.EncodeToString(iv)), nil
+}
@@ -0,0 +1,81 @@
+package nostr
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/hkdf"
+)
+
+const nip44Version = 2
+
+// conversationKey derives the NIP-44 key shared by a sender and a recipient
+func conversationKey(sender *btcec.PrivateKey, recipient *btcec.PublicKey) []byte {
+	shared := btcec.GenerateSharedSecret(sender, recipient)
+	return hkdf.Extract(sha256.New, shared, []byte("nip44-v2"))
+}
+
+// calcPaddedLen rounds the length of a message up so that the ciphertext leaks less about it
+func calcPaddedLen(unpaddedLen int) int {
+	if unpaddedLen <= 32 {
+		return 32
+	}
+	nextPower := 1 << bits.Len(uint(unpaddedLen-1))
+	chunk := 32
+	if nextPower > 256 {
+		chunk = nextPower / 8
+	}
+	return chunk * ((unpaddedLen-1)/chunk + 1)
+}
+
+// encryptNIP44 encrypts a message with a conversation key and a 32 byte nonce as defined in
+// NIP-44 version 2
+func encryptNIP44(convKey []byte, nonce []byte, plaintext string) (string, error) {
+	if len(plaintext) < 1 || len(plaintext) > 65535 {
+		return "", errors.New("nostr: message must be between 1 and 65535 bytes")
+	}
+
+	keys := make([]byte, 76)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, convKey, nonce), keys); err != nil {
+		return "", err
+	}
+	chachaKey, chachaNonce, hmacKey := keys[0:32], keys[32:44], keys[44:76]
+
+	padded := make([]byte, 2+calcPaddedLen(len(plaintext)))
+	binary.BigEndian.PutUint16(padded, uint16(len(plaintext)))
+	copy(padded[2:], plaintext)
+
+	stream, err := chacha20.NewUnauthenticatedCipher(chachaKey, chachaNonce)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(padded))
+	stream.XORKeyStream(ciphertext, padded)
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(nonce)
+	mac.Write(ciphertext)
+
+	payload := []byte{nip44Version}
+	payload = append(payload, nonce...)
+	payload = append(payload, ciphertext...)
+	payload = mac.Sum(payload)
+	return base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// encryptNIP44Random encrypts a message from sender to recipient with a random nonce
+func encryptNIP44Random(sender *btcec.PrivateKey, recipient *btcec.PublicKey, plaintext string) (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return encryptNIP44(conversationKey(sender, recipient), nonce, plaintext)
+}
@@ -0,0 +1,51 @@
+// Package nostr sends nodewatcher alerts as encrypted nostr direct messages (NIP-04 or
+// NIP-17/NIP-44) from a nodewatcher-owned key to the npub configured by each user
+package nostr
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+)
+
+// Notifier publishes direct messages to a list of relays
+type Notifier struct {
+	Key      *btcec.PrivateKey
+	Relays   []string
+	Attempts int
+}
+
+// NewNotifier returns a notifier that signs messages with key and publishes them to relays
+func NewNotifier(key *btcec.PrivateKey, relays []string) *Notifier {
+	return &Notifier{
+		Key:      key,
+		Relays:   relays,
+		Attempts: 3,
+	}
+}
+
+// Channel is the name of the channel alerts are delivered over
+func (n *Notifier) Channel() string {
+	return notify.ChannelNostr
+}
+
+// Notify sends an alert to the user's npub. Users without an npub are skipped with
+// notify.ErrNotConfigured
+func (n *Notifier) Notify(user db.User, alert notify.Alert) error {
+	if user.NostrPubkey == "" {
+		return notify.ErrNotConfigured
+	}
+	recipient, err := DecodePubkey(user.NostrPubkey)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("%s%s", alert.Title(), alert.Message)
+	event, err := directMessage(n.Key, recipient, text, user.NostrNIP)
+	if err != nil {
+		return err
+	}
+	return publishToRelays(n.Relays, n.Attempts, event)
+}
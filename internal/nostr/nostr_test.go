@@ -0,0 +1,75 @@
+package nostr
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCalcPaddedLen(t *testing.T) {
+	cases := map[int]int{1: 32, 32: 32, 33: 64, 64: 64, 65: 96, 100: 128, 200: 224, 320: 320, 383: 384, 400: 448, 515: 640, 900: 1024, 65535: 65536}
+	for unpadded, expected := range cases {
+		if actual := calcPaddedLen(unpadded); actual != expected {
+			t.Errorf("calcPaddedLen(%d) = %d, expected %d", unpadded, actual, expected)
+		}
+	}
+}
+
+// Test vector from the NIP-44 specification
+func TestEncryptNIP44(t *testing.T) {
+	convKey, _ := hex.DecodeString("c41c775356fd92eadc63ff5a0dc1da211b268cbea22316767095b2871ea1412d")
+	nonce, _ := hex.DecodeString("0000000000000000000000000000000000000000000000000000000000000001")
+
+	payload, err := encryptNIP44(convKey, nonce, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "AgAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAABee0G5VSK0/9YypIObAtDKfYEAjD35uVkHyB0F4DwrcNaCXlCWZKaArsGrY6M9wnuTMxWfp1RTN9Xga8no+kF5Vsb"
+	if payload != expected {
+		t.Errorf("unexpected payload %s", payload)
+	}
+}
+
+// fakeRelay accepts events whose content does not contain "reject"
+func fakeRelay(t *testing.T) string {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		var envelope []interface{}
+		if err := conn.ReadJSON(&envelope); err != nil {
+			return
+		}
+		event := envelope[1].(map[string]interface{})
+		accepted := !strings.Contains(event["content"].(string), "reject")
+		conn.WriteJSON([]interface{}{"NOTICE", "hello"})
+		conn.WriteJSON([]interface{}{"OK", event["id"], accepted, "blocked: test"})
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestPublishToRelays(t *testing.T) {
+	relay := fakeRelay(t)
+	event := Event{ID: "abc", Kind: KindGiftWrap, Content: "hello"}
+
+	err := publishToRelays([]string{"ws://127.0.0.1:1", relay}, 1, event)
+	if err != nil {
+		t.Errorf("expected one relay to accept the event: %s", err)
+	}
+
+	event.Content = "reject"
+	err = publishToRelays([]string{relay}, 1, event)
+	if err == nil || !strings.Contains(err.Error(), "blocked: test") {
+		t.Errorf("expected rejection, got %v", err)
+	}
+}
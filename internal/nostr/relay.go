@@ -0,0 +1,88 @@
+package nostr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// publish sends an event to a relay and waits for the relay to accept it
+func publish(ctx context.Context, relayURL string, event Event) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, relayURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)  //nolint:errcheck
+		conn.SetWriteDeadline(deadline) //nolint:errcheck
+	}
+
+	err = conn.WriteJSON([]interface{}{"EVENT", event})
+	if err != nil {
+		return err
+	}
+
+	for {
+		var msg []json.RawMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+		if len(msg) < 3 {
+			continue
+		}
+
+		var msgType, eventID string
+		json.Unmarshal(msg[0], &msgType) //nolint:errcheck
+		json.Unmarshal(msg[1], &eventID) //nolint:errcheck
+		if msgType != "OK" || eventID != event.ID {
+			continue
+		}
+
+		var accepted bool
+		var reason string
+		json.Unmarshal(msg[2], &accepted) //nolint:errcheck
+		if len(msg) > 3 {
+			json.Unmarshal(msg[3], &reason) //nolint:errcheck
+		}
+		if !accepted {
+			return fmt.Errorf("rejected: %s", reason)
+		}
+		return nil
+	}
+}
+
+// publishToRelays sends an event to every relay, retrying each relay up to attempts times.
+// It succeeds if at least one relay accepted the event
+func publishToRelays(relays []string, attempts int, event Event) error {
+	var errs []string
+	accepted := 0
+
+	for _, relay := range relays {
+		for attempt := 1; attempt <= attempts; attempt++ {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := publish(ctx, relay, event)
+			cancel()
+			if err == nil {
+				accepted++
+				break
+			}
+			if attempt == attempts {
+				errs = append(errs, fmt.Sprintf("%s: %s", relay, err))
+				break
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+
+	if accepted == 0 {
+		return errors.New("nostr: no relay accepted the event: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
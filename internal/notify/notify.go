@@ -0,0 +1,117 @@
+// Package notify defines the alerts sent to nodewatcher users and the interface implemented
+// by each messaging service that delivers them
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+// Event is the kind of alert being sent
+type Event string
+
+const (
+	// EventReport is the scheduled status report covering all of a user's nodes. Its Node is
+	// the zero value
+	EventReport Event = "report"
+	// EventTrigger is sent when a health check starts failing
+	EventTrigger Event = "trigger"
+	// EventResolve is sent when a failing health check recovers
+	EventResolve Event = "resolve"
+)
+
+// Severity is how urgent an alert is
+type Severity string
+
+const (
+	// SeverityInfo is used for status reports and recoveries
+	SeverityInfo Severity = "info"
+	// SeverityWarning is used for degraded nodes, e.g. a node that is not synced
+	SeverityWarning Severity = "warning"
+	// SeverityCritical is used when funds may be at risk, e.g. a node that is down
+	SeverityCritical Severity = "critical"
+)
+
+// Snapshot is the state of a lightning node at the time an alert was raised. Balances are in
+// satoshis and are only set by health.GetSnapshot
+type Snapshot struct {
+	SyncedToChain         bool
+	SyncedToGraph         bool
+	BlockHeight           uint32
+	ActiveChannels        uint32
+	InactiveChannels      uint32
+	PendingChannels       uint32
+	ChannelBalance        int64
+	PendingChannelBalance int64
+	WalletBalance         int64
+	UnconfirmedBalance    int64
+	LastBackup            time.Time
+}
+
+// Alert is a message about the state of a lightning node. Snapshot is nil when the node
+// could not be reached
+type Alert struct {
+	Node     db.Node
+	Event    Event
+	Check    string
+	Severity Severity
+	Message  string
+	Snapshot *Snapshot
+}
+
+// Title is a one line summary of the alert
+func (a Alert) Title() string {
+	switch a.Event {
+	case EventTrigger:
+		return fmt.Sprintf("%s: %s failing", a.Node.Alias, a.Check)
+	case EventResolve:
+		return fmt.Sprintf("%s: %s resolved", a.Node.Alias, a.Check)
+	default:
+		if a.Node.Alias == "" {
+			return "nodewatcher status report"
+		}
+		return fmt.Sprintf("%s: status report", a.Node.Alias)
+	}
+}
+
+// DedupKey identifies all alerts about the same health check on the same node, so a
+// resolve can be matched to the trigger it clears
+func (a Alert) DedupKey() string {
+	return fmt.Sprintf("nodewatcher-%d-%s", a.Node.ID, a.Check)
+}
+
+// Names of the channels alerts are delivered over
+const (
+	ChannelSMS       = "sms"
+	ChannelTelegram  = "telegram"
+	ChannelPagerDuty = "pagerduty"
+	ChannelSlack     = "slack"
+	ChannelDiscord   = "discord"
+	ChannelNostr     = "nostr"
+)
+
+// ErrNotConfigured is returned by a notifier that did not send an alert because the user has
+// not set up its messaging service, or the service does not take that kind of alert
+var ErrNotConfigured = errors.New("messaging service not configured")
+
+// Notifier delivers alerts to a user over a messaging service
+type Notifier interface {
+	Notify(user db.User, alert Alert) error
+}
+
+// ChannelNotifier is a notifier whose alert text can be customized with a template for its channel
+type ChannelNotifier interface {
+	Notifier
+	Channel() string
+}
+
+// IncidentNotifier is a notifier that keeps an incident open until it is sent the resolve event
+// of the trigger that opened it, like PagerDuty. Resolve events are always sent to it, even
+// while mutes, quiet hours or silences hold back other alerts
+type IncidentNotifier interface {
+	Notifier
+	TracksIncidents() bool
+}
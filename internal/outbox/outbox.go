@@ -0,0 +1,202 @@
+// Package outbox stores text messages in the database before they are sent, retries them with
+// backoff when Twilio is unavailable, tracks their delivery status and falls back to the user's
+// other messaging services when delivery fails
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+	"github.com/mvpratt/nodewatcher/internal/templates"
+	twilio "github.com/twilio/twilio-go"
+	openapi "github.com/twilio/twilio-go/rest/api/v2010"
+)
+
+// Delivery statuses of a notification. Delivered, failed and undelivered are reported by
+// Twilio status callbacks
+const (
+	StatusPending     = "pending"
+	StatusSent        = "sent"
+	StatusDelivered   = "delivered"
+	StatusFailed      = "failed"
+	StatusUndelivered = "undelivered"
+)
+
+// MaxAttempts is how many times sending a notification is tried before it fails
+const MaxAttempts = 5
+
+// Outbox sends the pending notifications in the database
+type Outbox struct {
+	From         string
+	TwilioClient *twilio.RestClient
+	// StatusCallbackURL is the public URL Twilio reports delivery status to, if set
+	StatusCallbackURL string
+	// Fallback delivers notifications that could not be sent by text message
+	Fallback []notify.Notifier
+}
+
+// EnqueueSMS stores a text message about an alert in the outbox, to be sent by Process.
+// deliveredOver are the channels the alert was already sent over, which are skipped if the
+// text message fails and the alert falls back to the user's other messaging services
+func EnqueueSMS(user db.User, alert notify.Alert, deliveredOver []string) error {
+	alert = templates.Apply(user, notify.ChannelSMS, alert)
+	return db.InsertNotification(&db.Notification{
+		UserID:        user.ID,
+		NodeID:        alert.Node.ID,
+		Channel:       notify.ChannelSMS,
+		Recipient:     user.PhoneNumber,
+		Event:         string(alert.Event),
+		CheckName:     alert.Check,
+		Severity:      string(alert.Severity),
+		Body:          alert.Message,
+		Status:        StatusPending,
+		DeliveredOver: strings.Join(deliveredOver, ","),
+	})
+}
+
+// backoff is how long to wait before the next attempt after a number of failed attempts:
+// one minute, doubling after every attempt up to an hour
+func backoff(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
+
+// Process sends the notifications that are due and delivers failed notifications through
+// the fallback notifiers
+func (o *Outbox) Process() {
+	due, err := db.FindDueNotifications([]string{StatusPending}, time.Now().UTC())
+	if err != nil {
+		log.Printf("Error getting pending notifications: %s", err)
+		return
+	}
+	for _, notification := range due {
+		o.attempt(notification)
+	}
+
+	failed, err := db.FindNotificationsNeedingFallback()
+	if err != nil {
+		log.Printf("Error getting failed notifications: %s", err)
+		return
+	}
+	for _, notification := range failed {
+		o.fallback(notification)
+	}
+}
+
+// attempt tries to send a notification once and records the outcome
+func (o *Outbox) attempt(notification db.Notification) {
+	notification.Attempts++
+	sid, err := o.sendSMS(notification)
+	if err != nil {
+		log.Printf("Error sending notification %d (attempt %d): %s", notification.ID, notification.Attempts, err)
+		notification.LastError = err.Error()
+		notification.NextAttemptAt = time.Now().UTC().Add(backoff(notification.Attempts))
+		if notification.Attempts >= MaxAttempts {
+			notification.Status = StatusFailed
+		}
+	} else {
+		log.Printf("\nSMS %s sent successfully!", sid)
+		notification.Status = StatusSent
+		notification.ProviderID = sid
+	}
+
+	err = db.UpdateNotification(notification)
+	if err != nil {
+		log.Printf("Error updating notification %d: %s", notification.ID, err)
+	}
+}
+
+// sendSMS sends a notification by text message and returns its Twilio message SID
+func (o *Outbox) sendSMS(notification db.Notification) (string, error) {
+	params := &openapi.CreateMessageParams{}
+	params.SetTo(notification.Recipient)
+	params.SetFrom(o.From)
+	params.SetBody(notification.Body)
+	if o.StatusCallbackURL != "" {
+		params.SetStatusCallback(o.StatusCallbackURL)
+	}
+
+	message, err := o.TwilioClient.Api.CreateMessage(params)
+	if err != nil {
+		return "", err
+	}
+	if message.Sid == nil {
+		return "", nil
+	}
+	return *message.Sid, nil
+}
+
+// undelivered returns the notifiers that did not deliver the alert of a notification
+func undelivered(notifiers []notify.Notifier, notification db.Notification) []notify.Notifier {
+	delivered := strings.Split(notification.DeliveredOver, ",")
+	var fallback []notify.Notifier
+	for _, notifier := range notifiers {
+		if n, ok := notifier.(notify.ChannelNotifier); ok && contains(delivered, n.Channel()) {
+			continue
+		}
+		fallback = append(fallback, notifier)
+	}
+	return fallback
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// fallback delivers a failed notification through the fallback notifiers that did not
+// already deliver its alert
+func (o *Outbox) fallback(notification db.Notification) {
+	user, err := db.FindUserByID(notification.UserID)
+	if err != nil {
+		log.Printf("Error getting user of notification %d: %s", notification.ID, err)
+		return
+	}
+	var node db.Node // status reports are not about a single node
+	if notification.NodeID != 0 {
+		node, err = db.FindNodeByID(notification.NodeID)
+		if err != nil {
+			log.Printf("Error getting node of notification %d: %s", notification.ID, err)
+			return
+		}
+	}
+
+	reason := notification.Status
+	if notification.LastError != "" {
+		reason = fmt.Sprintf("%s: %s", reason, notification.LastError)
+	}
+	alert := notify.Alert{
+		Node:     node,
+		Event:    notify.Event(notification.Event),
+		Check:    notification.CheckName,
+		Severity: notify.Severity(notification.Severity),
+		Message:  fmt.Sprintf("%s\n\n(Text message to %s %s)", notification.Body, notification.Recipient, reason),
+	}
+	for _, notifier := range undelivered(o.Fallback, notification) {
+		err := notifier.Notify(user, alert)
+		if err != nil && !errors.Is(err, notify.ErrNotConfigured) {
+			log.Printf("Error notifying user %s: %s", user.Email, err)
+		}
+	}
+
+	notification.FallbackAt = time.Now().UTC()
+	err = db.UpdateNotification(notification)
+	if err != nil {
+		log.Printf("Error updating notification %d: %s", notification.ID, err)
+	}
+}
@@ -0,0 +1,45 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{7, time.Hour},
+		{50, time.Hour},
+	}
+	for _, test := range tests {
+		if got := backoff(test.attempts); got != test.want {
+			t.Errorf("backoff(%d) = %s, want %s", test.attempts, got, test.want)
+		}
+	}
+}
+
+type channelNotifier string
+
+func (n channelNotifier) Notify(user db.User, alert notify.Alert) error { return nil }
+
+func (n channelNotifier) Channel() string { return string(n) }
+
+func TestUndelivered(t *testing.T) {
+	notifiers := []notify.Notifier{channelNotifier(notify.ChannelTelegram), channelNotifier(notify.ChannelSlack)}
+
+	fallback := undelivered(notifiers, db.Notification{DeliveredOver: "telegram,pagerduty"})
+	if len(fallback) != 1 || fallback[0] != notify.Notifier(channelNotifier(notify.ChannelSlack)) {
+		t.Errorf("expected only slack to fall back, got %v", fallback)
+	}
+	if fallback := undelivered(notifiers, db.Notification{}); len(fallback) != 2 {
+		t.Errorf("expected every notifier to fall back, got %v", fallback)
+	}
+}
@@ -0,0 +1,148 @@
+// Package pagerduty opens and resolves PagerDuty incidents for failing node health checks
+// using the PagerDuty Events API v2
+package pagerduty
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+)
+
+// DefaultEventsURL is the PagerDuty Events API v2 endpoint
+const DefaultEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// maxSummaryLength is the longest summary accepted by the Events API
+const maxSummaryLength = 1024
+
+// Payload describes the alert that triggered an event
+type Payload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// Event is a request to the Events API v2
+type Event struct {
+	RoutingKey  string   `json:"routing_key"`
+	EventAction string   `json:"event_action"`
+	DedupKey    string   `json:"dedup_key"`
+	Payload     *Payload `json:"payload,omitempty"`
+}
+
+type eventResponse struct {
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+	DedupKey string `json:"dedup_key"`
+}
+
+// Notifier sends trigger and resolve events to PagerDuty. The routing key of the node is
+// used if set, otherwise the routing key of the user. Status reports are not sent
+type Notifier struct {
+	EventsURL  string
+	HTTPClient *http.Client
+}
+
+// NewNotifier returns a notifier for the given Events API endpoint. An empty eventsURL uses
+// the public PagerDuty endpoint
+func NewNotifier(eventsURL string) *Notifier {
+	if eventsURL == "" {
+		eventsURL = DefaultEventsURL
+	}
+	return &Notifier{
+		EventsURL:  eventsURL,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func routingKey(user db.User, node db.Node) string {
+	if node.PagerDutyRoutingKey != "" {
+		return node.PagerDutyRoutingKey
+	}
+	return user.PagerDutyRoutingKey
+}
+
+func newEvent(key string, alert notify.Alert) Event {
+	event := Event{
+		RoutingKey:  key,
+		EventAction: string(alert.Event),
+		DedupKey:    alert.DedupKey(),
+	}
+	if alert.Event != notify.EventTrigger {
+		return event
+	}
+
+	summary := fmt.Sprintf("%s: %s", alert.Node.Alias, strings.TrimSpace(alert.Message))
+	if len(summary) > maxSummaryLength {
+		summary = summary[:maxSummaryLength]
+	}
+	event.Payload = &Payload{
+		Summary:   summary,
+		Source:    alert.Node.Alias,
+		Severity:  string(alert.Severity),
+		Component: "lnd",
+		Group:     alert.Node.Alias,
+		Class:     alert.Check,
+		CustomDetails: map[string]string{
+			"pubkey": alert.Node.Pubkey,
+			"url":    alert.Node.URL,
+		},
+	}
+	return event
+}
+
+// Channel is the name of the channel alerts are delivered over
+func (n *Notifier) Channel() string {
+	return notify.ChannelPagerDuty
+}
+
+// TracksIncidents is true, as a PagerDuty incident stays open until it is resolved
+func (n *Notifier) TracksIncidents() bool {
+	return true
+}
+
+// Notify sends a trigger or resolve event for an alert. Status reports and users without a
+// routing key are skipped with notify.ErrNotConfigured
+func (n *Notifier) Notify(user db.User, alert notify.Alert) error {
+	key := routingKey(user, alert.Node)
+	if key == "" || alert.Event == notify.EventReport {
+		return notify.ErrNotConfigured
+	}
+
+	body, err := json.Marshal(newEvent(key, alert))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.EventsURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		var eventResp eventResponse
+		json.NewDecoder(resp.Body).Decode(&eventResp) //nolint:errcheck
+		return fmt.Errorf("pagerduty: %s: %s", resp.Status, eventResp.Message)
+	}
+	return nil
+}
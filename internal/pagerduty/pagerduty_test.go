@@ -0,0 +1,61 @@
+package pagerduty
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+)
+
+func TestNotify(t *testing.T) {
+	var events []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status":"success","message":"Event processed"}`))
+	}))
+	defer server.Close()
+
+	notifier := NewNotifier(server.URL)
+	user := db.User{PagerDutyRoutingKey: "user-key"}
+	node := db.Node{ID: 3, Alias: "mynode", PagerDutyRoutingKey: "node-key"}
+
+	alerts := []notify.Alert{
+		{Node: node, Event: notify.EventReport, Message: "report"},
+		{Node: node, Event: notify.EventTrigger, Check: "node_down", Severity: notify.SeverityCritical, Message: "\n\nWARNING: down"},
+		{Node: node, Event: notify.EventResolve, Check: "node_down", Severity: notify.SeverityInfo, Message: "\n\nRESOLVED: up"},
+	}
+	for _, alert := range alerts {
+		err := notifier.Notify(user, alert)
+		if alert.Event == notify.EventReport {
+			if !errors.Is(err, notify.ErrNotConfigured) {
+				t.Errorf("expected the status report to be skipped, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].EventAction != "trigger" || events[0].RoutingKey != "node-key" || events[0].Payload.Severity != "critical" {
+		t.Errorf("unexpected trigger %+v", events[0])
+	}
+	if events[0].Payload.Summary != "mynode: WARNING: down" {
+		t.Errorf("unexpected summary %q", events[0].Payload.Summary)
+	}
+	if events[1].EventAction != "resolve" || events[1].DedupKey != events[0].DedupKey {
+		t.Errorf("resolve %+v does not match trigger %+v", events[1], events[0])
+	}
+}
@@ -0,0 +1,220 @@
+// Package phone normalizes phone numbers to E.164 and verifies that users own their phone
+// number with one-time codes sent by text message
+package phone
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	twilio "github.com/twilio/twilio-go"
+	openapi "github.com/twilio/twilio-go/rest/api/v2010"
+)
+
+const (
+	// CodeTTL is how long a verification code is valid
+	CodeTTL = 10 * time.Minute
+	// MaxAttempts is how many wrong codes may be entered before a new code must be sent
+	MaxAttempts = 5
+	// ResendInterval is how long to wait before sending another code
+	ResendInterval = time.Minute
+	// MaxCodesPerDay is how many codes are sent to a user, and to a phone number, per day
+	MaxCodesPerDay = 5
+)
+
+// ErrInvalidCode is returned when a verification code is wrong, expired or used up
+var ErrInvalidCode = errors.New("invalid or expired verification code")
+
+// ErrNumberTaken is returned when a phone number is already verified by another user
+var ErrNumberTaken = errors.New("phone number is already verified by another account")
+
+// Normalize converts a phone number to E.164, e.g. "(555) 555-5555" to "+15555555555".
+// Numbers without a country code are assumed to be North American
+func Normalize(number string) (string, error) {
+	cleaned := strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "").Replace(strings.TrimSpace(number))
+	if strings.HasPrefix(cleaned, "00") {
+		cleaned = "+" + cleaned[2:]
+	}
+
+	digits := strings.TrimPrefix(cleaned, "+")
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", fmt.Errorf("invalid phone number %q", number)
+	}
+	if !strings.HasPrefix(cleaned, "+") {
+		switch {
+		case len(digits) == 10:
+			digits = "1" + digits
+		case len(digits) == 11 && digits[0] == '1':
+		default:
+			return "", fmt.Errorf("invalid phone number %q, include the country code, e.g. +44", number)
+		}
+	}
+	if digits[0] == '0' || len(digits) < 8 || len(digits) > 15 {
+		return "", fmt.Errorf("invalid phone number %q", number)
+	}
+	if digits[0] == '1' && len(digits) != 11 {
+		return "", fmt.Errorf("invalid phone number %q, North American numbers have 10 digits", number)
+	}
+	return "+" + digits, nil
+}
+
+// Verified reports whether a user has verified their phone number. Changing the number clears
+// the verification
+func Verified(user db.User) bool {
+	return !user.PhoneVerifiedAt.IsZero()
+}
+
+// hashCode hashes a verification code so codes are not stored in the db
+func hashCode(code string) string {
+	hash := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(hash[:])
+}
+
+// newCode returns a random six digit code
+func newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// sendAllowed checks the rate limits on sending codes, given when the codes sent to a user in
+// the last day were sent
+func sendAllowed(sent []time.Time, now time.Time) error {
+	var today int
+	for _, sentAt := range sent {
+		if now.Sub(sentAt) < ResendInterval {
+			return fmt.Errorf("a code was just sent, try again in %s", (ResendInterval - now.Sub(sentAt)).Round(time.Second))
+		}
+		if now.Sub(sentAt) < 24*time.Hour {
+			today++
+		}
+	}
+	if today >= MaxCodesPerDay {
+		return fmt.Errorf("too many codes sent, try again tomorrow")
+	}
+	return nil
+}
+
+// Verifier sends verification codes by text message
+type Verifier struct {
+	From         string
+	TwilioClient *twilio.RestClient
+}
+
+// Send texts a new verification code to the user's phone number, subject to rate limits per user
+// and per phone number
+func (v *Verifier) Send(user db.User) error {
+	return v.SendTo(user, user.PhoneNumber)
+}
+
+// SendTo texts a new verification code to another phone number of the user, e.g. an escalation
+// number, subject to the same rate limits
+func (v *Verifier) SendTo(user db.User, number string) error {
+	now := time.Now().UTC()
+	byUser, err := db.FindPhoneVerifications(user.ID, now.Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+	byNumber, err := db.FindPhoneVerificationsByNumber(number, now.Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+	// limit both, so changing the number does not reset the limit and several accounts cannot
+	// flood one number
+	for _, recent := range [][]db.PhoneVerification{byUser, byNumber} {
+		var sent []time.Time
+		for _, verification := range recent {
+			sent = append(sent, verification.CreatedAt)
+		}
+		if err := sendAllowed(sent, now); err != nil {
+			return err
+		}
+	}
+
+	code, err := newCode()
+	if err != nil {
+		return err
+	}
+	err = db.InsertPhoneVerification(&db.PhoneVerification{
+		CreatedAt:   now,
+		UserID:      user.ID,
+		PhoneNumber: number,
+		CodeHash:    hashCode(code),
+		ExpiresAt:   now.Add(CodeTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	params := &openapi.CreateMessageParams{}
+	params.SetTo(number)
+	params.SetFrom(v.From)
+	params.SetBody(fmt.Sprintf("Your nodewatcher verification code is %s", code))
+	_, err = v.TwilioClient.Api.CreateMessage(params)
+	return err
+}
+
+// Confirm checks a code against the latest code sent to the user's phone number and marks the
+// number as verified if it matches
+func Confirm(user db.User, code string) (db.User, error) {
+	if owner, err := db.FindUserByPhoneNumber(user.PhoneNumber); err == nil && owner.ID != user.ID {
+		return user, ErrNumberTaken
+	}
+	if err := ConfirmNumber(user, user.PhoneNumber, code); err != nil {
+		return user, err
+	}
+	user.PhoneVerifiedAt = time.Now().UTC()
+	return user, db.UpdateUserPhone(user)
+}
+
+// ConfirmNumber checks a code against the latest code sent to a phone number of the user and
+// records the number as verified for the user if it matches
+func ConfirmNumber(user db.User, number string, code string) error {
+	now := time.Now().UTC()
+	recent, err := db.FindPhoneVerifications(user.ID, now.Add(-CodeTTL))
+	if err != nil {
+		return err
+	}
+	var latest db.PhoneVerification
+	for _, verification := range recent {
+		if verification.PhoneNumber == number {
+			latest = verification
+		}
+	}
+	if latest.ID == 0 || !latest.VerifiedAt.IsZero() || now.After(latest.ExpiresAt) || latest.Attempts >= MaxAttempts {
+		return ErrInvalidCode
+	}
+
+	latest.Attempts++
+	if subtle.ConstantTimeCompare([]byte(hashCode(strings.TrimSpace(code))), []byte(latest.CodeHash)) != 1 {
+		if err := db.UpdatePhoneVerification(latest); err != nil {
+			return err
+		}
+		return ErrInvalidCode
+	}
+	latest.VerifiedAt = now
+	return db.UpdatePhoneVerification(latest)
+}
+
+// VerifiedNumbers returns the phone numbers the user has confirmed a code for, including
+// escalation numbers
+func VerifiedNumbers(user db.User) (map[string]bool, error) {
+	numbers, err := db.FindVerifiedPhoneNumbers(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	verified := make(map[string]bool)
+	for _, number := range numbers {
+		verified[number] = true
+	}
+	return verified, nil
+}
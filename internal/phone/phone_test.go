@@ -0,0 +1,50 @@
+package phone
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	valid := map[string]string{
+		"5555555555":        "+15555555555",
+		"(555) 555-5555":    "+15555555555",
+		"1-555-555-5555":    "+15555555555",
+		"+1 555 555 5555":   "+15555555555",
+		"+44 20 7946 0958":  "+442079460958",
+		"0044 20 7946 0958": "+442079460958",
+	}
+	for input, expected := range valid {
+		actual, err := Normalize(input)
+		if err != nil || actual != expected {
+			t.Errorf("Normalize(%q) = %q, %v, want %q", input, actual, err, expected)
+		}
+	}
+
+	for _, input := range []string{"", "555-5555", "+1 555 5555", "not a number", "+0123456789", "+1234567890123456"} {
+		if actual, err := Normalize(input); err == nil {
+			t.Errorf("Normalize(%q) = %q, expected an error", input, actual)
+		}
+	}
+}
+
+func TestSendAllowed(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := sendAllowed(nil, now); err != nil {
+		t.Errorf("expected the first code to be sent, got %s", err)
+	}
+	if err := sendAllowed([]time.Time{now.Add(-30 * time.Second)}, now); err == nil {
+		t.Error("expected a code to wait for the resend interval")
+	}
+
+	var sent []time.Time
+	for i := 1; i <= MaxCodesPerDay; i++ {
+		sent = append(sent, now.Add(-time.Duration(i)*time.Hour))
+	}
+	if err := sendAllowed(sent, now); err == nil {
+		t.Error("expected the daily limit to be enforced")
+	}
+	if err := sendAllowed(sent[1:], now); err != nil {
+		t.Errorf("expected a code below the daily limit, got %s", err)
+	}
+}
@@ -0,0 +1,215 @@
+// Package s3 uploads and downloads objects from S3-compatible object storage such as AWS S3,
+// MinIO and Backblaze B2, signing requests with AWS Signature Version 4
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultRegion is used when no region is configured. MinIO accepts any region
+const DefaultRegion = "us-east-1"
+
+const (
+	algorithm    = "AWS4-HMAC-SHA256"
+	amzDate      = "20060102T150405Z"
+	shortDate    = "20060102"
+	service      = "s3"
+	maxErrorBody = 64 * 1024
+)
+
+// Client reads and writes objects of one bucket. Objects are addressed path-style, i.e.
+// <endpoint>/<bucket>/<key>, which all S3-compatible stores support
+type Client struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	HTTPClient      *http.Client
+}
+
+// NewClient returns a client for a bucket. The endpoint is a URL such as
+// https://s3.us-east-1.amazonaws.com or http://localhost:9000. An empty region uses DefaultRegion
+func NewClient(endpoint, region, bucket, accessKeyID, secretAccessKey string) *Client {
+	if region == "" {
+		region = DefaultRegion
+	}
+	return &Client{
+		Endpoint:        strings.TrimSuffix(endpoint, "/"),
+		Region:          region,
+		Bucket:          bucket,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		HTTPClient:      &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Error is an error response of the object store
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s (%d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// PutObject uploads an object with the given extra headers, e.g. x-amz-server-side-encryption,
+// and returns its ETag. The store checks the upload against its MD5 and SHA-256 hashes
+func (c *Client) PutObject(ctx context.Context, key string, body []byte, header http.Header) (string, error) {
+	req, err := c.newRequest(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return "", err
+	}
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	sum := md5.Sum(body)
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+
+	resp, err := c.do(req, body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// GetObject downloads an object
+func (c *Client) GetObject(ctx context.Context, key string) ([]byte, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, key string, body []byte) (*http.Request, error) {
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3: invalid endpoint: %w", err)
+	}
+	endpoint.Path = "/" + c.Bucket + "/" + key
+	endpoint.RawPath = "/" + escapePath(c.Bucket) + "/" + escapePath(key)
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	return http.NewRequestWithContext(ctx, method, endpoint.String(), reader)
+}
+
+// do signs and sends a request, and turns error responses into an *Error
+func (c *Client) do(req *http.Request, body []byte) (*http.Response, error) {
+	hash := sha256.Sum256(body)
+	c.sign(req, hex.EncodeToString(hash[:]), time.Now())
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	s3Err := &Error{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	xml.Unmarshal(data, s3Err)
+	return nil, s3Err
+}
+
+// sign adds the x-amz-date, x-amz-content-sha256 and Authorization headers of AWS Signature
+// Version 4 to a request. Host, x-amz-* and content headers are signed
+func (c *Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(amzDate))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || strings.HasPrefix(name, "content-") || name == "range" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format(shortDate), c.Region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{algorithm, now.Format(amzDate), scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), now.Format(shortDate))
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		algorithm, c.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapePath URI-encodes an object key the way Signature Version 4 expects, leaving slashes as is
+func escapePath(path string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(path) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/':
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
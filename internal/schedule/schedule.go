@@ -0,0 +1,164 @@
+// Package schedule decides when a user's status reports are due and when their quiet hours
+// are, in the user's own timezone
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // the alpine image has no zoneinfo
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+// reportWindow is how long after a scheduled report time the report may still be sent
+const reportWindow = time.Hour
+
+// weekdays maps short and full weekday names to weekdays
+var weekdays = make(map[string]time.Weekday)
+
+func init() {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		weekdays[name] = day
+		weekdays[name[:3]] = day
+	}
+}
+
+// Schedule is when a user receives status reports and when only critical alerts are delivered.
+// Times of day are minutes after local midnight
+type Schedule struct {
+	Location    *time.Location
+	ReportTimes []int
+	Weekdays    [7]bool
+	QuietStart  int
+	QuietEnd    int
+}
+
+// parseClock parses a time of day like "07:30" into minutes after midnight
+func parseClock(clock string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(clock), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return hour*60 + minute, nil
+}
+
+// splitList splits a comma separated list, dropping empty entries
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Parse builds a schedule from an IANA timezone, comma separated report times ("08:00,18:00"),
+// comma separated weekdays ("mon,tue") and quiet hours. An empty timezone is UTC, no weekdays
+// means every day and equal or empty quiet hours disable them
+func Parse(timezone string, reportTimes string, reportWeekdays string, quietStart string, quietEnd string) (Schedule, error) {
+	var schedule Schedule
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return schedule, fmt.Errorf("invalid timezone %q", timezone)
+	}
+	schedule.Location = location
+
+	for _, clock := range splitList(reportTimes) {
+		minutes, err := parseClock(clock)
+		if err != nil {
+			return schedule, err
+		}
+		schedule.ReportTimes = append(schedule.ReportTimes, minutes)
+	}
+	sort.Ints(schedule.ReportTimes)
+
+	days := splitList(reportWeekdays)
+	for _, day := range days {
+		weekday, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return schedule, fmt.Errorf("invalid weekday %q", day)
+		}
+		schedule.Weekdays[weekday] = true
+	}
+	if len(days) == 0 {
+		for i := range schedule.Weekdays {
+			schedule.Weekdays[i] = true
+		}
+	}
+
+	if quietStart != "" || quietEnd != "" {
+		if schedule.QuietStart, err = parseClock(quietStart); err != nil {
+			return schedule, err
+		}
+		if schedule.QuietEnd, err = parseClock(quietEnd); err != nil {
+			return schedule, err
+		}
+	}
+	return schedule, nil
+}
+
+// FromUser gets the schedule of a user. Users without report times get a daily report at the
+// hour of their SmsNotifyTime
+func FromUser(user db.User) (Schedule, error) {
+	reportTimes := user.ReportTimes
+	if reportTimes == "" {
+		reportTimes = fmt.Sprintf("%02d:00", user.SmsNotifyTime.Hour())
+	}
+	return Parse(user.Timezone, reportTimes, user.ReportWeekdays, user.QuietStart, user.QuietEnd)
+}
+
+// LastReportTime is the latest scheduled report time at or before now, or the zero time if
+// there is none in the past week
+func (s Schedule) LastReportTime(now time.Time) time.Time {
+	local := now.In(s.Location)
+	for daysAgo := 0; daysAgo <= 7; daysAgo++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()-daysAgo, 0, 0, 0, 0, s.Location)
+		if !s.Weekdays[day.Weekday()] {
+			continue
+		}
+		for i := len(s.ReportTimes) - 1; i >= 0; i-- {
+			reportTime := time.Date(day.Year(), day.Month(), day.Day(), 0, s.ReportTimes[i], 0, 0, s.Location)
+			if !reportTime.After(now) {
+				return reportTime
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// ReportDue reports whether a status report should be sent: a scheduled report time has passed
+// within the last hour and no report has been sent since
+func (s Schedule) ReportDue(now time.Time, lastSent time.Time) bool {
+	reportTime := s.LastReportTime(now)
+	if reportTime.IsZero() {
+		return false
+	}
+	return lastSent.Before(reportTime) && now.Sub(reportTime) < reportWindow
+}
+
+// Quiet reports whether now falls within the quiet hours. Quiet hours may span midnight
+func (s Schedule) Quiet(now time.Time) bool {
+	if s.Location == nil || s.QuietStart == s.QuietEnd {
+		return false
+	}
+	local := now.In(s.Location)
+	minutes := local.Hour()*60 + local.Minute()
+	if s.QuietStart < s.QuietEnd {
+		return minutes >= s.QuietStart && minutes < s.QuietEnd
+	}
+	return minutes >= s.QuietStart || minutes < s.QuietEnd
+}
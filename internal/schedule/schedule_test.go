@@ -0,0 +1,69 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReportDue(t *testing.T) {
+	schedule, err := Parse("America/New_York", "08:00,18:30", "mon,tue,wed,thu,fri", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork := schedule.Location
+
+	// Wednesday 08:10 in New York
+	now := time.Date(2023, 3, 1, 8, 10, 0, 0, newYork)
+	if !schedule.ReportDue(now, now.Add(-12*time.Hour)) {
+		t.Error("expected morning report to be due")
+	}
+	if schedule.ReportDue(now, now.Add(-5*time.Minute)) {
+		t.Error("expected no report after one was sent")
+	}
+	if schedule.ReportDue(now.Add(2*time.Hour), time.Time{}) {
+		t.Error("expected no report outside the report window")
+	}
+
+	// Saturday 08:10 in New York
+	saturday := time.Date(2023, 3, 4, 8, 10, 0, 0, newYork)
+	if schedule.ReportDue(saturday, time.Time{}) {
+		t.Error("expected no report on the weekend")
+	}
+	if got := schedule.LastReportTime(saturday); !got.Equal(time.Date(2023, 3, 3, 18, 30, 0, 0, newYork)) {
+		t.Errorf("unexpected last report time %s", got)
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	schedule, err := Parse("Europe/Berlin", "09:00", "", "22:00", "07:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin := schedule.Location
+
+	if !schedule.Quiet(time.Date(2023, 3, 1, 23, 0, 0, 0, berlin)) {
+		t.Error("expected quiet before midnight")
+	}
+	if !schedule.Quiet(time.Date(2023, 3, 2, 6, 59, 0, 0, berlin)) {
+		t.Error("expected quiet after midnight")
+	}
+	if schedule.Quiet(time.Date(2023, 3, 2, 7, 0, 0, 0, berlin)) {
+		t.Error("expected quiet hours to end at 07:00")
+	}
+	// 21:30 UTC is 22:30 in Berlin
+	if !schedule.Quiet(time.Date(2023, 3, 1, 21, 30, 0, 0, time.UTC)) {
+		t.Error("expected quiet hours in the user's timezone")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse("Mars/Olympus", "", "", "", ""); err == nil {
+		t.Error("expected invalid timezone error")
+	}
+	if _, err := Parse("UTC", "25:00", "", "", ""); err == nil {
+		t.Error("expected invalid time error")
+	}
+	if _, err := Parse("UTC", "", "someday", "", ""); err == nil {
+		t.Error("expected invalid weekday error")
+	}
+}
@@ -0,0 +1,123 @@
+// Package silence decides which alerts are suppressed by maintenance windows and ad-hoc silences
+package silence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+// Kinds of silences
+const (
+	KindMaintenance = "maintenance"
+	KindSilence     = "silence"
+)
+
+// Recurrences of silences
+const (
+	RecurrenceNone   = ""
+	RecurrenceDaily  = "daily"
+	RecurrenceWeekly = "weekly"
+)
+
+// Validate checks that a silence has a known kind and recurrence and ends after it starts
+func Validate(s db.Silence) error {
+	if s.Kind != KindMaintenance && s.Kind != KindSilence {
+		return fmt.Errorf("kind must be %q or %q", KindMaintenance, KindSilence)
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+	period := period(s)
+	if period < 0 {
+		return fmt.Errorf("recurrence must be empty, %q or %q", RecurrenceDaily, RecurrenceWeekly)
+	}
+	if period > 0 && s.EndsAt.Sub(s.StartsAt) > period {
+		return fmt.Errorf("a %s silence cannot last longer than %s", s.Recurrence, period)
+	}
+	return nil
+}
+
+// period is how often a silence repeats, 0 if it does not and -1 if the recurrence is unknown
+func period(s db.Silence) time.Duration {
+	switch s.Recurrence {
+	case RecurrenceNone:
+		return 0
+	case RecurrenceDaily:
+		return 24 * time.Hour
+	case RecurrenceWeekly:
+		return 7 * 24 * time.Hour
+	default:
+		return -1
+	}
+}
+
+// window is the latest occurrence of a silence that starts at or before now, or the first
+// occurrence if the silence has not started yet
+func window(s db.Silence, now time.Time) (time.Time, time.Time) {
+	period := period(s)
+	if period <= 0 || now.Before(s.StartsAt) {
+		return s.StartsAt, s.EndsAt
+	}
+	occurrence := now.Sub(s.StartsAt) / period
+	start := s.StartsAt.Add(occurrence * period)
+	if !s.RepeatUntil.IsZero() && start.After(s.RepeatUntil) {
+		occurrence = s.RepeatUntil.Sub(s.StartsAt) / period
+		start = s.StartsAt.Add(occurrence * period)
+	}
+	return start, start.Add(s.EndsAt.Sub(s.StartsAt))
+}
+
+// Active reports whether a silence is in effect at now
+func Active(s db.Silence, now time.Time) bool {
+	start, end := window(s, now)
+	return !now.Before(start) && now.Before(end)
+}
+
+// LastEnded returns the latest occurrence of a silence that ended at or before now
+func LastEnded(s db.Silence, now time.Time) (time.Time, time.Time, bool) {
+	start, end := window(s, now)
+	if end.After(now) {
+		period := period(s)
+		if period <= 0 {
+			return time.Time{}, time.Time{}, false
+		}
+		start, end = start.Add(-period), end.Add(-period)
+		if start.Before(s.StartsAt) {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	return start, end, true
+}
+
+// End ends a silence at now, for a user who ends it early. An active window is cut short and a
+// recurring silence does not repeat again. The silence is kept as a one-off silence of its
+// latest window, so the alerts it suppressed are still summarized
+func End(s db.Silence, now time.Time) db.Silence {
+	start, end := window(s, now)
+	if now.Before(start) {
+		start, end = now, now // it never started
+	}
+	if end.After(now) {
+		end = now
+	}
+	s.StartsAt, s.EndsAt = start, end
+	s.Recurrence, s.RepeatUntil = RecurrenceNone, time.Time{}
+	return s
+}
+
+// Matches reports whether a silence applies to a check of a node
+func Matches(s db.Silence, nodeID int64, check string) bool {
+	return (s.NodeID == 0 || s.NodeID == nodeID) && (s.CheckName == "" || s.CheckName == check)
+}
+
+// Find returns the silence of a user that suppresses alerts about a check of a node at now
+func Find(silences []db.Silence, nodeID int64, check string, now time.Time) (db.Silence, bool) {
+	for _, s := range silences {
+		if Matches(s, nodeID, check) && Active(s, now) {
+			return s, true
+		}
+	}
+	return db.Silence{}, false
+}
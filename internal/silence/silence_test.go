@@ -0,0 +1,91 @@
+package silence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+)
+
+func TestActive(t *testing.T) {
+	start := time.Date(2023, 3, 1, 2, 0, 0, 0, time.UTC)
+	oneOff := db.Silence{Kind: KindMaintenance, StartsAt: start, EndsAt: start.Add(time.Hour)}
+	if Active(oneOff, start.Add(-time.Minute)) || !Active(oneOff, start) || Active(oneOff, start.Add(time.Hour)) {
+		t.Error("unexpected one-off window")
+	}
+
+	weekly := oneOff
+	weekly.Recurrence = RecurrenceWeekly
+	weekly.RepeatUntil = start.AddDate(0, 0, 14)
+	if !Active(weekly, start.AddDate(0, 0, 7).Add(30*time.Minute)) {
+		t.Error("expected weekly window to repeat")
+	}
+	if Active(weekly, start.AddDate(0, 0, 1).Add(30*time.Minute)) {
+		t.Error("expected no window the next day")
+	}
+	if Active(weekly, start.AddDate(0, 0, 21).Add(30*time.Minute)) {
+		t.Error("expected no window after repeat_until")
+	}
+}
+
+func TestLastEnded(t *testing.T) {
+	start := time.Date(2023, 3, 1, 2, 0, 0, 0, time.UTC)
+	daily := db.Silence{Kind: KindMaintenance, StartsAt: start, EndsAt: start.Add(time.Hour), Recurrence: RecurrenceDaily}
+
+	if _, _, ok := LastEnded(daily, start.Add(30*time.Minute)); ok {
+		t.Error("expected no ended window during the first window")
+	}
+	from, to, ok := LastEnded(daily, start.AddDate(0, 0, 1).Add(30*time.Minute))
+	if !ok || !from.Equal(start) || !to.Equal(start.Add(time.Hour)) {
+		t.Errorf("unexpected last window %s - %s", from, to)
+	}
+}
+
+func TestFind(t *testing.T) {
+	now := time.Date(2023, 3, 1, 2, 30, 0, 0, time.UTC)
+	silences := []db.Silence{
+		{ID: 1, NodeID: 7, CheckName: "synced_to_graph", StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)},
+		{ID: 2, NodeID: 8, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)},
+	}
+	if s, ok := Find(silences, 7, "synced_to_graph", now); !ok || s.ID != 1 {
+		t.Error("expected check silence to match")
+	}
+	if _, ok := Find(silences, 7, "node_down", now); ok {
+		t.Error("expected other checks to not match")
+	}
+	if s, ok := Find(silences, 8, "node_down", now); !ok || s.ID != 2 {
+		t.Error("expected node silence to match all checks")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	start := time.Date(2023, 3, 1, 2, 0, 0, 0, time.UTC)
+	if err := Validate(db.Silence{Kind: "nap", StartsAt: start, EndsAt: start.Add(time.Hour)}); err == nil {
+		t.Error("expected invalid kind error")
+	}
+	if err := Validate(db.Silence{Kind: KindSilence, StartsAt: start, EndsAt: start}); err == nil {
+		t.Error("expected empty window error")
+	}
+	if err := Validate(db.Silence{Kind: KindSilence, StartsAt: start, EndsAt: start.Add(25 * time.Hour), Recurrence: RecurrenceDaily}); err == nil {
+		t.Error("expected overlapping recurrence error")
+	}
+}
+
+func TestEnd(t *testing.T) {
+	start := time.Date(2023, 3, 1, 2, 0, 0, 0, time.UTC)
+	daily := db.Silence{Kind: KindMaintenance, StartsAt: start, EndsAt: start.Add(time.Hour), Recurrence: RecurrenceDaily}
+
+	now := start.AddDate(0, 0, 2).Add(20 * time.Minute)
+	ended := End(daily, now)
+	if Active(ended, now) || Active(ended, now.AddDate(0, 0, 1)) {
+		t.Error("expected an ended silence to stop silencing alerts")
+	}
+	from, to, ok := LastEnded(ended, now)
+	if !ok || !from.Equal(start.AddDate(0, 0, 2)) || !to.Equal(now) {
+		t.Errorf("expected the current window to end now, got %s - %s", from, to)
+	}
+
+	if ended := End(daily, start.Add(-time.Hour)); Active(ended, start) {
+		t.Error("expected a silence ended before it started to never be active")
+	}
+}
@@ -0,0 +1,170 @@
+// Package sms answers the commands users text to the nodewatcher phone number from their
+// registered phone number
+package sms
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/incident"
+	"github.com/mvpratt/nodewatcher/internal/phone"
+)
+
+const helpText = "Nodewatcher commands: STATUS, ACK, MUTE <duration> (e.g. MUTE 4H), UNMUTE, STOP, START"
+
+// parseCommand splits a message like "mute 4h" into the command "MUTE" and its arguments
+func parseCommand(text string) (string, []string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return strings.ToUpper(fields[0]), fields[1:]
+}
+
+// Reply runs the command in an inbound sms from a user and returns the reply
+func Reply(user db.User, text string) string {
+	command, args := parseCommand(text)
+
+	switch command {
+	case "STATUS":
+		return status(user)
+	case "ACK":
+		return ack(user)
+	case "MUTE":
+		return mute(user, args)
+	case "UNMUTE":
+		user.MutedUntil = time.Time{}
+		if err := db.UpdateUserMutedUntil(user); err != nil {
+			return fmt.Sprintf("Error unmuting alerts: %s", err)
+		}
+		return "Alerts resumed."
+	case "STOP":
+		user.SmsEnabled = false
+		if err := db.UpdateUserSmsEnabled(user); err != nil {
+			return fmt.Sprintf("Error disabling sms: %s", err)
+		}
+		return "SMS alerts disabled. Text START to enable them again."
+	case "START":
+		// the message was sent from the user's phone, which verifies the number
+		if !phone.Verified(user) {
+			user.PhoneVerifiedAt = time.Now().UTC()
+		}
+		user.SmsEnabled = true
+		if err := db.UpdateUserPhone(user); err != nil {
+			return fmt.Sprintf("Error enabling sms: %s", err)
+		}
+		return "SMS alerts enabled."
+	default:
+		return helpText
+	}
+}
+
+// ReplyUnverified answers an inbound sms from a number no user has verified. Texting START
+// verifies the number for the user that registered it, as long as exactly one user did
+func ReplyUnverified(number string, text string) string {
+	command, _ := parseCommand(text)
+	if command != "START" {
+		return ""
+	}
+
+	users, err := db.FindUsersByUnverifiedPhoneNumber(number)
+	if err != nil {
+		return fmt.Sprintf("Error finding your account: %s", err)
+	}
+	switch len(users) {
+	case 0:
+		return ""
+	case 1:
+		return Reply(users[0], text)
+	default:
+		return "This number is registered to more than one account. Verify it with a code from the nodewatcher app."
+	}
+}
+
+// TwiML wraps a reply in a TwiML response that Twilio sends back to the user
+func TwiML(reply string) string {
+	if reply == "" {
+		return "<Response></Response>"
+	}
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(reply)) //nolint:errcheck
+	return fmt.Sprintf("<Response><Message>%s</Message></Response>", escaped.String())
+}
+
+// status lists the failing health checks of each of the user's nodes
+func status(user db.User) string {
+	nodes, err := db.FindNodesByUserID(user.ID)
+	if err != nil {
+		return fmt.Sprintf("Error getting nodes: %s", err)
+	}
+	if len(nodes) == 0 {
+		return "No nodes found."
+	}
+
+	var reply strings.Builder
+	for _, node := range nodes {
+		checks, err := db.FindNodeChecks(node.ID)
+		if err != nil {
+			fmt.Fprintf(&reply, "[%s] Error getting checks: %s\n", node.Alias, err)
+			continue
+		}
+		failing := 0
+		for _, check := range checks {
+			if !check.Failing {
+				continue
+			}
+			failing++
+			acknowledged := ""
+			if !check.AcknowledgedAt.IsZero() {
+				acknowledged = " (acked)"
+			}
+			fmt.Fprintf(&reply, "[%s] %s%s: %s\n", node.Alias, check.Name, acknowledged, check.Message)
+		}
+		if failing == 0 {
+			fmt.Fprintf(&reply, "[%s] OK\n", node.Alias)
+		}
+	}
+	if time.Now().Before(user.MutedUntil) {
+		fmt.Fprintf(&reply, "Alerts muted until %s", user.MutedUntil.Format(time.RFC850))
+	}
+	return strings.TrimSpace(reply.String())
+}
+
+// ack acknowledges the open incidents and failing health checks of all of the user's nodes and
+// the nodes whose escalation policy notifies the user
+func ack(user db.User) string {
+	nodes, err := incident.Nodes(user)
+	if err != nil {
+		return fmt.Sprintf("Error getting nodes: %s", err)
+	}
+
+	var total int64
+	for _, node := range nodes {
+		acknowledged, err := incident.AcknowledgeNode(node.ID, user.Email+" via sms")
+		if err != nil {
+			return fmt.Sprintf("Error acknowledging checks of %s: %s", node.Alias, err)
+		}
+		total += acknowledged
+	}
+	return fmt.Sprintf("%d check(s) acknowledged.", total)
+}
+
+func mute(user db.User, args []string) string {
+	if len(args) == 0 {
+		return "Usage: MUTE <duration>, e.g. MUTE 4H"
+	}
+	duration, err := time.ParseDuration(strings.ToLower(args[0]))
+	if err != nil || duration <= 0 {
+		return fmt.Sprintf("Invalid duration %q, e.g. MUTE 4H", args[0])
+	}
+
+	user.MutedUntil = time.Now().UTC().Add(duration)
+	if err := db.UpdateUserMutedUntil(user); err != nil {
+		return fmt.Sprintf("Error muting alerts: %s", err)
+	}
+	return fmt.Sprintf("Alerts muted until %s.", user.MutedUntil.Format(time.RFC850))
+}
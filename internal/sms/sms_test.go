@@ -0,0 +1,27 @@
+package sms
+
+import "testing"
+
+func TestParseCommand(t *testing.T) {
+	command, args := parseCommand("  mute 4H ")
+	if command != "MUTE" || len(args) != 1 || args[0] != "4H" {
+		t.Errorf("unexpected command %q args %v", command, args)
+	}
+
+	command, _ = parseCommand("")
+	if command != "" {
+		t.Errorf("expected no command, got %q", command)
+	}
+}
+
+func TestTwiML(t *testing.T) {
+	got := TwiML("[node] <down> & out")
+	want := "<Response><Message>[node] &lt;down&gt; &amp; out</Message></Response>"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if TwiML("") != "<Response></Response>" {
+		t.Errorf("expected empty response, got %s", TwiML(""))
+	}
+}
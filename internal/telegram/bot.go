@@ -0,0 +1,310 @@
+package telegram
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/incident"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+)
+
+const pollTimeout = 30 * time.Second
+
+const helpText = "Nodewatcher commands:" +
+	"\n/link <code> - link this chat to your nodewatcher account" +
+	"\n/status <alias> - current status of your node(s)" +
+	"\n/channels - channels of your node(s)" +
+	"\n/backup <alias> - latest multi-channel backup of your node(s)" +
+	"\n/ack <alias> - acknowledge open incidents and stop escalation calls" +
+	"\n/mute <duration> - mute alerts, e.g. /mute 2h" +
+	"\n/unmute - resume alerts"
+
+const notLinkedText = "This chat is not linked to a nodewatcher account." +
+	"\nRequest a link code from the nodewatcher API and send /link <code>"
+
+// StatusFunc returns the current status message of a node
+type StatusFunc func(node db.Node) (string, error)
+
+// Bot delivers alerts to linked Telegram chats and answers the commands users send to it
+type Bot struct {
+	Client *Client
+	Status StatusFunc
+}
+
+// Channel is the name of the channel alerts are delivered over
+func (b *Bot) Channel() string {
+	return notify.ChannelTelegram
+}
+
+// Notify sends an alert to the user's linked chat. Users that have not linked a chat are skipped
+// with notify.ErrNotConfigured
+func (b *Bot) Notify(user db.User, alert notify.Alert) error {
+	if user.TelegramChatID == 0 {
+		return notify.ErrNotConfigured
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	text := alert.Message
+	if alert.Node.Alias != "" {
+		text = fmt.Sprintf("[%s]%s", alert.Node.Alias, alert.Message)
+	}
+	return b.Client.SendMessage(ctx, user.TelegramChatID, text)
+}
+
+// Run polls for commands sent to the bot until the context is cancelled
+func (b *Bot) Run(ctx context.Context) {
+	var offset int64
+	for ctx.Err() == nil {
+		updates, err := b.Client.GetUpdates(ctx, offset, pollTimeout)
+		if err != nil {
+			log.Printf("Error getting telegram updates: %s", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message == nil {
+				continue
+			}
+			reply := b.handle(ctx, *update.Message)
+			if reply == "" {
+				continue
+			}
+			err := b.Client.SendMessage(ctx, update.Message.Chat.ID, reply)
+			if err != nil {
+				log.Printf("Error replying to telegram chat %d: %s", update.Message.Chat.ID, err)
+			}
+		}
+	}
+}
+
+// parseCommand splits a message like "/status@nodewatcher_bot mynode" into the
+// command "status" and its arguments
+func parseCommand(text string) (string, []string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", nil
+	}
+	command := strings.TrimPrefix(fields[0], "/")
+	command = strings.SplitN(command, "@", 2)[0]
+	return strings.ToLower(command), fields[1:]
+}
+
+// handle runs a command and returns the reply for the chat
+func (b *Bot) handle(ctx context.Context, msg Message) string {
+	command, args := parseCommand(msg.Text)
+
+	switch command {
+	case "":
+		return ""
+	case "start", "link":
+		if len(args) == 0 {
+			return helpText
+		}
+		return link(msg.Chat.ID, args[0])
+	case "help":
+		return helpText
+	}
+
+	user, err := db.FindUserByTelegramChatID(msg.Chat.ID)
+	if err != nil {
+		return notLinkedText
+	}
+
+	switch command {
+	case "status":
+		return b.status(user, args)
+	case "channels":
+		return channels(user, args)
+	case "backup":
+		return b.backup(ctx, msg.Chat.ID, user, args)
+	case "ack":
+		return ack(user, args)
+	case "mute":
+		return mute(user, args)
+	case "unmute":
+		user.MutedUntil = time.Time{}
+		if err := db.UpdateUserMutedUntil(user); err != nil {
+			return fmt.Sprintf("Error unmuting alerts: %s", err)
+		}
+		return "Alerts resumed."
+	default:
+		return helpText
+	}
+}
+
+func link(chatID int64, code string) string {
+	user, err := db.FindUserByTelegramLinkCode(code)
+	if err != nil {
+		return "Unknown link code."
+	}
+	user.TelegramChatID = chatID
+	user.TelegramLinkCode = ""
+	if err := db.UpdateUserTelegram(user); err != nil {
+		return fmt.Sprintf("Error linking chat: %s", err)
+	}
+	return fmt.Sprintf("This chat is now linked to %s.\n\n%s", user.Email, helpText)
+}
+
+// userNodes gets the nodes of a user, limited to the node with the alias in args if one is given
+func userNodes(user db.User, args []string) ([]db.Node, error) {
+	nodes, err := db.FindNodesByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nodes, nil
+	}
+	for _, node := range nodes {
+		if strings.EqualFold(node.Alias, args[0]) {
+			return []db.Node{node}, nil
+		}
+	}
+	return nil, fmt.Errorf("no node with alias %q", args[0])
+}
+
+func (b *Bot) status(user db.User, args []string) string {
+	nodes, err := userNodes(user, args)
+	if err != nil {
+		return err.Error()
+	}
+	if len(nodes) == 0 {
+		return "No nodes found."
+	}
+
+	var reply strings.Builder
+	for _, node := range nodes {
+		statusMsg, err := b.Status(node)
+		if err != nil {
+			statusMsg = fmt.Sprintf("\nError getting status: %s", err)
+		}
+		fmt.Fprintf(&reply, "[%s]%s\n\n", node.Alias, statusMsg)
+	}
+	return strings.TrimSpace(reply.String())
+}
+
+func channels(user db.User, args []string) string {
+	nodes, err := userNodes(user, args)
+	if err != nil {
+		return err.Error()
+	}
+	if len(nodes) == 0 {
+		return "No nodes found."
+	}
+
+	var reply strings.Builder
+	for _, node := range nodes {
+		nodeChannels, err := db.FindChannelsByNodeID(node.ID)
+		if err != nil {
+			fmt.Fprintf(&reply, "[%s] Error getting channels: %s\n\n", node.Alias, err)
+			continue
+		}
+		var lines []string
+		for _, channel := range nodeChannels {
+			if channel.State == db.ChannelClosed {
+				continue
+			}
+			line := fmt.Sprintf("%s:%d %d sats", channel.FundingTxid, channel.OutputIndex, channel.Capacity)
+			if channel.State != db.ChannelOpen {
+				line += " (" + strings.ReplaceAll(channel.State, "_", " ") + ")"
+			}
+			lines = append(lines, line)
+		}
+		fmt.Fprintf(&reply, "[%s] %d channel(s)\n", node.Alias, len(lines))
+		for _, line := range lines {
+			reply.WriteString(line + "\n")
+		}
+		reply.WriteString("\n")
+	}
+	return strings.TrimSpace(reply.String())
+}
+
+func (b *Bot) backup(ctx context.Context, chatID int64, user db.User, args []string) string {
+	nodes, err := userNodes(user, args)
+	if err != nil {
+		return err.Error()
+	}
+	if len(nodes) == 0 {
+		return "No nodes found."
+	}
+
+	for _, node := range nodes {
+		multiBackup, err := db.FindMultiChannelBackupByPubkey(node.Pubkey)
+		if err != nil {
+			return fmt.Sprintf("No backup found for %s.", node.Alias)
+		}
+		data, err := base64.StdEncoding.DecodeString(multiBackup.Backup)
+		if err != nil {
+			return fmt.Sprintf("Error decoding backup of %s: %s", node.Alias, err)
+		}
+		filename := fmt.Sprintf("%s-channel.backup", node.Alias)
+		caption := fmt.Sprintf("Multi-channel backup of %s taken %s, last verified %s", node.Alias,
+			multiBackup.CreatedAt.Format(time.RFC850), multiBackup.VerifiedAt().Format(time.RFC850))
+		err = b.Client.SendDocument(ctx, chatID, filename, data, caption)
+		if err != nil {
+			return fmt.Sprintf("Error sending backup of %s: %s", node.Alias, err)
+		}
+	}
+	return ""
+}
+
+// ackNodes returns the user's nodes and the nodes whose escalation policy notifies the user,
+// or only the one with the given alias
+func ackNodes(user db.User, args []string) ([]db.Node, error) {
+	nodes, err := incident.Nodes(user)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nodes, nil
+	}
+	for _, node := range nodes {
+		if strings.EqualFold(node.Alias, args[0]) {
+			return []db.Node{node}, nil
+		}
+	}
+	return nil, fmt.Errorf("no node with alias %q", args[0])
+}
+
+func ack(user db.User, args []string) string {
+	nodes, err := ackNodes(user, args)
+	if err != nil {
+		return err.Error()
+	}
+	if len(nodes) == 0 {
+		return "No nodes found."
+	}
+
+	var reply strings.Builder
+	for _, node := range nodes {
+		acknowledged, err := incident.AcknowledgeNode(node.ID, user.Email+" via telegram")
+		if err != nil {
+			fmt.Fprintf(&reply, "[%s] Error acknowledging checks: %s\n", node.Alias, err)
+			continue
+		}
+		fmt.Fprintf(&reply, "[%s] %d check(s) acknowledged\n", node.Alias, acknowledged)
+	}
+	return strings.TrimSpace(reply.String())
+}
+
+func mute(user db.User, args []string) string {
+	if len(args) == 0 {
+		return "Usage: /mute <duration>, e.g. /mute 2h"
+	}
+	duration, err := time.ParseDuration(args[0])
+	if err != nil || duration <= 0 {
+		return fmt.Sprintf("Invalid duration %q, e.g. /mute 2h", args[0])
+	}
+
+	user.MutedUntil = time.Now().UTC().Add(duration)
+	if err := db.UpdateUserMutedUntil(user); err != nil {
+		return fmt.Sprintf("Error muting alerts: %s", err)
+	}
+	return fmt.Sprintf("Alerts muted until %s.", user.MutedUntil.Format(time.RFC850))
+}
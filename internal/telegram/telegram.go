@@ -0,0 +1,157 @@
+// Package telegram sends nodewatcher alerts through a Telegram bot and answers commands sent
+// to the bot by linked users
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultAPIURL is the base URL of the Telegram Bot API
+const DefaultAPIURL = "https://api.telegram.org"
+
+// Client is a minimal Telegram Bot API client
+type Client struct {
+	Token      string
+	APIURL     string
+	HTTPClient *http.Client
+}
+
+// Chat is the conversation a message belongs to
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+// Message is a message received by the bot
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	Chat      Chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+// Update is an incoming update from the Telegram Bot API
+type Update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *Message `json:"message"`
+}
+
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+// NewClient returns a client for the bot with the given token. An empty apiURL
+// uses the public Telegram Bot API
+func NewClient(token string, apiURL string) *Client {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Client{
+		Token:      token,
+		APIURL:     apiURL,
+		HTTPClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (c *Client) methodURL(method string) string {
+	return fmt.Sprintf("%s/bot%s/%s", c.APIURL, c.Token, method)
+}
+
+func (c *Client) do(req *http.Request, result interface{}) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var apiResp apiResponse
+	err = json.NewDecoder(resp.Body).Decode(&apiResp)
+	if err != nil {
+		return err
+	}
+	if !apiResp.OK {
+		return fmt.Errorf("telegram: %s", apiResp.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(apiResp.Result, result)
+}
+
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.methodURL(method), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, result)
+}
+
+// GetUpdates long-polls the Bot API for updates with an ID of at least offset
+func (c *Client) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error) {
+	params := map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}
+	var updates []Update
+	err := c.call(ctx, "getUpdates", params, &updates)
+	return updates, err
+}
+
+// SendMessage sends a text message to a chat
+func (c *Client) SendMessage(ctx context.Context, chatID int64, text string) error {
+	params := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}
+	return c.call(ctx, "sendMessage", params, nil)
+}
+
+// SendDocument uploads a file to a chat
+func (c *Client) SendDocument(ctx context.Context, chatID int64, filename string, data []byte, caption string) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	err := form.WriteField("chat_id", strconv.FormatInt(chatID, 10))
+	if err != nil {
+		return err
+	}
+	if caption != "" {
+		err = form.WriteField("caption", caption)
+		if err != nil {
+			return err
+		}
+	}
+	file, err := form.CreateFormFile("document", filename)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	err = form.Close()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.methodURL("sendDocument"), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return c.do(req, nil)
+}
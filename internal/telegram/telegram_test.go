@@ -0,0 +1,79 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newFakeBotAPI starts a local server that answers Bot API requests for the token "TOKEN"
+func newFakeBotAPI(t *testing.T, handler func(method string, r *http.Request) interface{}) *Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.URL.Path[len("/botTOKEN/"):]
+		result, err := json.Marshal(handler(method, r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(apiResponse{OK: true, Result: result})
+	}))
+	t.Cleanup(server.Close)
+	return NewClient("TOKEN", server.URL)
+}
+
+func TestParseCommand(t *testing.T) {
+	command, args := parseCommand("/status@nodewatcher_bot mynode")
+	if command != "status" || len(args) != 1 || args[0] != "mynode" {
+		t.Errorf("unexpected command %q args %v", command, args)
+	}
+
+	command, _ = parseCommand("hello")
+	if command != "" {
+		t.Errorf("expected no command, got %q", command)
+	}
+}
+
+func TestGetUpdates(t *testing.T) {
+	client := newFakeBotAPI(t, func(method string, r *http.Request) interface{} {
+		if method != "getUpdates" {
+			t.Errorf("unexpected method %s", method)
+		}
+		return []Update{{UpdateID: 7, Message: &Message{Chat: Chat{ID: 42}, Text: "/channels"}}}
+	})
+
+	updates, err := client.GetUpdates(context.Background(), 0, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0].Message.Chat.ID != 42 || updates[0].Message.Text != "/channels" {
+		t.Errorf("unexpected updates %+v", updates)
+	}
+}
+
+func TestSendDocument(t *testing.T) {
+	client := newFakeBotAPI(t, func(method string, r *http.Request) interface{} {
+		if method != "sendDocument" {
+			t.Errorf("unexpected method %s", method)
+		}
+		if r.FormValue("chat_id") != "42" {
+			t.Errorf("unexpected chat_id %s", r.FormValue("chat_id"))
+		}
+		file, header, err := r.FormFile("document")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(file)
+		if header.Filename != "node-channel.backup" || string(data) != "backup" {
+			t.Errorf("unexpected document %s: %s", header.Filename, data)
+		}
+		return true
+	})
+
+	err := client.SendDocument(context.Background(), 42, "node-channel.backup", []byte("backup"), "caption")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,295 @@
+// Package templates renders the text of alerts from text/template templates that users define
+// per channel and event type, falling back to operator defaults and then to the built-in text
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+)
+
+// AnyChannel is the channel of templates used for every channel without its own template
+const AnyChannel = "any"
+
+// MaxLength is the maximum length of a template
+const MaxLength = 4000
+
+// Channels are the channels templates can be defined for
+var Channels = []string{
+	AnyChannel, notify.ChannelSMS, notify.ChannelTelegram, notify.ChannelPagerDuty,
+	notify.ChannelSlack, notify.ChannelDiscord, notify.ChannelNostr,
+}
+
+// Events are the event types templates can be defined for
+var Events = []notify.Event{notify.EventReport, notify.EventTrigger, notify.EventResolve}
+
+// defaults are the operator's templates, keyed by channel and event
+var defaults = make(map[string]string)
+
+// Node is the part of a lightning node that templates can show. Credentials are left out
+type Node struct {
+	ID     int64
+	Alias  string
+	Pubkey string
+	URL    string
+}
+
+// Check is the last known result of a health check of the node
+type Check struct {
+	Name         string
+	Severity     string
+	Failing      bool
+	Message      string
+	ChangedAt    time.Time
+	Acknowledged bool
+}
+
+// Data is what templates are executed with. Message is the built-in text of the alert and
+// Snapshot is nil when the node could not be reached
+type Data struct {
+	Node     Node
+	Event    string
+	Check    string
+	Severity string
+	Title    string
+	Message  string
+	Snapshot *notify.Snapshot
+	Checks   []Check
+}
+
+var funcs = template.FuncMap{
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Round(time.Minute).String() + " ago"
+	},
+	"trim": strings.TrimSpace,
+}
+
+func key(channel string, event string) string {
+	return channel + "." + event
+}
+
+// Parse parses a template
+func Parse(body string) (*template.Template, error) {
+	if len(body) > MaxLength {
+		return nil, fmt.Errorf("template is longer than %d characters", MaxLength)
+	}
+	return template.New("alert").Funcs(funcs).Option("missingkey=error").Parse(body)
+}
+
+// Render executes a template with data
+func Render(body string, data Data) (string, error) {
+	tmpl, err := Parse(body)
+	if err != nil {
+		return "", err
+	}
+	var text bytes.Buffer
+	err = tmpl.Execute(&text, data)
+	if err != nil {
+		return "", err
+	}
+	return text.String(), nil
+}
+
+// Validate checks that a template parses and renders against sample data
+func Validate(channel string, event string, body string) error {
+	if !valid(channel, event) {
+		return fmt.Errorf("unknown channel %q or event %q", channel, event)
+	}
+	_, err := Render(body, sampleData(notify.Event(event)))
+	return err
+}
+
+func valid(channel string, event string) bool {
+	knownChannel, knownEvent := false, false
+	for _, c := range Channels {
+		knownChannel = knownChannel || c == channel
+	}
+	for _, e := range Events {
+		knownEvent = knownEvent || string(e) == event
+	}
+	return knownChannel && knownEvent
+}
+
+// LoadDefaults loads the operator's default templates from files named <channel>.<event>.tmpl
+// in dir, e.g. sms.report.tmpl or any.trigger.tmpl
+func LoadDefaults(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		parts := strings.Split(strings.TrimSuffix(filepath.Base(path), ".tmpl"), ".")
+		if len(parts) != 2 {
+			return fmt.Errorf("%s: expected a name like <channel>.<event>.tmpl", path)
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		err = Validate(parts[0], parts[1], string(body))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defaults[key(parts[0], parts[1])] = string(body)
+	}
+	return nil
+}
+
+// Set is the templates of a user, loaded once so they can be applied to every alert of a health
+// check run without querying the db for each notifier
+type Set struct {
+	user   db.User
+	byKey  map[string]string
+	checks map[int64][]db.NodeCheck
+}
+
+// Load gets the templates of a user
+func Load(user db.User) *Set {
+	set := &Set{user: user, byKey: make(map[string]string), checks: make(map[int64][]db.NodeCheck)}
+	templates, err := db.FindNotificationTemplates(user.ID)
+	if err != nil {
+		log.Printf("Error getting notification templates of user %s: %s", user.Email, err)
+	}
+	for _, t := range templates {
+		set.byKey[key(t.Channel, t.Event)] = t.Body
+	}
+	return set
+}
+
+// find gets the template for alerts of an event sent over a channel. A template of the user is
+// preferred over a default, and a template for the channel over one for any channel
+func (s *Set) find(channel string, event string) (string, bool) {
+	for _, source := range []map[string]string{s.byKey, defaults} {
+		for _, c := range []string{channel, AnyChannel} {
+			if body, ok := source[key(c, event)]; ok {
+				return body, true
+			}
+		}
+	}
+	return "", false
+}
+
+// nodeChecks gets the health checks of a node, once per set
+func (s *Set) nodeChecks(nodeID int64) []db.NodeCheck {
+	checks, ok := s.checks[nodeID]
+	if !ok {
+		checks, _ = db.FindNodeChecks(nodeID)
+		s.checks[nodeID] = checks
+	}
+	return checks
+}
+
+// NewData gets the data templates are executed with for an alert
+func NewData(alert notify.Alert, checks []db.NodeCheck) Data {
+	data := Data{
+		Node: Node{
+			ID:     alert.Node.ID,
+			Alias:  alert.Node.Alias,
+			Pubkey: alert.Node.Pubkey,
+			URL:    alert.Node.URL,
+		},
+		Event:    string(alert.Event),
+		Check:    alert.Check,
+		Severity: string(alert.Severity),
+		Title:    alert.Title(),
+		Message:  alert.Message,
+		Snapshot: alert.Snapshot,
+	}
+	for _, check := range checks {
+		data.Checks = append(data.Checks, Check{
+			Name:         check.Name,
+			Severity:     check.Severity,
+			Failing:      check.Failing,
+			Message:      check.Message,
+			ChangedAt:    check.ChangedAt,
+			Acknowledged: !check.AcknowledgedAt.IsZero(),
+		})
+	}
+	return data
+}
+
+// Apply replaces the message of an alert sent over a channel with the rendered template for the
+// channel and event, if there is one. The alert is returned unchanged if the template fails to
+// render
+func (s *Set) Apply(channel string, alert notify.Alert) notify.Alert {
+	body, ok := s.find(channel, string(alert.Event))
+	if !ok {
+		return alert
+	}
+	text, err := Render(body, NewData(alert, s.nodeChecks(alert.Node.ID)))
+	if err != nil {
+		log.Printf("Error rendering %s %s template of user %s: %s", channel, alert.Event, s.user.Email, err)
+		return alert
+	}
+	alert.Message = text
+	return alert
+}
+
+// ApplyTo applies the template of a notifier's channel to an alert. Notifiers without a
+// channel get the alert unchanged
+func (s *Set) ApplyTo(notifier notify.Notifier, alert notify.Alert) notify.Alert {
+	if channelNotifier, ok := notifier.(notify.ChannelNotifier); ok {
+		return s.Apply(channelNotifier.Channel(), alert)
+	}
+	return alert
+}
+
+// Apply applies a user's template for a channel to a single alert
+func Apply(user db.User, channel string, alert notify.Alert) notify.Alert {
+	return Load(user).Apply(channel, alert)
+}
+
+// Preview renders a template for an event against the latest snapshot and health checks of a node
+func Preview(node db.Node, event string, body string) (string, error) {
+	alert := notify.Alert{Node: node, Event: notify.Event(event), Severity: notify.SeverityInfo}
+
+	saved, err := db.FindNodeSnapshot(node.ID)
+	if err == nil {
+		alert.Snapshot = &notify.Snapshot{}
+		if err := json.Unmarshal([]byte(saved.Snapshot), alert.Snapshot); err != nil {
+			return "", err
+		}
+	}
+
+	checks, err := db.FindNodeChecks(node.ID)
+	if err != nil {
+		return "", err
+	}
+	for _, check := range checks {
+		if alert.Event == notify.EventReport || check.Failing == (alert.Event == notify.EventTrigger) {
+			alert.Check = check.Name
+			alert.Message = check.Message
+			if alert.Event == notify.EventTrigger {
+				alert.Severity = notify.Severity(check.Severity)
+			}
+			break
+		}
+	}
+	return Render(body, NewData(alert, checks))
+}
+
+// sampleData is used to validate templates
+func sampleData(event notify.Event) Data {
+	alert := notify.Alert{
+		Node:     db.Node{ID: 1, Alias: "mynode", Pubkey: "02aaaa", URL: "mynode.example.com:10009"},
+		Event:    event,
+		Check:    "node_down",
+		Severity: notify.SeverityCritical,
+		Message:  "Lightning node is unreachable.",
+		Snapshot: &notify.Snapshot{SyncedToChain: true, SyncedToGraph: true, BlockHeight: 780000, ActiveChannels: 3, LastBackup: time.Now()},
+	}
+	checks := []db.NodeCheck{{Name: "node_down", Severity: "critical", Failing: true, Message: alert.Message, ChangedAt: time.Now()}}
+	return NewData(alert, checks)
+}
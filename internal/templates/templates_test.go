@@ -0,0 +1,71 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mvpratt/nodewatcher/internal/notify"
+)
+
+func TestRender(t *testing.T) {
+	body := `{{.Node.Alias}} {{.Event}}: {{trim .Message}}{{with .Snapshot}} at block {{.BlockHeight}}{{end}}` +
+		`{{range .Checks}}{{if .Failing}} [{{.Name}}]{{end}}{{end}}`
+	text, err := Render(body, sampleData(notify.EventTrigger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "mynode trigger: Lightning node is unreachable. at block 780000 [node_down]"
+	if text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate("sms", "report", "{{.Node.Alias}}"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := Validate("sms", "report", "{{.Node.Macaroon}}"); err == nil {
+		t.Error("expected error for a field templates cannot access")
+	}
+	if err := Validate("sms", "report", "{{.Node.Alias"); err == nil {
+		t.Error("expected parse error")
+	}
+	if err := Validate("fax", "report", "{{.Node.Alias}}"); err == nil {
+		t.Error("expected unknown channel error")
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "any.report.tmpl"), []byte("{{.Node.Alias}} ok"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadDefaults(dir); err != nil {
+		t.Fatal(err)
+	}
+	if defaults["any.report"] != "{{.Node.Alias}} ok" {
+		t.Errorf("default template not loaded: %v", defaults)
+	}
+}
+
+func TestFind(t *testing.T) {
+	defaults = map[string]string{"any.trigger": "default", "sms.resolve": "sms default"}
+	defer func() { defaults = make(map[string]string) }()
+	set := &Set{byKey: map[string]string{"any.trigger": "user any", "telegram.trigger": "user telegram"}}
+
+	tests := []struct{ channel, event, want string }{
+		{"telegram", "trigger", "user telegram"},
+		{"slack", "trigger", "user any"},
+		{"sms", "resolve", "sms default"},
+	}
+	for _, test := range tests {
+		if body, _ := set.find(test.channel, test.event); body != test.want {
+			t.Errorf("%s %s: got %q, want %q", test.channel, test.event, body, test.want)
+		}
+	}
+	if _, ok := set.find("slack", "report"); ok {
+		t.Error("expected no template for an event without one")
+	}
+}
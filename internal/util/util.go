@@ -1,6 +1,8 @@
 package util
 
 import (
+	"encoding/hex"
+	"fmt"
 	"log"
 	"os"
 
@@ -17,6 +19,18 @@ func RequireEnvVar(varName string) string {
 	return env
 }
 
+// ValidatePubkey checks that a node pubkey is a 33 byte compressed public key in hex, as LND
+// shows it. Pubkeys name backup files and objects, so nothing else is accepted
+func ValidatePubkey(pubkey string) error {
+	if len(pubkey) != 66 {
+		return fmt.Errorf("invalid pubkey %q, expected 66 hex characters", pubkey)
+	}
+	if _, err := hex.DecodeString(pubkey); err != nil {
+		return fmt.Errorf("invalid pubkey %q, expected 66 hex characters", pubkey)
+	}
+	return nil
+}
+
 // GetLndClient returns a lndclient for a given node
 func GetLndClient(node db.Node) (*lndclient.LightningClient, error) {
 
@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+)
+
+// DiscordField is a name/value pair displayed in an embed
+type DiscordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// DiscordFooter is the footer of an embed
+type DiscordFooter struct {
+	Text string `json:"text"`
+}
+
+// DiscordEmbed is a rich message in a Discord channel
+type DiscordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	URL         string         `json:"url,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []DiscordField `json:"fields"`
+	Timestamp   string         `json:"timestamp"`
+	Footer      *DiscordFooter `json:"footer,omitempty"`
+}
+
+// DiscordMessage is the payload of a Discord webhook
+type DiscordMessage struct {
+	Username string         `json:"username"`
+	Embeds   []DiscordEmbed `json:"embeds"`
+}
+
+// DiscordNotifier posts alerts to the Discord webhook of each user. Discord allows
+// 5 requests per 2 seconds per webhook
+type DiscordNotifier struct {
+	DashboardURL string
+	HTTPClient   *http.Client
+	Limiter      *RateLimiter
+}
+
+// NewDiscordNotifier returns a Discord notifier linking alerts to the given dashboard URL
+func NewDiscordNotifier(dashboardURL string) *DiscordNotifier {
+	return &DiscordNotifier{
+		DashboardURL: dashboardURL,
+		HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+		Limiter:      NewRateLimiter(5, 2*time.Second),
+	}
+}
+
+// discordMessage renders an alert as a Discord embed
+func discordMessage(alert notify.Alert, dashboardURL string) DiscordMessage {
+	fields := []DiscordField{{Name: "Severity", Value: string(alert.Severity), Inline: true}}
+	if alert.Node.Alias != "" {
+		fields = append(fields,
+			DiscordField{Name: "Node", Value: alert.Node.Alias, Inline: true},
+			DiscordField{Name: "Pubkey", Value: fmt.Sprintf("`%s`", alert.Node.Pubkey)},
+		)
+	}
+	if alert.Snapshot != nil {
+		fields = append(fields,
+			DiscordField{Name: "Block height", Value: fmt.Sprint(alert.Snapshot.BlockHeight), Inline: true},
+			DiscordField{Name: "Channels", Value: channelCounts(alert.Snapshot), Inline: true},
+		)
+	}
+
+	return DiscordMessage{
+		Username: "nodewatcher",
+		Embeds: []DiscordEmbed{{
+			Title:       alert.Title(),
+			Description: strings.TrimSpace(alert.Message),
+			URL:         dashboardURL,
+			Color:       severityColor(alert.Severity),
+			Fields:      fields,
+			Timestamp:   time.Now().UTC().Format(time.RFC3339),
+			Footer:      &DiscordFooter{Text: "nodewatcher"},
+		}},
+	}
+}
+
+// Channel is the name of the channel alerts are delivered over
+func (n *DiscordNotifier) Channel() string {
+	return notify.ChannelDiscord
+}
+
+// Notify posts an alert to the user's Discord webhook. Users without a webhook are skipped
+// with notify.ErrNotConfigured
+func (n *DiscordNotifier) Notify(user db.User, alert notify.Alert) error {
+	if user.DiscordWebhookURL == "" {
+		return notify.ErrNotConfigured
+	}
+	return post(n.HTTPClient, n.Limiter, user.DiscordWebhookURL, discordMessage(alert, n.DashboardURL))
+}
@@ -0,0 +1,108 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+)
+
+// SlackText is a text object in a Slack block
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// SlackBlock is a Slack Block Kit layout block
+type SlackBlock struct {
+	Type   string       `json:"type"`
+	Text   *SlackText   `json:"text,omitempty"`
+	Fields []*SlackText `json:"fields,omitempty"`
+}
+
+// SlackAttachment wraps blocks so they are displayed next to a colored bar
+type SlackAttachment struct {
+	Color  string       `json:"color"`
+	Blocks []SlackBlock `json:"blocks"`
+}
+
+// SlackMessage is the payload of a Slack incoming webhook
+type SlackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []SlackAttachment `json:"attachments"`
+}
+
+// SlackNotifier posts alerts to the Slack incoming webhook of each user. Slack allows
+// about one message per second per webhook
+type SlackNotifier struct {
+	DashboardURL string
+	HTTPClient   *http.Client
+	Limiter      *RateLimiter
+}
+
+// NewSlackNotifier returns a Slack notifier linking alerts to the given dashboard URL
+func NewSlackNotifier(dashboardURL string) *SlackNotifier {
+	return &SlackNotifier{
+		DashboardURL: dashboardURL,
+		HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+		Limiter:      NewRateLimiter(1, time.Second),
+	}
+}
+
+func markdownField(name string, value string) *SlackText {
+	return &SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\n%s", name, value)}
+}
+
+// slackMessage renders an alert as Slack blocks
+func slackMessage(alert notify.Alert, dashboardURL string) SlackMessage {
+	fields := []*SlackText{markdownField("Severity", string(alert.Severity))}
+	if alert.Node.Alias != "" {
+		fields = append(fields,
+			markdownField("Node", alert.Node.Alias),
+			markdownField("Pubkey", fmt.Sprintf("`%s`", alert.Node.Pubkey)),
+		)
+	}
+	if alert.Snapshot != nil {
+		fields = append(fields,
+			markdownField("Block height", fmt.Sprint(alert.Snapshot.BlockHeight)),
+			markdownField("Channels", channelCounts(alert.Snapshot)),
+		)
+	}
+
+	blocks := []SlackBlock{
+		{Type: "header", Text: &SlackText{Type: "plain_text", Text: alert.Title()}},
+		{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: strings.TrimSpace(alert.Message)}},
+		{Type: "section", Fields: fields},
+	}
+	if dashboardURL != "" {
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackText{Type: "mrkdwn", Text: fmt.Sprintf("<%s|Open dashboard>", dashboardURL)},
+		})
+	}
+
+	return SlackMessage{
+		Text: alert.Title(),
+		Attachments: []SlackAttachment{{
+			Color:  fmt.Sprintf("#%06X", severityColor(alert.Severity)),
+			Blocks: blocks,
+		}},
+	}
+}
+
+// Channel is the name of the channel alerts are delivered over
+func (n *SlackNotifier) Channel() string {
+	return notify.ChannelSlack
+}
+
+// Notify posts an alert to the user's Slack webhook. Users without a webhook are skipped
+// with notify.ErrNotConfigured
+func (n *SlackNotifier) Notify(user db.User, alert notify.Alert) error {
+	if user.SlackWebhookURL == "" {
+		return notify.ErrNotConfigured
+	}
+	return post(n.HTTPClient, n.Limiter, user.SlackWebhookURL, slackMessage(alert, n.DashboardURL))
+}
@@ -0,0 +1,126 @@
+// Package webhook sends nodewatcher alerts to Slack and Discord incoming webhooks
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/notify"
+)
+
+// Colors used to highlight alerts by severity
+const (
+	colorCritical = 0xD0021B
+	colorWarning  = 0xF5A623
+	colorInfo     = 0x2EB67D
+)
+
+func severityColor(severity notify.Severity) int {
+	switch severity {
+	case notify.SeverityCritical:
+		return colorCritical
+	case notify.SeverityWarning:
+		return colorWarning
+	default:
+		return colorInfo
+	}
+}
+
+func channelCounts(snapshot *notify.Snapshot) string {
+	return fmt.Sprintf("%d active / %d inactive / %d pending",
+		snapshot.ActiveChannels, snapshot.InactiveChannels, snapshot.PendingChannels)
+}
+
+// RateLimiter allows at most Limit requests per Period to each webhook URL
+type RateLimiter struct {
+	Limit  int
+	Period time.Duration
+
+	mu   sync.Mutex
+	sent map[string][]time.Time
+}
+
+// NewRateLimiter returns a rate limiter allowing limit requests per period
+func NewRateLimiter(limit int, period time.Duration) *RateLimiter {
+	return &RateLimiter{
+		Limit:  limit,
+		Period: period,
+		sent:   make(map[string][]time.Time),
+	}
+}
+
+// reserve records a request to the key and returns how long to wait before sending it
+func (r *RateLimiter) reserve(key string, now time.Time) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// forget requests that are outside the window
+	recent := r.sent[key]
+	for len(recent) > 0 && now.Sub(recent[0]) >= r.Period {
+		recent = recent[1:]
+	}
+
+	at := now
+	if len(recent) >= r.Limit {
+		at = recent[len(recent)-r.Limit].Add(r.Period)
+	}
+	r.sent[key] = append(recent, at)
+	return at.Sub(now)
+}
+
+// Wait blocks until a request to the key is allowed
+func (r *RateLimiter) Wait(key string) {
+	time.Sleep(r.reserve(key, time.Now()))
+}
+
+// post sends a JSON payload to a webhook, waiting for the rate limiter and retrying once if
+// the platform responds with 429 Too Many Requests
+func post(client *http.Client, limiter *RateLimiter, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		limiter.Wait(url)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			cancel()
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		cancel()
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt == 0 {
+			time.Sleep(retryAfter(resp))
+			continue
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("webhook: %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// retryAfter reads the Retry-After header (in seconds), defaulting to one second
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64)
+	if err != nil || seconds <= 0 {
+		return time.Second
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mvpratt/nodewatcher/internal/db"
+	"github.com/mvpratt/nodewatcher/internal/notify"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(2, time.Second)
+	now := time.Now()
+
+	if wait := limiter.reserve("a", now); wait != 0 {
+		t.Errorf("first request should not wait, got %s", wait)
+	}
+	if wait := limiter.reserve("a", now); wait != 0 {
+		t.Errorf("second request should not wait, got %s", wait)
+	}
+	if wait := limiter.reserve("a", now); wait != time.Second {
+		t.Errorf("third request should wait 1s, got %s", wait)
+	}
+	if wait := limiter.reserve("b", now); wait != 0 {
+		t.Errorf("other webhooks should not wait, got %s", wait)
+	}
+	if wait := limiter.reserve("a", now.Add(2*time.Second)); wait != 0 {
+		t.Errorf("request after the window should not wait, got %s", wait)
+	}
+}
+
+func TestSlackMessage(t *testing.T) {
+	alert := notify.Alert{
+		Node:     db.Node{Alias: "mynode", Pubkey: "02abc"},
+		Event:    notify.EventTrigger,
+		Check:    "node_down",
+		Severity: notify.SeverityCritical,
+		Message:  "\n\nWARNING: Lightning node is unreachable",
+		Snapshot: &notify.Snapshot{BlockHeight: 780000, ActiveChannels: 3},
+	}
+
+	msg := slackMessage(alert, "https://dashboard.example.com")
+	if msg.Attachments[0].Color != "#D0021B" {
+		t.Errorf("unexpected color %s", msg.Attachments[0].Color)
+	}
+
+	blocks := msg.Attachments[0].Blocks
+	if blocks[0].Text.Text != "mynode: node_down failing" {
+		t.Errorf("unexpected title %q", blocks[0].Text.Text)
+	}
+	var fields []string
+	for _, field := range blocks[2].Fields {
+		fields = append(fields, field.Text)
+	}
+	if !strings.Contains(strings.Join(fields, "\n"), "780000") {
+		t.Errorf("expected block height in fields %v", fields)
+	}
+	if blocks[3].Text.Text != "<https://dashboard.example.com|Open dashboard>" {
+		t.Errorf("unexpected dashboard link %q", blocks[3].Text.Text)
+	}
+}